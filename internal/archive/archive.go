@@ -0,0 +1,51 @@
+// Package archive defines the format in which the raw webhook events
+// are archived: one JSON object per line (JSONL), with each object
+// containing the webhook event's HTTP headers and its body as is,
+// so that the webhook event can be re-delivered (and its signature
+// re-verified) exactly as it was received.
+package archive
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// excludedHeaders are the credentials that might be added by the proxies
+// in front of this server and that have nothing to do with Cirrus CI.
+var excludedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+type Record struct {
+	ReceivedAt time.Time   `json:"received_at"`
+	EventType  string      `json:"event_type"`
+	Headers    http.Header `json:"headers"`
+
+	// Body is a string and not a json.RawMessage, because the latter
+	// is compacted when marshalled, which would break the signature.
+	Body string `json:"body"`
+}
+
+func NewRecord(header http.Header, presentedEventType string, body []byte, receivedAt time.Time) *Record {
+	headers := header.Clone()
+
+	for _, excludedHeader := range excludedHeaders {
+		headers.Del(excludedHeader)
+	}
+
+	return &Record{
+		ReceivedAt: receivedAt.UTC(),
+		EventType:  presentedEventType,
+		Headers:    headers,
+		Body:       string(body),
+	}
+}
+
+// MarshalLine marshals the record as a single JSONL line, including the trailing newline.
+func (record *Record) MarshalLine() ([]byte, error) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(line, '\n'), nil
+}
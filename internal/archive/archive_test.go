@@ -0,0 +1,38 @@
+package archive_test
+
+import (
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/archive"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Cirrus-Event", "task")
+	header.Set("X-Cirrus-Signature", "abcdef")
+	header.Set("Authorization", "Bearer secret")
+
+	// The body's formatting should be preserved as is
+	body := []byte("{\n  \"action\": \"created\"\n}")
+
+	record := archive.NewRecord(header, "task", body, time.UnixMilli(1722408869403))
+
+	line, err := record.MarshalLine()
+	require.NoError(t, err)
+	require.Equal(t, byte('\n'), line[len(line)-1])
+
+	var decodedRecord archive.Record
+	require.NoError(t, json.Unmarshal(line, &decodedRecord))
+
+	require.Equal(t, "task", decodedRecord.EventType)
+	require.Equal(t, "2024-07-31T06:54:29.403Z", decodedRecord.ReceivedAt.Format(time.RFC3339Nano))
+	require.Equal(t, string(body), decodedRecord.Body)
+	require.Equal(t, "abcdef", decodedRecord.Headers.Get("X-Cirrus-Signature"))
+	require.Empty(t, decodedRecord.Headers.Get("Authorization"))
+
+	// The original header is left intact
+	require.Equal(t, "Bearer secret", header.Get("Authorization"))
+}
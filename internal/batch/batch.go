@@ -0,0 +1,168 @@
+// Package batch accumulates the items submitted by the concurrent webhook
+// event handlers and flushes them together, while letting each handler
+// wait for the result of flushing its own item, so that the webhook
+// event is only acknowledged to Cirrus CI once it's durably stored.
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrClosed = errors.New("batcher is closed")
+
+// FlushFunc flushes the items and returns the per-item errors,
+// which should be of the same length as the items.
+type FlushFunc[T any] func(ctx context.Context, items []T) []error
+
+type pendingItem[T any] struct {
+	item   T
+	result chan error
+}
+
+type Option[T any] func(*Batcher[T])
+
+// WithWeight makes the batch size to be measured in the total weight
+// of the items instead of their number, for example, in bytes.
+func WithWeight[T any](weight func(item T) int) Option[T] {
+	return func(batcher *Batcher[T]) {
+		batcher.weight = weight
+	}
+}
+
+type Batcher[T any] struct {
+	size         int
+	interval     time.Duration
+	flushTimeout time.Duration
+	flush        FlushFunc[T]
+	weight       func(item T) int
+
+	items   chan *pendingItem[T]
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// New creates a batcher that flushes the items once either size items
+// were submitted or the interval has passed since the first item.
+func New[T any](
+	size int,
+	interval time.Duration,
+	flushTimeout time.Duration,
+	flush FlushFunc[T],
+	opts ...Option[T],
+) *Batcher[T] {
+	batcher := &Batcher[T]{
+		size:         size,
+		interval:     interval,
+		flushTimeout: flushTimeout,
+		flush:        flush,
+		weight: func(T) int {
+			return 1
+		},
+		items:   make(chan *pendingItem[T]),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(batcher)
+	}
+
+	go batcher.run()
+
+	return batcher
+}
+
+// Submit adds the item to the current batch and waits until it's flushed.
+func (batcher *Batcher[T]) Submit(ctx context.Context, item T) error {
+	pendingItem := &pendingItem[T]{
+		item:   item,
+		result: make(chan error, 1),
+	}
+
+	select {
+	case batcher.items <- pendingItem:
+	case <-batcher.stopped:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-pendingItem.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes the pending items and stops the batcher.
+func (batcher *Batcher[T]) Close() {
+	close(batcher.stop)
+	<-batcher.stopped
+}
+
+func (batcher *Batcher[T]) run() {
+	defer close(batcher.stopped)
+
+	var batch []*pendingItem[T]
+	var batchWeight int
+	var flushCh <-chan time.Time
+
+	for {
+		select {
+		case pendingItem := <-batcher.items:
+			batch = append(batch, pendingItem)
+			batchWeight += batcher.weight(pendingItem.item)
+
+			if len(batch) == 1 {
+				flushCh = time.After(batcher.interval)
+			}
+
+			if batchWeight < batcher.size {
+				continue
+			}
+		case <-flushCh:
+			// time to flush
+		case <-batcher.stop:
+			batcher.flushBatch(batch)
+
+			return
+		}
+
+		batcher.flushBatch(batch)
+
+		batch = nil
+		batchWeight = 0
+		flushCh = nil
+	}
+}
+
+func (batcher *Batcher[T]) flushBatch(batch []*pendingItem[T]) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), batcher.flushTimeout)
+	defer cancel()
+
+	items := make([]T, 0, len(batch))
+
+	for _, pendingItem := range batch {
+		items = append(items, pendingItem.item)
+	}
+
+	errs := batcher.flush(ctx, items)
+
+	for i, pendingItem := range batch {
+		if len(errs) != len(batch) {
+			pendingItem.result <- fmt.Errorf("flush returned %d errors for %d items", len(errs), len(batch))
+
+			continue
+		}
+
+		pendingItem.result <- errs[i]
+	}
+}
@@ -0,0 +1,109 @@
+package batch_test
+
+import (
+	"context"
+	"errors"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/batch"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	batches [][]int
+	mtx     sync.Mutex
+}
+
+func (recorder *recorder) flush(_ context.Context, items []int) []error {
+	recorder.mtx.Lock()
+	defer recorder.mtx.Unlock()
+
+	recorder.batches = append(recorder.batches, items)
+
+	errs := make([]error, len(items))
+
+	for i, item := range items {
+		if item < 0 {
+			errs[i] = errors.New("negative item")
+		}
+	}
+
+	return errs
+}
+
+func TestFlushOnSize(t *testing.T) {
+	recorder := &recorder{}
+
+	// The interval is long enough for the batch to be only flushed on size
+	batcher := batch.New(3, time.Hour, time.Second, recorder.flush)
+	defer batcher.Close()
+
+	var wg sync.WaitGroup
+
+	for _, item := range []int{1, 2, -3} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err := batcher.Submit(context.Background(), item)
+
+			if item < 0 {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	require.Len(t, recorder.batches, 1)
+	require.ElementsMatch(t, []int{1, 2, -3}, recorder.batches[0])
+}
+
+func TestFlushOnInterval(t *testing.T) {
+	recorder := &recorder{}
+
+	batcher := batch.New(100, 10*time.Millisecond, time.Second, recorder.flush)
+	defer batcher.Close()
+
+	require.NoError(t, batcher.Submit(context.Background(), 1))
+	require.NoError(t, batcher.Submit(context.Background(), 2))
+
+	require.Equal(t, [][]int{{1}, {2}}, recorder.batches)
+}
+
+func TestFlushOnWeight(t *testing.T) {
+	recorder := &recorder{}
+
+	batcher := batch.New(10, time.Hour, time.Second, recorder.flush, batch.WithWeight(func(item int) int {
+		return item
+	}))
+	defer batcher.Close()
+
+	var wg sync.WaitGroup
+
+	for _, item := range []int{4, 6} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			require.NoError(t, batcher.Submit(context.Background(), item))
+		}()
+	}
+
+	wg.Wait()
+
+	require.Len(t, recorder.batches, 1)
+	require.ElementsMatch(t, []int{4, 6}, recorder.batches[0])
+}
+
+func TestClosed(t *testing.T) {
+	batcher := batch.New(100, time.Hour, time.Second, (&recorder{}).flush)
+	batcher.Close()
+
+	require.ErrorIs(t, batcher.Submit(context.Background(), 1), batch.ErrClosed)
+}
@@ -0,0 +1,16 @@
+package cirrus
+
+// AuditEvent is a payload of the "audit_event" webhook event.
+type AuditEvent struct {
+	ID *string `json:"id"`
+
+	// Data is a JSON-encoded string with the event-specific data.
+	Data *string `json:"data"`
+
+	ActorLocationIP *string `json:"actorLocationIp"`
+
+	Build Build `json:"build"`
+	Task  Task  `json:"task"`
+
+	Common
+}
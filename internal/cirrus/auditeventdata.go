@@ -0,0 +1,69 @@
+package cirrus
+
+// AuditEventData is a decoded AuditEvent.Data, use a type switch
+// to get to the mutation-specific fields.
+type AuditEventData interface {
+	Common() *AuditEventDataCommon
+}
+
+// AuditEventDataCommon contains the fields shared by all mutations,
+// it's also used for the mutations without a known schema.
+type AuditEventDataCommon struct {
+	MutationName     *string `json:"mutationName"`
+	ClientMutationID *string `json:"clientMutationId"`
+	BuildID          *string `json:"buildId"`
+	TaskID           *string `json:"taskId"`
+}
+
+func (common *AuditEventDataCommon) Common() *AuditEventDataCommon {
+	return common
+}
+
+type GenerateNewScopedAccessTokenData struct {
+	Platform        *string  `json:"platform"`
+	OwnerUID        *string  `json:"ownerUid"`
+	DurationSeconds *int64   `json:"durationSeconds"`
+	Permission      *string  `json:"permission"`
+	RepositoryNames []string `json:"repositoryNames"`
+
+	AuditEventDataCommon
+}
+
+//nolint:gochecknoglobals
+var auditEventDataRegistry = map[string]func() AuditEventData{
+	"GenerateNewScopedAccessToken": func() AuditEventData {
+		return &GenerateNewScopedAccessTokenData{}
+	},
+}
+
+// DecodeData decodes the audit event's data using the schema known for its
+// mutation name and returns nil if the audit event carries no data.
+func (auditEvent *AuditEvent) DecodeData(mode DecodingMode) (AuditEventData, error) {
+	if auditEvent.Data == nil {
+		return nil, nil
+	}
+
+	var common AuditEventDataCommon
+
+	if err := Decode([]byte(*auditEvent.Data), &common, DecodingModeLenient); err != nil {
+		return nil, err
+	}
+
+	if common.MutationName == nil {
+		return &common, nil
+	}
+
+	newData, ok := auditEventDataRegistry[*common.MutationName]
+
+	if !ok {
+		return &common, nil
+	}
+
+	data := newData()
+
+	if err := Decode([]byte(*auditEvent.Data), data, mode); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
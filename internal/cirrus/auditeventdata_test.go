@@ -0,0 +1,47 @@
+package cirrus_test
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeAuditEventData(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "audit_event.json"))
+	require.NoError(t, err)
+
+	var auditEvent cirrus.AuditEvent
+	require.NoError(t, cirrus.Decode(body, &auditEvent, cirrus.DecodingModeStrict))
+
+	data, err := auditEvent.DecodeData(cirrus.DecodingModeStrict)
+	require.NoError(t, err)
+
+	tokenData, ok := data.(*cirrus.GenerateNewScopedAccessTokenData)
+	require.True(t, ok)
+	require.Equal(t, "GenerateNewScopedAccessToken", *tokenData.Common().MutationName)
+	require.Equal(t, "github", *tokenData.Platform)
+	require.Equal(t, "85709", *tokenData.OwnerUID)
+	require.EqualValues(t, 0, *tokenData.DurationSeconds)
+	require.Equal(t, "READ", *tokenData.Permission)
+	require.Equal(t, []string{"awesome-system-calls"}, tokenData.RepositoryNames)
+}
+
+func TestDecodeAuditEventDataUnknownMutation(t *testing.T) {
+	data := `{"mutationName": "SomeFutureMutation", "buildId": "42", "someField": true}`
+
+	auditEvent := cirrus.AuditEvent{Data: &data}
+
+	decodedData, err := auditEvent.DecodeData(cirrus.DecodingModeStrict)
+	require.NoError(t, err)
+	require.IsType(t, &cirrus.AuditEventDataCommon{}, decodedData)
+	require.Equal(t, "SomeFutureMutation", *decodedData.Common().MutationName)
+	require.Equal(t, "42", *decodedData.Common().BuildID)
+}
+
+func TestDecodeAuditEventDataNoData(t *testing.T) {
+	decodedData, err := (&cirrus.AuditEvent{}).DecodeData(cirrus.DecodingModeLenient)
+	require.NoError(t, err)
+	require.Nil(t, decodedData)
+}
@@ -0,0 +1,54 @@
+package cirrus
+
+type User struct {
+	ID       *int64  `json:"id"`
+	Username *string `json:"username"`
+}
+
+type Build struct {
+	ID                 *int64  `json:"id"`
+	Status             *string `json:"status"`
+	Branch             *string `json:"branch"`
+	PullRequest        *int64  `json:"pullRequest"`
+	PullRequestDraft   *bool   `json:"pullRequestDraft"`
+	ChangeIDInRepo     *string `json:"changeIdInRepo"`
+	ChangeMessageTitle *string `json:"changeMessageTitle"`
+	ChangeTimestamp    *int64  `json:"changeTimestamp"`
+	DurationInSeconds  *int64  `json:"durationInSeconds"`
+	User               User    `json:"user"`
+}
+
+type Notification struct {
+	Level   *string `json:"level"`
+	Message *string `json:"message"`
+	Link    *string `json:"link"`
+}
+
+type Task struct {
+	ID                      *int64         `json:"id"`
+	Name                    *string        `json:"name"`
+	NameAlias               *string        `json:"nameAlias"`
+	Status                  *string        `json:"status"`
+	StatusTimestamp         *int64         `json:"statusTimestamp"`
+	CreationTimestamp       *int64         `json:"creationTimestamp"`
+	DurationInSeconds       *int64         `json:"durationInSeconds"`
+	InstanceType            *string        `json:"instanceType"`
+	UniqueLabels            []string       `json:"uniqueLabels"`
+	ManualRerunCount        *int64         `json:"manualRerunCount"`
+	LocalGroupID            *int64         `json:"localGroupId"`
+	AutomaticReRun          *bool          `json:"automaticReRun"`
+	AutomaticallyReRunnable *bool          `json:"automaticallyReRunnable"`
+	Notifications           []Notification `json:"notifications"`
+}
+
+// BuildOrTask is a payload of the "build" and "task" webhook events.
+type BuildOrTask struct {
+	// OldStatus is the build's or task's status before
+	// the update, only set for the "updated" action.
+	OldStatus *string `json:"old_status"`
+
+	Build Build `json:"build"`
+	Task  Task  `json:"task"`
+
+	Common
+}
@@ -0,0 +1,38 @@
+// Package cirrus models the Cirrus CI webhook event payloads[1].
+//
+// All fields are pointers (or slices) to distinguish
+// the absent values from the zero values.
+//
+// [1]: https://cirrus-ci.org/api/#webhooks
+package cirrus
+
+type Actor struct {
+	ID       *int64  `json:"id"`
+	Username *string `json:"username"`
+}
+
+type Repository struct {
+	ID        *int64  `json:"id"`
+	Owner     *string `json:"owner"`
+	Name      *string `json:"name"`
+	IsPrivate *bool   `json:"isPrivate"`
+}
+
+// Common contains the fields shared by all webhook event payloads.
+type Common struct {
+	Action     *string    `json:"action"`
+	Type       *string    `json:"type"`
+	Timestamp  *int64     `json:"timestamp"`
+	Actor      Actor      `json:"actor"`
+	Repository Repository `json:"repository"`
+}
+
+// RepositoryFullName returns the repository's name in the "owner/name" format,
+// or an empty string if the repository's owner or name are not known.
+func (common *Common) RepositoryFullName() string {
+	if common.Repository.Owner == nil || common.Repository.Name == nil {
+		return ""
+	}
+
+	return *common.Repository.Owner + "/" + *common.Repository.Name
+}
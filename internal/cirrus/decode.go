@@ -0,0 +1,37 @@
+package cirrus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrDecodingFailed = errors.New("failed to decode the webhook event payload")
+
+type DecodingMode int
+
+const (
+	// DecodingModeLenient ignores the fields not present in the model,
+	// which is what we want by default, as Cirrus CI might add new fields
+	// to the webhook event payloads at any time.
+	DecodingModeLenient DecodingMode = iota
+
+	// DecodingModeStrict rejects the payloads with
+	// the fields not present in the model.
+	DecodingModeStrict
+)
+
+func Decode(body []byte, v any, mode DecodingMode) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+
+	if mode == DecodingModeStrict {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrDecodingFailed, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package cirrus_test
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeStrict(t *testing.T) {
+	for name, v := range map[string]any{
+		"audit_event.json": &cirrus.AuditEvent{},
+		"build.json":       &cirrus.BuildOrTask{},
+		"task.json":        &cirrus.BuildOrTask{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", name))
+			require.NoError(t, err)
+
+			require.NoError(t, cirrus.Decode(body, v, cirrus.DecodingModeStrict))
+		})
+	}
+}
+
+func TestDecodeTask(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "task.json"))
+	require.NoError(t, err)
+
+	var buildOrTask cirrus.BuildOrTask
+	require.NoError(t, cirrus.Decode(body, &buildOrTask, cirrus.DecodingModeStrict))
+
+	require.Equal(t, "edigaryev/awesome-system-calls", buildOrTask.RepositoryFullName())
+	require.False(t, *buildOrTask.Repository.IsPrivate)
+	require.Equal(t, "Periodic update (#7)", *buildOrTask.Build.ChangeMessageTitle)
+	require.EqualValues(t, 1722406690000, *buildOrTask.Build.ChangeTimestamp)
+	require.Equal(t, "lint", *buildOrTask.Task.NameAlias)
+	require.EqualValues(t, 1722408865412, *buildOrTask.Task.CreationTimestamp)
+	require.EqualValues(t, 1, *buildOrTask.Task.DurationInSeconds)
+	require.False(t, *buildOrTask.Task.AutomaticReRun)
+	require.Empty(t, buildOrTask.Task.Notifications)
+}
+
+func TestDecodeUnknownFields(t *testing.T) {
+	body := []byte(`{"action": "created", "someNewField": 42}`)
+
+	var buildOrTask cirrus.BuildOrTask
+	require.NoError(t, cirrus.Decode(body, &buildOrTask, cirrus.DecodingModeLenient))
+	require.Equal(t, "created", *buildOrTask.Action)
+
+	require.ErrorIs(t, cirrus.Decode(body, &buildOrTask, cirrus.DecodingModeStrict), cirrus.ErrDecodingFailed)
+}
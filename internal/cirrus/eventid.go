@@ -0,0 +1,34 @@
+package cirrus
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+type eventIdentity struct {
+	ID *string `json:"id"`
+}
+
+// EventID returns the ID of the webhook event that stays the same across
+// the re-deliveries of the event, to let the consumers de-duplicate them.
+//
+// Audit events have a unique ID, for the rest of the events
+// we use a hash of the event type and body.
+func EventID(presentedEventType string, body []byte) (string, error) {
+	var identity eventIdentity
+
+	if err := Decode(body, &identity, DecodingModeLenient); err != nil {
+		return "", err
+	}
+
+	if identity.ID != nil {
+		return *identity.ID, nil
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(presentedEventType))
+	hash.Write([]byte{0})
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,37 @@
+package cirrus
+
+import (
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// EventTime returns the time of the webhook event.
+//
+// The first non-nil timestamp from the body is preferred, since, unlike
+// the "X-Cirrus-Timestamp" header, the body stays the same across the
+// re-deliveries. Otherwise, the header is used, falling back to the
+// current time when the header is missing or malformed.
+func EventTime(header http.Header, logger *zap.SugaredLogger, bodyTimestamps ...*int64) time.Time {
+	for _, timestamp := range bodyTimestamps {
+		if timestamp != nil {
+			return time.UnixMilli(*timestamp)
+		}
+	}
+
+	rawTimestamp := header.Get("X-Cirrus-Timestamp")
+	if rawTimestamp == "" {
+		return time.Now()
+	}
+
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		logger.Warnf("failed to parse \"X-Cirrus-Timestamp\" timestamp value %q: %v",
+			rawTimestamp, err)
+
+		return time.Now()
+	}
+
+	return time.UnixMilli(timestamp)
+}
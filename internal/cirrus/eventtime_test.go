@@ -0,0 +1,28 @@
+package cirrus_test
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEventTime(t *testing.T) {
+	header := http.Header{
+		"X-Cirrus-Timestamp": []string{"1722408869403"},
+	}
+	statusTimestamp := int64(1722408844000)
+
+	// Body timestamps take precedence over the header
+	require.Equal(t, time.UnixMilli(statusTimestamp),
+		cirrus.EventTime(header, zap.S(), nil, &statusTimestamp))
+
+	// Header is used when there are no body timestamps
+	require.Equal(t, time.UnixMilli(1722408869403), cirrus.EventTime(header, zap.S(), nil))
+
+	// Current time is used when the header is malformed
+	header.Set("X-Cirrus-Timestamp", "yesterday")
+	require.WithinDuration(t, time.Now(), cirrus.EventTime(header, zap.S()), time.Second)
+}
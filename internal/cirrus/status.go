@@ -0,0 +1,56 @@
+package cirrus
+
+// IsFinalBuildStatus returns true for the build statuses
+// after which the build won't change anymore.
+func IsFinalBuildStatus(status *string) bool {
+	if status == nil {
+		return false
+	}
+
+	switch *status {
+	case "COMPLETED", "FAILED", "ABORTED", "ERRORED":
+		return true
+	default:
+		return false
+	}
+}
+
+// IsFinalTaskStatus returns true for the task statuses after which the task
+// won't change anymore, unless re-run, in which case a new task is created.
+func IsFinalTaskStatus(status *string) bool {
+	if status == nil {
+		return false
+	}
+
+	switch *status {
+	case "COMPLETED", "FAILED", "ABORTED", "SKIPPED":
+		return true
+	default:
+		return false
+	}
+}
+
+// IsFailedStatus returns true for the build and task statuses indicating a failure.
+func IsFailedStatus(status *string) bool {
+	return status != nil && (*status == "FAILED" || *status == "ERRORED")
+}
+
+// IsNewStatus returns true when the build or task was created or got a new status,
+// and not when some other field was updated, so that each status is handled once.
+//
+// The status is either the build's or the task's status, depending on the event type.
+func (payload *BuildOrTask) IsNewStatus(status *string) bool {
+	if status == nil || payload.Action == nil {
+		return false
+	}
+
+	switch *payload.Action {
+	case "created":
+		return true
+	case "updated":
+		// Assume that the status has changed when we don't know the old one
+		return payload.OldStatus == nil || *payload.OldStatus != *status
+	default:
+		return false
+	}
+}
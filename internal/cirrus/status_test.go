@@ -0,0 +1,37 @@
+package cirrus_test
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func ptr(value string) *string {
+	return &value
+}
+
+func TestIsNewStatus(t *testing.T) {
+	testCases := []struct {
+		name      string
+		action    *string
+		oldStatus *string
+		status    *string
+		expected  bool
+	}{
+		{"created", ptr("created"), nil, ptr("CREATED"), true},
+		{"status changed", ptr("updated"), ptr("EXECUTING"), ptr("COMPLETED"), true},
+		{"other field changed", ptr("updated"), ptr("COMPLETED"), ptr("COMPLETED"), false},
+		{"old status unknown", ptr("updated"), nil, ptr("COMPLETED"), true},
+		{"no status", ptr("created"), nil, nil, false},
+		{"no action", nil, nil, ptr("COMPLETED"), false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			payload := cirrus.BuildOrTask{OldStatus: testCase.oldStatus}
+			payload.Action = testCase.action
+
+			require.Equal(t, testCase.expected, payload.IsNewStatus(testCase.status))
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package cirrus
+
+// ValueOr returns the value the pointer points to,
+// or the fallback if the pointer is nil.
+func ValueOr[T any](value *T, fallback T) T {
+	if value == nil {
+		return fallback
+	}
+
+	return *value
+}
@@ -0,0 +1,175 @@
+// Package cloudevents wraps the Cirrus CI webhook events into CloudEvents 1.0[1].
+//
+// [1]: https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md
+package cloudevents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+var ErrCloudEventsFailed = errors.New("failed to create a CloudEvent")
+
+const (
+	SpecVersion = "1.0"
+
+	// TypePrefix is prepended to the Cirrus CI event type and action
+	// to form the CloudEvent's type, for example, "com.cirrus-ci.task.created".
+	TypePrefix = "com.cirrus-ci."
+
+	// StructuredContentType is the content type of the CloudEvents
+	// in the structured content mode[1].
+	//
+	// [1]: https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/http-protocol-binding.md#32-structured-content-mode
+	StructuredContentType = "application/cloudevents+json"
+)
+
+type Mode string
+
+const (
+	// ModeStructured puts the whole CloudEvent, including its data, into the body.
+	ModeStructured Mode = "structured"
+
+	// ModeBinary puts the CloudEvent's attributes into the "ce-" prefixed
+	// headers and only the CloudEvent's data into the body.
+	ModeBinary Mode = "binary"
+)
+
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+type identity struct {
+	Build cirrus.Build `json:"build"`
+	Task  cirrus.Task  `json:"task"`
+
+	cirrus.Common
+}
+
+// New creates a CloudEvent from the webhook event.
+//
+// The data is the webhook event's body, unless
+// overridden with the non-nil data argument.
+//
+// The time is the webhook event's time as returned by cirrus.EventTime,
+// so that it's the same as the time reported by the other processors.
+func New(
+	header http.Header,
+	presentedEventType string,
+	body []byte,
+	data []byte,
+	logger *zap.SugaredLogger,
+) (*Event, error) {
+	var identity identity
+
+	if err := cirrus.Decode(body, &identity, cirrus.DecodingModeLenient); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCloudEventsFailed, err)
+	}
+
+	if data == nil {
+		data = body
+	}
+
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("%w: data is not a valid JSON", ErrCloudEventsFailed)
+	}
+
+	event := &Event{
+		SpecVersion:     SpecVersion,
+		Source:          "https://cirrus-ci.com",
+		Type:            TypePrefix + presentedEventType,
+		DataContentType: "application/json",
+		Data:            data,
+	}
+
+	if action := identity.Action; action != nil {
+		event.Type += "." + *action
+	}
+
+	if fullName := identity.RepositoryFullName(); fullName != "" {
+		event.Source = "https://cirrus-ci.com/github/" + fullName
+	}
+
+	id, err := cirrus.EventID(presentedEventType, body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCloudEventsFailed, err)
+	}
+
+	event.ID = id
+
+	switch {
+	case identity.Task.ID != nil:
+		event.Subject = fmt.Sprintf("task/%d", *identity.Task.ID)
+	case identity.Build.ID != nil:
+		event.Subject = fmt.Sprintf("build/%d", *identity.Build.ID)
+	}
+
+	event.Time = cirrus.EventTime(header, logger, identity.Timestamp, identity.Task.StatusTimestamp).
+		UTC().Format(time.RFC3339Nano)
+
+	return event, nil
+}
+
+// Attributes returns the CloudEvent's context attributes
+// by their names, as used in the binary content mode.
+func (event *Event) Attributes() map[string]string {
+	attributes := map[string]string{
+		"specversion": event.SpecVersion,
+		"id":          event.ID,
+		"source":      event.Source,
+		"type":        event.Type,
+	}
+
+	if event.Subject != "" {
+		attributes["subject"] = event.Subject
+	}
+
+	if event.Time != "" {
+		attributes["time"] = event.Time
+	}
+
+	return attributes
+}
+
+// Encode encodes the CloudEvent for the HTTP protocol binding[1]
+// and returns the headers to set and the body to send.
+//
+// [1]: https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/http-protocol-binding.md
+func (event *Event) Encode(mode Mode) (http.Header, []byte, error) {
+	header := http.Header{}
+
+	switch mode {
+	case ModeStructured:
+		eventJSON, err := json.Marshal(event)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to marshal the event as JSON: %v",
+				ErrCloudEventsFailed, err)
+		}
+
+		header.Set("Content-Type", StructuredContentType)
+
+		return header, eventJSON, nil
+	case ModeBinary:
+		for name, value := range event.Attributes() {
+			header.Set("ce-"+name, value)
+		}
+
+		header.Set("Content-Type", event.DataContentType)
+
+		return header, event.Data, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported content mode %q", ErrCloudEventsFailed, mode)
+	}
+}
@@ -0,0 +1,113 @@
+package cloudevents_test
+
+import (
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cloudevents"
+	"go.uber.org/zap"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	body, err := os.ReadFile(filepath.Join("..", "cirrus", "testdata", name))
+	require.NoError(t, err)
+
+	return body
+}
+
+func TestTask(t *testing.T) {
+	body := readTestdata(t, "task.json")
+
+	event, err := cloudevents.New(http.Header{
+		"X-Cirrus-Timestamp": []string{"1722408869403"},
+	}, "task", body, nil, zap.S())
+	require.NoError(t, err)
+
+	require.Equal(t, "1.0", event.SpecVersion)
+	require.Equal(t, "com.cirrus-ci.task.created", event.Type)
+	require.Equal(t, "https://cirrus-ci.com/github/edigaryev/awesome-system-calls", event.Source)
+	require.Equal(t, "task/6017965227769856", event.Subject)
+	require.Equal(t, "2024-07-31T06:54:29.403Z", event.Time)
+	require.Len(t, event.ID, 64)
+	require.JSONEq(t, string(body), string(event.Data))
+
+	// ID should be deterministic
+	sameEvent, err := cloudevents.New(http.Header{}, "task", body, nil, zap.S())
+	require.NoError(t, err)
+	require.Equal(t, event.ID, sameEvent.ID)
+
+	// ...but should differ for different event types
+	otherEvent, err := cloudevents.New(http.Header{}, "build", body, nil, zap.S())
+	require.NoError(t, err)
+	require.NotEqual(t, event.ID, otherEvent.ID)
+}
+
+func TestAuditEvent(t *testing.T) {
+	event, err := cloudevents.New(http.Header{}, "audit_event", readTestdata(t, "audit_event.json"), nil, zap.S())
+	require.NoError(t, err)
+
+	require.Equal(t, "bb2bde61-24e6-475c-a8a7-3f03bedcbd61", event.ID)
+	require.Equal(t, "com.cirrus-ci.audit_event.created", event.Type)
+	require.Equal(t, "https://cirrus-ci.com", event.Source)
+	require.Empty(t, event.Subject)
+
+	// The audit event's own timestamp is preferred over the delivery time
+	require.Equal(t, "2024-08-01T13:20:06.287Z", event.Time)
+}
+
+func TestMalformedTimestampHeader(t *testing.T) {
+	// The task's status timestamp is used instead of the header
+	event, err := cloudevents.New(http.Header{
+		"X-Cirrus-Timestamp": []string{"yesterday"},
+	}, "task", readTestdata(t, "task.json"), nil, zap.S())
+	require.NoError(t, err)
+	require.Equal(t, "2024-07-31T06:54:29.403Z", event.Time)
+}
+
+func TestEncode(t *testing.T) {
+	event, err := cloudevents.New(http.Header{
+		"X-Cirrus-Timestamp": []string{"1722408869403"},
+	}, "build", readTestdata(t, "build.json"), []byte(`{"status":"EXECUTING"}`), zap.S())
+	require.NoError(t, err)
+
+	header, body, err := event.Encode(cloudevents.ModeStructured)
+	require.NoError(t, err)
+	require.Equal(t, "application/cloudevents+json", header.Get("Content-Type"))
+
+	var structured map[string]any
+	require.NoError(t, json.Unmarshal(body, &structured))
+	require.Equal(t, "com.cirrus-ci.build.updated", structured["type"])
+	require.Equal(t, "build/5082236150611968", structured["subject"])
+	require.Equal(t, map[string]any{"status": "EXECUTING"}, structured["data"])
+
+	header, body, err = event.Encode(cloudevents.ModeBinary)
+	require.NoError(t, err)
+	require.Equal(t, "application/json", header.Get("Content-Type"))
+	require.Equal(t, "1.0", header.Get("ce-specversion"))
+	require.Equal(t, event.ID, header.Get("ce-id"))
+	require.Equal(t, "com.cirrus-ci.build.updated", header.Get("ce-type"))
+	require.Equal(t, "2024-07-31T06:54:29.403Z", header.Get("ce-time"))
+	require.Equal(t, `{"status":"EXECUTING"}`, string(body))
+
+	_, _, err = event.Encode("unknown")
+	require.ErrorIs(t, err, cloudevents.ErrCloudEventsFailed)
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := cloudevents.ParseFormat("cloudevents-binary")
+	require.NoError(t, err)
+	require.Equal(t, cloudevents.FormatCloudEventsBinary, format)
+
+	mode, ok := format.Mode()
+	require.True(t, ok)
+	require.Equal(t, cloudevents.ModeBinary, mode)
+
+	_, ok = cloudevents.FormatRaw.Mode()
+	require.False(t, ok)
+
+	_, err = cloudevents.ParseFormat("cloudevents")
+	require.ErrorIs(t, err, cloudevents.ErrUnsupportedFormat)
+}
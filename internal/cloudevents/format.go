@@ -0,0 +1,46 @@
+package cloudevents
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// Format is how the processors publishing the webhook events encode them.
+type Format string
+
+const (
+	// FormatRaw is the webhook event's body as is.
+	FormatRaw Format = "raw"
+
+	// FormatCloudEventsStructured is the CloudEvent in the structured content mode.
+	FormatCloudEventsStructured Format = "cloudevents-structured"
+
+	// FormatCloudEventsBinary is the CloudEvent in the binary content mode.
+	FormatCloudEventsBinary Format = "cloudevents-binary"
+)
+
+// ParseFormat validates the format specified by the user.
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case FormatRaw, FormatCloudEventsStructured, FormatCloudEventsBinary:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w %q, please specify either %q, %q or %q", ErrUnsupportedFormat,
+			value, FormatRaw, FormatCloudEventsStructured, FormatCloudEventsBinary)
+	}
+}
+
+// Mode returns the CloudEvents content mode of the format,
+// or false if the format is not a CloudEvents one.
+func (format Format) Mode() (Mode, bool) {
+	switch format {
+	case FormatCloudEventsStructured:
+		return ModeStructured, true
+	case FormatCloudEventsBinary:
+		return ModeBinary, true
+	default:
+		return "", false
+	}
+}
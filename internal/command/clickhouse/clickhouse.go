@@ -0,0 +1,315 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/batch"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//go:embed schema.sql
+var schema string
+
+// maxInsertedEventIDs is how many of the most recently inserted webhook events
+// are remembered to avoid inserting their re-deliveries, which the materialized
+// views would otherwise count twice.
+const maxInsertedEventIDs = 100_000
+
+var clickhouseURL string
+var database string
+var username string
+var password string
+var createSchema bool
+var batchSize int
+var flushInterval time.Duration
+
+var (
+	ErrClickHouseFailed = errors.New("failed to insert Cirrus CI events into ClickHouse")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clickhouse",
+		Short: "Insert Cirrus CI webhook events into ClickHouse",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&clickhouseURL, "url", "",
+		"ClickHouse HTTP interface URL (defaults to the CLICKHOUSE_URL environment variable, "+
+			"or http://127.0.0.1:8123 if it's not set)")
+	cmd.PersistentFlags().StringVar(&database, "database", "default",
+		"database to create the tables in and insert the webhook events into")
+	cmd.PersistentFlags().StringVar(&username, "username", "",
+		"username to authenticate with")
+	cmd.PersistentFlags().StringVar(&password, "password", "",
+		"password to authenticate with (defaults to the CLICKHOUSE_PASSWORD environment variable)")
+	cmd.PersistentFlags().BoolVar(&createSchema, "create-schema", true,
+		"create the tables and materialized views shipped with the tool on startup, unless they exist")
+	cmd.PersistentFlags().IntVar(&batchSize, "batch-size", 1000,
+		"maximum number of the webhook events to insert using a single INSERT query")
+	cmd.PersistentFlags().DurationVar(&flushInterval, "flush-interval", 5*time.Second,
+		"maximum time to wait for more webhook events before sending the INSERT query")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	clickhouseURL = server.SecretFromEnv(clickhouseURL, "CLICKHOUSE_URL")
+
+	if clickhouseURL == "" {
+		clickhouseURL = "http://127.0.0.1:8123"
+	}
+
+	password = server.SecretFromEnv(password, "CLICKHOUSE_PASSWORD")
+
+	if batchSize < 1 {
+		return fmt.Errorf("%w: \"--batch-size\" should be at least 1", ErrClickHouseFailed)
+	}
+
+	processor, err := NewProcessor(clickhouseURL, database, batchSize, flushInterval,
+		WithCredentials(username, password))
+	if err != nil {
+		return err
+	}
+	defer processor.Close()
+
+	if createSchema {
+		if err := processor.CreateSchema(cmd.Context()); err != nil {
+			return err
+		}
+	}
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+type Option func(*Processor)
+
+// WithCredentials authenticates the queries, unless the username is empty.
+func WithCredentials(username string, password string) Option {
+	return func(processor *Processor) {
+		if username != "" {
+			processor.username = username
+			processor.password = password
+		}
+	}
+}
+
+type Processor struct {
+	baseURL  *url.URL
+	database string
+
+	username string
+	password string
+
+	httpClient *http.Client
+
+	insertedEventIDs *lru.Cache[string, struct{}]
+	batcher          *batch.Batcher[*Row]
+}
+
+func NewProcessor(
+	rawURL string,
+	database string,
+	batchSize int,
+	flushInterval time.Duration,
+	opts ...Option,
+) (*Processor, error) {
+	baseURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse URL: %v", ErrClickHouseFailed, err)
+	}
+
+	insertedEventIDs, err := lru.New[string, struct{}](maxInsertedEventIDs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClickHouseFailed, err)
+	}
+
+	processor := &Processor{
+		baseURL:  baseURL,
+		database: database,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		insertedEventIDs: insertedEventIDs,
+	}
+
+	for _, opt := range opts {
+		opt(processor)
+	}
+
+	// ClickHouse is optimized for inserting many rows at once,
+	// so insert the rows of the concurrent webhook events together
+	processor.batcher = batch.New(batchSize, flushInterval, 30*time.Second, processor.insert)
+
+	return processor, nil
+}
+
+// CreateSchema creates the tables and views
+// shipped with the tool, unless they already exist.
+func (processor *Processor) CreateSchema(ctx context.Context) error {
+	// ClickHouse HTTP interface only accepts a single statement per query
+	for _, statement := range splitStatements(schema) {
+		if err := processor.query(ctx, statement, nil); err != nil {
+			return fmt.Errorf("%w: failed to create schema: %v", ErrClickHouseFailed, err)
+		}
+	}
+
+	return nil
+}
+
+// splitStatements splits the SQL script into the statements, which are terminated
+// by a semicolon at the end of a line, so that the semicolons elsewhere, for example,
+// in the comments or string literals, don't split the statements. The comment
+// lines are omitted.
+func splitStatements(script string) []string {
+	var statements []string
+	var lines []string
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmedLine := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmedLine, "--") {
+			continue
+		}
+
+		lines = append(lines, line)
+
+		if strings.HasSuffix(trimmedLine, ";") {
+			statement := strings.TrimSuffix(strings.TrimSpace(strings.Join(lines, "\n")), ";")
+			statements = append(statements, statement)
+			lines = nil
+		}
+	}
+
+	// The last statement is not necessarily terminated
+	if statement := strings.TrimSpace(strings.Join(lines, "\n")); statement != "" {
+		statements = append(statements, statement)
+	}
+
+	return statements
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	row, err := NewRow(ctx.Request().Header, presentedEventType, body, logger)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrClickHouseFailed, err)
+	}
+
+	if err := processor.batcher.Submit(ctx.Request().Context(), row); err != nil {
+		return fmt.Errorf("%w: %v", ErrClickHouseFailed, err)
+	}
+
+	return nil
+}
+
+// Close inserts the pending rows and stops the processor.
+func (processor *Processor) Close() {
+	processor.batcher.Close()
+}
+
+// insert inserts the rows using a single INSERT query, which ClickHouse either
+// accepts or rejects as a whole, skipping the already inserted webhook events.
+func (processor *Processor) insert(ctx context.Context, rows []*Row) []error {
+	errs := make([]error, len(rows))
+
+	setAll := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+
+		return errs
+	}
+
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	eventIDs := map[string]struct{}{}
+
+	for _, row := range rows {
+		if _, ok := eventIDs[row.EventID]; ok || processor.insertedEventIDs.Contains(row.EventID) {
+			continue
+		}
+
+		if err := encoder.Encode(row); err != nil {
+			return setAll(err)
+		}
+
+		eventIDs[row.EventID] = struct{}{}
+	}
+
+	if len(eventIDs) == 0 {
+		return errs
+	}
+
+	if err := processor.query(ctx, "INSERT INTO cirrus_events FORMAT JSONEachRow", &buf); err != nil {
+		return setAll(err)
+	}
+
+	for eventID := range eventIDs {
+		processor.insertedEventIDs.Add(eventID, struct{}{})
+	}
+
+	return errs
+}
+
+// query runs the query using the HTTP interface, with
+// the body, if any, being the query's data (for example,
+// the rows to insert).
+func (processor *Processor) query(ctx context.Context, query string, body io.Reader) error {
+	queryURL := *processor.baseURL
+
+	values := queryURL.Query()
+	values.Set("database", processor.database)
+
+	if body == nil {
+		body = strings.NewReader(query)
+	} else {
+		values.Set("query", query)
+	}
+
+	queryURL.RawQuery = values.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, queryURL.String(), body)
+	if err != nil {
+		return err
+	}
+
+	if processor.username != "" {
+		request.Header.Set("X-ClickHouse-User", processor.username)
+		request.Header.Set("X-ClickHouse-Key", processor.password)
+	}
+
+	resp, err := processor.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+
+		return fmt.Errorf("query failed with HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(responseBody))
+	}
+
+	return nil
+}
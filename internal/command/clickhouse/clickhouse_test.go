@@ -0,0 +1,251 @@
+package clickhouse_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/clickhouse"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClickHouse struct {
+	statements []string
+	inserts    [][]map[string]any
+	mtx        sync.Mutex
+}
+
+func newFakeClickHouse(t *testing.T) (*fakeClickHouse, string) {
+	fake := &fakeClickHouse{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fake.mtx.Lock()
+		defer fake.mtx.Unlock()
+
+		require.Equal(t, http.MethodPost, request.Method)
+		require.Equal(t, "cirrus", request.URL.Query().Get("database"))
+		require.Equal(t, "user", request.Header.Get("X-ClickHouse-User"))
+		require.Equal(t, "pass", request.Header.Get("X-ClickHouse-Key"))
+
+		query := request.URL.Query().Get("query")
+		if query == "" {
+			statement, err := io.ReadAll(request.Body)
+			require.NoError(t, err)
+
+			fake.statements = append(fake.statements, string(statement))
+
+			return
+		}
+
+		require.Equal(t, "INSERT INTO cirrus_events FORMAT JSONEachRow", query)
+
+		var rows []map[string]any
+
+		scanner := bufio.NewScanner(request.Body)
+		scanner.Buffer(nil, 1024*1024)
+
+		for scanner.Scan() {
+			var row map[string]any
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+
+			rows = append(rows, row)
+		}
+
+		require.NoError(t, scanner.Err())
+
+		fake.inserts = append(fake.inserts, rows)
+	}))
+	t.Cleanup(server.Close)
+
+	return fake, server.URL
+}
+
+func TestCreateSchema(t *testing.T) {
+	fake, url := newFakeClickHouse(t)
+
+	processor, err := clickhouse.NewProcessor(url, "cirrus", 100, time.Millisecond,
+		clickhouse.WithCredentials("user", "pass"))
+	require.NoError(t, err)
+	defer processor.Close()
+
+	require.NoError(t, processor.CreateSchema(context.Background()))
+
+	require.Len(t, fake.statements, 3)
+	require.Contains(t, fake.statements[0], "CREATE TABLE IF NOT EXISTS cirrus_events")
+	require.Contains(t, fake.statements[1], "CREATE TABLE IF NOT EXISTS cirrus_task_durations_daily")
+	require.Contains(t, fake.statements[2], "CREATE MATERIALIZED VIEW IF NOT EXISTS cirrus_task_durations_daily_mv")
+
+	for _, statement := range fake.statements {
+		require.NotContains(t, statement, ";")
+		require.NotContains(t, statement, "--")
+	}
+}
+
+func TestInsert(t *testing.T) {
+	fake, url := newFakeClickHouse(t)
+
+	// The flush interval is long enough for the rows to be only inserted once there's 3 of them
+	processor, err := clickhouse.NewProcessor(url, "cirrus", 3, time.Hour,
+		clickhouse.WithCredentials("user", "pass"))
+	require.NoError(t, err)
+	defer processor.Close()
+
+	var wg sync.WaitGroup
+
+	for eventType, name := range map[string]string{
+		"audit_event": "audit_event.json",
+		"build":       "build.json",
+		"task":        "task.json",
+	} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, eventType, name)
+		}()
+	}
+
+	wg.Wait()
+
+	require.Len(t, fake.inserts, 1)
+	require.Len(t, fake.inserts[0], 3)
+
+	rows := map[string]map[string]any{}
+
+	for _, row := range fake.inserts[0] {
+		rows[row["event_type"].(string)] = row
+	}
+
+	task := rows["task"]
+	require.Equal(t, "created", task["action"])
+	require.Equal(t, "2024-07-31 06:54:29.403", task["timestamp"])
+	require.Equal(t, "edigaryev", task["repository_owner"])
+	require.Equal(t, "EXECUTING", task["task_status"])
+	require.Equal(t, "CommunityContainer", task["task_instance_type"])
+	require.Equal(t, "2024-07-31 06:54:25.412", task["task_creation_timestamp"])
+	require.NotContains(t, task, "old_status")
+
+	build := rows["build"]
+	require.Equal(t, "COMPLETED", build["old_status"])
+	require.NotContains(t, build, "task_id")
+
+	auditEvent := rows["audit_event"]
+	require.Equal(t, "bb2bde61-24e6-475c-a8a7-3f03bedcbd61", auditEvent["event_id"])
+	require.Equal(t, "graphql.mutation", auditEvent["audit_event_type"])
+	require.Equal(t, "2024-08-01 13:20:06.287", auditEvent["timestamp"])
+	require.NotContains(t, auditEvent, "repository_id")
+}
+
+func TestInsertSkipsReDeliveries(t *testing.T) {
+	fake, url := newFakeClickHouse(t)
+
+	processor, err := clickhouse.NewProcessor(url, "cirrus", 2, time.Hour,
+		clickhouse.WithCredentials("user", "pass"))
+	require.NoError(t, err)
+	defer processor.Close()
+
+	var wg sync.WaitGroup
+
+	// Re-delivery in the same batch
+	for range 2 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "task", "task.json")
+		}()
+	}
+
+	wg.Wait()
+
+	require.Len(t, fake.inserts, 1)
+	require.Len(t, fake.inserts[0], 1)
+
+	// Re-delivery in another batch, along with a new event
+	for eventType, name := range map[string]string{
+		"task":  "task.json",
+		"build": "build.json",
+	} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, eventType, name)
+		}()
+	}
+
+	wg.Wait()
+
+	require.Len(t, fake.inserts, 2)
+	require.Len(t, fake.inserts[1], 1)
+	require.Equal(t, "build", fake.inserts[1][0]["event_type"])
+}
+
+// TestIntegration runs against the ClickHouse specified in the
+// CWS_TEST_CLICKHOUSE_URL environment variable, using a new database.
+func TestIntegration(t *testing.T) {
+	clickhouseURL := os.Getenv("CWS_TEST_CLICKHOUSE_URL")
+	if clickhouseURL == "" {
+		t.Skip("CWS_TEST_CLICKHOUSE_URL is not set")
+	}
+
+	database := fmt.Sprintf("cws_test_%d", time.Now().UnixNano())
+
+	query := func(query string) string {
+		resp, err := http.Post(clickhouseURL, "text/plain", strings.NewReader(query))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		responseBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(responseBody))
+
+		return strings.TrimSpace(string(responseBody))
+	}
+
+	query("CREATE DATABASE " + database)
+	t.Cleanup(func() {
+		query("DROP DATABASE " + database)
+	})
+
+	processor, err := clickhouse.NewProcessor(clickhouseURL, database, 100, time.Millisecond)
+	require.NoError(t, err)
+	defer processor.Close()
+
+	require.NoError(t, processor.CreateSchema(context.Background()))
+
+	// Creating the schema again is a no-op
+	require.NoError(t, processor.CreateSchema(context.Background()))
+
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "build", "build.json")
+	body := testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "task", "task.json")
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "audit_event", "audit_event.json")
+
+	// Only the completed tasks end up in the per-day task duration percentiles
+	completedTask := strings.Replace(string(body), `"status": "EXECUTING",
+    "statusTimestamp"`, `"status": "COMPLETED",
+    "statusTimestamp"`, 1)
+	require.NotEqual(t, string(body), completedTask)
+
+	// Re-deliveries are not counted twice
+	for range 2 {
+		testutil.MustDeliver(t, processor.ProcessWebhookEvent, "task", []byte(completedTask))
+	}
+
+	require.Equal(t, "4", query("SELECT count() FROM "+database+".cirrus_events"))
+	require.Equal(t, "Lint (cargo fmt)\t1\t1", query("SELECT task_name, sum(tasks), "+
+		"quantilesMerge(0.5, 0.9, 0.99)(duration_quantiles)[1] "+
+		"FROM "+database+".cirrus_task_durations_daily GROUP BY task_name"))
+}
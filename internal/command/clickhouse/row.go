@@ -0,0 +1,129 @@
+package clickhouse
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// dateTime64Layout is the format ClickHouse parses
+// the DateTime64(3) values from by default.
+const dateTime64Layout = "2006-01-02 15:04:05.000"
+
+// Row is a row of the "cirrus_events" table in the JSONEachRow format.
+//
+// The fields absent in the webhook event are omitted,
+// so that ClickHouse fills them with the columns' defaults.
+type Row struct {
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	Action    string `json:"action,omitempty"`
+	Timestamp string `json:"timestamp"`
+
+	RepositoryID    *int64  `json:"repository_id,omitempty"`
+	RepositoryOwner *string `json:"repository_owner,omitempty"`
+	RepositoryName  *string `json:"repository_name,omitempty"`
+
+	BuildID              *int64  `json:"build_id,omitempty"`
+	BuildStatus          *string `json:"build_status,omitempty"`
+	BuildBranch          *string `json:"build_branch,omitempty"`
+	BuildChangeIDInRepo  *string `json:"build_change_id_in_repo,omitempty"`
+	BuildPullRequest     *int64  `json:"build_pull_request,omitempty"`
+	BuildDurationSeconds *int64  `json:"build_duration_seconds,omitempty"`
+	BuildUserUsername    *string `json:"build_user_username,omitempty"`
+
+	TaskID                *int64  `json:"task_id,omitempty"`
+	TaskName              *string `json:"task_name,omitempty"`
+	TaskStatus            *string `json:"task_status,omitempty"`
+	TaskInstanceType      *string `json:"task_instance_type,omitempty"`
+	TaskStatusTimestamp   string  `json:"task_status_timestamp,omitempty"`
+	TaskCreationTimestamp string  `json:"task_creation_timestamp,omitempty"`
+	TaskDurationSeconds   *int64  `json:"task_duration_seconds,omitempty"`
+	TaskManualRerunCount  *int64  `json:"task_manual_rerun_count,omitempty"`
+	TaskAutomaticRerun    *bool   `json:"task_automatic_rerun,omitempty"`
+
+	OldStatus *string `json:"old_status,omitempty"`
+
+	AuditEventType *string `json:"audit_event_type,omitempty"`
+	ActorUsername  *string `json:"actor_username,omitempty"`
+
+	Body string `json:"body"`
+}
+
+// NewRow creates a "cirrus_events" table row for the webhook event.
+//
+// The row's timestamp is taken from the body, which, unlike the "X-Cirrus-Timestamp"
+// header, stays the same across the re-deliveries, so that the re-delivered
+// events end up in the same partition.
+func NewRow(header http.Header, presentedEventType string, body []byte, logger *zap.SugaredLogger) (*Row, error) {
+	// A superset of the build, task and audit event payloads
+	var payload struct {
+		OldStatus *string `json:"old_status"`
+
+		cirrus.AuditEvent
+	}
+
+	if err := cirrus.Decode(body, &payload, cirrus.DecodingModeLenient); err != nil {
+		return nil, err
+	}
+
+	eventID, err := cirrus.EventID(presentedEventType, body)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := cirrus.EventTime(header, logger, payload.Timestamp, payload.Task.StatusTimestamp)
+
+	row := &Row{
+		EventID:   eventID,
+		EventType: presentedEventType,
+		Timestamp: timestamp.UTC().Format(dateTime64Layout),
+
+		RepositoryID:    payload.Repository.ID,
+		RepositoryOwner: payload.Repository.Owner,
+		RepositoryName:  payload.Repository.Name,
+
+		BuildID:              payload.Build.ID,
+		BuildStatus:          payload.Build.Status,
+		BuildBranch:          payload.Build.Branch,
+		BuildChangeIDInRepo:  payload.Build.ChangeIDInRepo,
+		BuildPullRequest:     payload.Build.PullRequest,
+		BuildDurationSeconds: payload.Build.DurationInSeconds,
+		BuildUserUsername:    payload.Build.User.Username,
+
+		TaskID:                payload.Task.ID,
+		TaskName:              payload.Task.Name,
+		TaskStatus:            payload.Task.Status,
+		TaskInstanceType:      payload.Task.InstanceType,
+		TaskStatusTimestamp:   formatTimestamp(payload.Task.StatusTimestamp),
+		TaskCreationTimestamp: formatTimestamp(payload.Task.CreationTimestamp),
+		TaskDurationSeconds:   payload.Task.DurationInSeconds,
+		TaskManualRerunCount:  payload.Task.ManualRerunCount,
+		TaskAutomaticRerun:    payload.Task.AutomaticReRun,
+
+		OldStatus: payload.OldStatus,
+
+		Body: string(body),
+	}
+
+	if payload.Action != nil {
+		row.Action = *payload.Action
+	}
+
+	// Audit events use the "type" field for their own type
+	if presentedEventType == "audit_event" {
+		row.AuditEventType = payload.Type
+		row.ActorUsername = payload.Actor.Username
+	}
+
+	return row, nil
+}
+
+func formatTimestamp(timestamp *int64) string {
+	if timestamp == nil {
+		return ""
+	}
+
+	return time.UnixMilli(*timestamp).UTC().Format(dateTime64Layout)
+}
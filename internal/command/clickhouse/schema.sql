@@ -0,0 +1,74 @@
+-- All the webhook events, one row per event. Re-deliveries of the same
+-- event are eventually collapsed by the ReplacingMergeTree engine,
+-- use the FINAL modifier when the exact numbers are needed.
+CREATE TABLE IF NOT EXISTS cirrus_events
+(
+    event_id                String,
+    event_type              LowCardinality(String),
+    action                  LowCardinality(String),
+    timestamp               DateTime64(3, 'UTC'),
+
+    repository_id           UInt64,
+    repository_owner        LowCardinality(String),
+    repository_name         String,
+
+    build_id                UInt64,
+    build_status            LowCardinality(String),
+    build_branch            String,
+    build_change_id_in_repo String,
+    build_pull_request      UInt64,
+    build_duration_seconds  UInt32,
+    build_user_username     String,
+
+    task_id                 UInt64,
+    task_name               String,
+    task_status             LowCardinality(String),
+    task_instance_type      LowCardinality(String),
+    task_status_timestamp   DateTime64(3, 'UTC'),
+    task_creation_timestamp DateTime64(3, 'UTC'),
+    task_duration_seconds   UInt32,
+    task_manual_rerun_count UInt32,
+    task_automatic_rerun    Bool,
+
+    old_status              LowCardinality(String),
+
+    audit_event_type        LowCardinality(String),
+    actor_username          String,
+
+    body                    String CODEC(ZSTD)
+)
+ENGINE = ReplacingMergeTree
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (repository_owner, repository_name, event_type, event_id);
+
+-- Per-day task duration percentiles of the completed tasks,
+-- query them using quantilesMerge(0.5, 0.9, 0.99)(duration_quantiles).
+CREATE TABLE IF NOT EXISTS cirrus_task_durations_daily
+(
+    day                Date,
+    repository_owner   LowCardinality(String),
+    repository_name    String,
+    task_name          String,
+    instance_type      LowCardinality(String),
+    duration_quantiles AggregateFunction(quantiles(0.5, 0.9, 0.99), UInt32),
+    tasks              SimpleAggregateFunction(sum, UInt64)
+)
+ENGINE = AggregatingMergeTree
+PARTITION BY toYYYYMM(day)
+ORDER BY (repository_owner, repository_name, task_name, instance_type, day);
+
+-- The materialized view only sees the inserted rows, so it relies on the
+-- processor to not insert the re-delivered webhook events it already inserted.
+CREATE MATERIALIZED VIEW IF NOT EXISTS cirrus_task_durations_daily_mv TO cirrus_task_durations_daily AS
+SELECT toDate(timestamp)                                     AS day,
+       repository_owner,
+       repository_name,
+       task_name,
+       task_instance_type                                    AS instance_type,
+       quantilesState(0.5, 0.9, 0.99)(task_duration_seconds) AS duration_quantiles,
+       toUInt64(count())                                     AS tasks
+FROM cirrus_events
+WHERE event_type = 'task'
+  AND task_status = 'COMPLETED'
+  AND old_status != task_status
+GROUP BY day, repository_owner, repository_name, task_name, instance_type;
@@ -1,26 +1,78 @@
 package datadog
 
 import (
-	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
 	payloadpkg "github.com/cirruslabs/cirrus-webhooks-server/internal/command/datadog/payload"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/decoding"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/tagpolicy"
 	"github.com/labstack/echo/v4"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"os"
+	"sync"
 	"time"
 )
 
 var dogstatsdAddr string
 var apiKey string
 var apiSite string
+var service string
+var env string
+var version string
+var hostname string
+var globalTags []string
+var staleEventPolicy string
+var includeRawBody bool
 
 var (
 	ErrDatadogFailed = errors.New("failed to stream Cirrus CI events to Datadog")
 )
 
+type StaleEventPolicy string
+
+const (
+	// StaleEventPolicyWarn submits stale events as is and only logs a warning.
+	StaleEventPolicyWarn StaleEventPolicy = "warn"
+
+	// StaleEventPolicyRestamp replaces the stale event's timestamp with the time
+	// the event was received, preserving the original timestamp as an attribute.
+	StaleEventPolicyRestamp StaleEventPolicy = "restamp"
+)
+
+// Datadog silently discards log events submitted with a
+// timestamp that is more than 18 hours in the past, sigh.
+//
+// [1]: https://docs.datadoghq.com/api/latest/logs/#send-logs
+const staleEventThreshold = 18 * time.Hour
+
+// staleEvents counts the stale events received, by event type.
+//
+//nolint:gochecknoglobals
+var staleEvents = expvar.NewMap("datadog_stale_events")
+
+// unknownEvents counts the events of types unknown to us, by event type.
+//
+// The event type comes from the "X-Cirrus-Event" header, which is not covered
+// by the signature, so only the first maxUnknownEventTypes event types are
+// counted separately, and the rest are counted under otherUnknownEventType.
+//
+//nolint:gochecknoglobals
+var (
+	unknownEvents          = expvar.NewMap("datadog_unknown_events")
+	unknownEventTypesCount int
+	unknownEventTypesMtx   sync.Mutex
+)
+
+const (
+	maxUnknownEventTypes  = 16
+	otherUnknownEventType = "other"
+)
+
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "datadog",
@@ -29,6 +81,8 @@ func NewCommand() *cobra.Command {
 	}
 
 	server.AppendFlags(cmd)
+	tagpolicy.AppendFlags(cmd)
+	decoding.AppendFlags(cmd)
 
 	cmd.PersistentFlags().StringVar(&dogstatsdAddr, "dogstatsd-addr", "",
 		"enables sending webhook events as Datadog events via the DogStatsD protocol to the specified address "+
@@ -37,6 +91,22 @@ func NewCommand() *cobra.Command {
 		"enables sending webhook events as Datadog logs via the Datadog API using the specified API key")
 	cmd.PersistentFlags().StringVar(&apiSite, "api-site", "datadoghq.com",
 		"specifies the Datadog site to use when sending webhook events as Datadog logs via the Datadog API")
+	cmd.PersistentFlags().StringVar(&service, "service", os.Getenv("DD_SERVICE"),
+		"service name to attach to each event as a \"service\" tag (defaults to the DD_SERVICE environment variable)")
+	cmd.PersistentFlags().StringVar(&env, "env", os.Getenv("DD_ENV"),
+		"environment name to attach to each event as an \"env\" tag (defaults to the DD_ENV environment variable)")
+	cmd.PersistentFlags().StringVar(&version, "dd-version", os.Getenv("DD_VERSION"),
+		"version to attach to each event as a \"version\" tag (defaults to the DD_VERSION environment variable)")
+	cmd.PersistentFlags().StringVar(&hostname, "hostname", os.Getenv("DD_HOSTNAME"),
+		"hostname to attach to each event (defaults to the DD_HOSTNAME environment variable)")
+	cmd.PersistentFlags().StringSliceVar(&globalTags, "global-tags", datadogsender.ParseTags(os.Getenv("DD_TAGS")),
+		"comma-separated list of tags to attach to each event (defaults to the DD_TAGS environment variable)")
+	cmd.PersistentFlags().BoolVar(&includeRawBody, "include-raw-body", false,
+		"include the raw webhook event's body in the event's message in addition to the short summary "+
+			"(DogStatsD events always contain the raw body)")
+	cmd.PersistentFlags().StringVar(&staleEventPolicy, "stale-event-policy", string(StaleEventPolicyWarn),
+		"what to do with the events that are more than 18 hours old and will be otherwise discarded by Datadog: "+
+			"\"warn\" to only log a warning or \"restamp\" to replace the event's timestamp with the time it was received")
 
 	return cmd
 }
@@ -46,11 +116,19 @@ func run(cmd *cobra.Command, _ []string) error {
 	var sender datadogsender.Sender
 	var err error
 
+	serviceTags := datadogsender.ServiceTags{
+		Service:  service,
+		Env:      env,
+		Version:  version,
+		Hostname: hostname,
+		Tags:     globalTags,
+	}
+
 	switch {
 	case dogstatsdAddr != "":
-		sender, err = datadogsender.NewDogstatsdSender(dogstatsdAddr)
+		sender, err = datadogsender.NewDogstatsdSender(dogstatsdAddr, serviceTags)
 	case apiKey != "":
-		sender, err = datadogsender.NewAPISender(apiKey, apiSite)
+		sender, err = datadogsender.NewAPISender(apiKey, apiSite, serviceTags)
 	default:
 		return fmt.Errorf("%w: no sender configured, please specify either --api-key or --dogstatsd-addr",
 			ErrDatadogFailed)
@@ -60,8 +138,22 @@ func run(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
+	switch StaleEventPolicy(staleEventPolicy) {
+	case StaleEventPolicyWarn, StaleEventPolicyRestamp:
+		// nothing to validate
+	default:
+		return fmt.Errorf("%w: unsupported stale event policy %q, please specify either %q or %q",
+			ErrDatadogFailed, staleEventPolicy, StaleEventPolicyWarn, StaleEventPolicyRestamp)
+	}
+
+	// Initialize a tag policy
+	tagPolicy, err := tagpolicy.New()
+	if err != nil {
+		return err
+	}
+
 	return server.New(func(ctx echo.Context, presentedEventType string, body []byte, logger *zap.SugaredLogger) error {
-		return processWebhookEvent(ctx, presentedEventType, body, sender, logger)
+		return processWebhookEvent(ctx, presentedEventType, body, sender, tagPolicy, logger)
 	}, zap.S()).Run(cmd.Context())
 }
 
@@ -70,41 +162,69 @@ func processWebhookEvent(
 	presentedEventType string,
 	body []byte,
 	sender datadogsender.Sender,
+	tagPolicy *tagpolicy.Policy,
 	logger *zap.SugaredLogger,
 ) error {
 	// Decode the event
-	var payload payloadpkg.Payload
+	payload, known := payloadpkg.New(presentedEventType)
+	decodingMode := decoding.Mode()
 
-	switch presentedEventType {
-	case "audit_event":
-		payload = &payloadpkg.AuditEvent{}
-	case "build", "task":
-		payload = &payloadpkg.BuildOrTask{}
-	default:
-		return nil
+	if !known {
+		if countUnknownEvent(presentedEventType) {
+			logger.Warnf("received an event of type %q that is unknown to us, "+
+				"forwarding it with only the common fields enriched", presentedEventType)
+		}
+
+		// Strict decoding makes no sense here as we
+		// only know about the fields common to all payloads
+		decodingMode = cirrus.DecodingModeLenient
 	}
 
-	if err := json.Unmarshal(body, payload); err != nil {
+	if err := cirrus.Decode(body, payload, decodingMode); err != nil {
 		return fmt.Errorf("failed to enrich Datadog event with tags: "+
 			"failed to parse the webhook event of type %q as JSON: %v", presentedEventType, err)
 	}
 
+	attributes, err := payloadpkg.Attributes(body)
+	if err != nil {
+		return fmt.Errorf("failed to enrich Datadog event with attributes: "+
+			"failed to parse the webhook event of type %q as JSON: %v", presentedEventType, err)
+	}
+
 	// Create a new Datadog event and enrich it with tags
 	evt := &datadogsender.Event{
-		Title: "Webhook event",
-		Text:  string(body),
-		Tags:  []string{fmt.Sprintf("webhook_event_type:%s", presentedEventType)},
+		Title:      "Webhook event",
+		Text:       payload.Summary(),
+		Tags:       []string{fmt.Sprintf("webhook_event_type:%s", presentedEventType)},
+		Attributes: attributes,
+	}
+
+	if _, ok := sender.(*datadogsender.DogstatsdSender); ok {
+		// DogStatsD events don't support structured attributes,
+		// so keep the raw body as the event's text
+		evt.Text = string(body)
+	} else if includeRawBody {
+		evt.Text += "\n\n" + string(body)
 	}
 
 	payload.Enrich(ctx.Request().Header, evt, logger)
 
-	// Datadog silently discards log events submitted with a
-	// timestamp that is more than 18 hours in the past, sigh.
-	//
-	// [1]: https://docs.datadoghq.com/api/latest/logs/#send-logs
-	if !evt.Timestamp.IsZero() && time.Since(evt.Timestamp) >= 18*time.Hour {
-		logger.Warnf("submitting an event of type %q with a timestamp that is more than "+
-			"18 hours in the past, it'll likely going to be discarded", presentedEventType)
+	evt.Tags = tagPolicy.Apply(evt.Tags)
+
+	if !evt.Timestamp.IsZero() && time.Since(evt.Timestamp) >= staleEventThreshold {
+		staleEvents.Add(presentedEventType, 1)
+
+		switch StaleEventPolicy(staleEventPolicy) {
+		case StaleEventPolicyRestamp:
+			logger.Infof("re-stamping an event of type %q with a timestamp that is more than "+
+				"18 hours in the past with the time it was received", presentedEventType)
+
+			evt.OriginalTimestamp = evt.Timestamp
+			evt.Timestamp = time.Now()
+		default:
+			logger.Warnf("submitting an event of type %q with a timestamp that is more than "+
+				"18 hours in the past, it'll likely going to be discarded", presentedEventType)
+		}
 	}
 
 	// Log this event to Datadog
@@ -114,3 +234,27 @@ func processWebhookEvent(
 
 	return nil
 }
+
+// countUnknownEvent increments the unknownEvents counter and returns
+// true when the event type is seen for the first time.
+func countUnknownEvent(presentedEventType string) bool {
+	unknownEventTypesMtx.Lock()
+	defer unknownEventTypesMtx.Unlock()
+
+	if unknownEvents.Get(presentedEventType) != nil {
+		unknownEvents.Add(presentedEventType, 1)
+
+		return false
+	}
+
+	if unknownEventTypesCount >= maxUnknownEventTypes {
+		unknownEvents.Add(otherUnknownEventType, 1)
+
+		return false
+	}
+
+	unknownEventTypesCount++
+	unknownEvents.Add(presentedEventType, 1)
+
+	return true
+}
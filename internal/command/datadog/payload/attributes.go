@@ -0,0 +1,40 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Attributes decodes the webhook event's body into nested attributes suitable
+// for Datadog facets, for example, "cirrus.build.id" or "cirrus.task.durationInSeconds".
+//
+// Numbers are preserved as is to avoid losing the precision of the 64-bit IDs.
+//
+// The audit event's "data" field, which is a JSON-encoded string,
+// is decoded too, for example, into "cirrus.data.repositoryNames".
+func Attributes(body []byte) (map[string]interface{}, error) {
+	var decoded map[string]interface{}
+
+	if err := decodeUsingNumber(body, &decoded); err != nil {
+		return nil, err
+	}
+
+	if data, ok := decoded["data"].(string); ok {
+		var decodedData map[string]interface{}
+
+		if err := decodeUsingNumber([]byte(data), &decodedData); err == nil {
+			decoded["data"] = decodedData
+		}
+	}
+
+	return map[string]interface{}{
+		"cirrus": decoded,
+	}, nil
+}
+
+func decodeUsingNumber(body []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	return decoder.Decode(v)
+}
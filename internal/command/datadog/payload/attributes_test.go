@@ -0,0 +1,44 @@
+package payload_test
+
+import (
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/datadog/payload"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttributes(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("..", "..", "..", "cirrus", "testdata", "task.json"))
+	require.NoError(t, err)
+
+	attributes, err := payload.Attributes(body)
+	require.NoError(t, err)
+
+	cirrus := attributes["cirrus"].(map[string]interface{})
+	build := cirrus["build"].(map[string]interface{})
+	task := cirrus["task"].(map[string]interface{})
+
+	require.Equal(t, json.Number("5082236150611968"), build["id"])
+	require.Equal(t, json.Number("1"), task["durationInSeconds"])
+
+	// Make sure that the attributes are serialized without a loss of precision
+	attributesJSON, err := json.Marshal(attributes)
+	require.NoError(t, err)
+	require.Contains(t, string(attributesJSON), `"id":5082236150611968`)
+}
+
+func TestAttributesAuditEvent(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("..", "..", "..", "cirrus", "testdata", "audit_event.json"))
+	require.NoError(t, err)
+
+	attributes, err := payload.Attributes(body)
+	require.NoError(t, err)
+
+	cirrus := attributes["cirrus"].(map[string]interface{})
+	data := cirrus["data"].(map[string]interface{})
+
+	require.Equal(t, "GenerateNewScopedAccessToken", data["mutationName"])
+	require.Equal(t, []interface{}{"awesome-system-calls"}, data["repositoryNames"])
+}
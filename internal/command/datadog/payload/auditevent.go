@@ -1,39 +1,26 @@
 package payload
 
 import (
-	"encoding/json"
 	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/decoding"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
 	"go.uber.org/zap"
 	"net/http"
 )
 
 type AuditEvent struct {
-	Data *string `json:"data"`
-
-	Actor struct {
-		Username *string `json:"username"`
-	} `json:"actor"`
-
-	ActorLocationIP *string `json:"actorLocationIp"`
-
-	common
+	cirrus.AuditEvent
 }
 
 func (auditEvent AuditEvent) Enrich(header http.Header, evt *datadogsender.Event, logger *zap.SugaredLogger) {
-	auditEvent.common.Enrich(header, evt, logger)
-
-	if data := auditEvent.Data; data != nil {
-		var auditEventData auditEventData
-
-		if err := json.Unmarshal([]byte(*data), &auditEventData); err != nil {
-			logger.Warnf("failed to unmarshal audit event's data: %v", err)
+	// The audit events were never tagged with the "actor_id", as opposed to
+	// the build and task events, so keep it that way to avoid changing the tags
+	// that the existing Datadog monitors and dashboards might depend on
+	common := auditEvent.Common
+	common.Actor.ID = nil
 
-			return
-		} else {
-			auditEventData.Enrich(header, evt, logger)
-		}
-	}
+	enrichCommon(&common, header, evt, logger)
 
 	actorUsername := "api"
 	if value := auditEvent.Actor.Username; value != nil {
@@ -44,4 +31,18 @@ func (auditEvent AuditEvent) Enrich(header http.Header, evt *datadogsender.Event
 	if value := auditEvent.ActorLocationIP; value != nil {
 		evt.Tags = append(evt.Tags, fmt.Sprintf("actor_location_ip:%s", *value))
 	}
+
+	// Decode the data last, so that the tags above
+	// are attached even if the data can't be decoded
+	auditEventData, err := auditEvent.DecodeData(decoding.Mode())
+	if err != nil {
+		logger.Warnf("failed to unmarshal audit event's data: %v", err)
+	} else if auditEventData != nil {
+		enrichAuditEventData(auditEventData, evt)
+	}
+}
+
+func (auditEvent AuditEvent) Summary() string {
+	return fmt.Sprintf("Audit event %q was %s by %s", cirrus.ValueOr(auditEvent.Type, "unknown"),
+		cirrus.ValueOr(auditEvent.Action, "created"), cirrus.ValueOr(auditEvent.Actor.Username, "api"))
 }
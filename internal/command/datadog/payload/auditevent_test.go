@@ -3,7 +3,9 @@ package payload_test
 import (
 	"encoding/json"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/datadog/payload"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/decoding"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"net/http"
@@ -15,7 +17,7 @@ import (
 )
 
 func TestEnrichAuditEvent(t *testing.T) {
-	body, err := os.ReadFile(filepath.Join("testdata", "audit_event.json"))
+	body, err := os.ReadFile(filepath.Join("..", "..", "..", "cirrus", "testdata", "audit_event.json"))
 	require.NoError(t, err)
 
 	evt := &datadogsender.Event{}
@@ -29,7 +31,43 @@ func TestEnrichAuditEvent(t *testing.T) {
 	require.Equal(t, []string{
 		"action:created",
 		"type:graphql.mutation",
+		"actor_username:edigaryev",
+		"actor_location_ip:1.2.3.4",
 		"data.mutationName:GenerateNewScopedAccessToken",
+		"data.platform:github",
+		"data.ownerUid:85709",
+		"data.permission:READ",
+		"data.durationSeconds:0",
+		"data.repositoryName:awesome-system-calls",
+	}, evt.Tags)
+	require.Equal(t, "Audit event \"graphql.mutation\" was created by edigaryev", payload.Summary())
+}
+
+func TestEnrichAuditEventWithUnknownDataFields(t *testing.T) {
+	// Enable strict decoding
+	cmd := &cobra.Command{}
+	decoding.AppendFlags(cmd)
+	require.NoError(t, cmd.Flags().Set("strict-decoding", "true"))
+	t.Cleanup(func() {
+		require.NoError(t, cmd.Flags().Set("strict-decoding", "false"))
+	})
+
+	payload := payload.AuditEvent{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "type": "graphql.mutation",
+  "data": "{\"mutationName\": \"GenerateNewScopedAccessToken\", \"newField\": true}",
+  "actor": {"username": "edigaryev"},
+  "actorLocationIp": "1.2.3.4",
+  "action": "created"
+}`), &payload))
+
+	evt := &datadogsender.Event{}
+	payload.Enrich(http.Header{}, evt, zap.S())
+
+	// The data can't be decoded, but the actor's tags are still there
+	require.Equal(t, []string{
+		"action:created",
+		"type:graphql.mutation",
 		"actor_username:edigaryev",
 		"actor_location_ip:1.2.3.4",
 	}, evt.Tags)
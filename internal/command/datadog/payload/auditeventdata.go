@@ -2,27 +2,41 @@ package payload
 
 import (
 	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
-	"go.uber.org/zap"
-	"net/http"
 )
 
-type auditEventData struct {
-	MutationName *string `json:"mutationName"`
-	BuildID      *string `json:"buildId"`
-	TaskID       *string `json:"taskId"`
-}
+func enrichAuditEventData(auditEventData cirrus.AuditEventData, evt *datadogsender.Event) {
+	common := auditEventData.Common()
 
-func (auditEventData auditEventData) Enrich(header http.Header, evt *datadogsender.Event, logger *zap.SugaredLogger) {
-	if mutationName := auditEventData.MutationName; mutationName != nil {
+	if mutationName := common.MutationName; mutationName != nil {
 		evt.Tags = append(evt.Tags, fmt.Sprintf("data.mutationName:%s", *mutationName))
 	}
 
-	if buildID := auditEventData.BuildID; buildID != nil {
+	if buildID := common.BuildID; buildID != nil {
 		evt.Tags = append(evt.Tags, fmt.Sprintf("data.buildId:%s", *buildID))
 	}
 
-	if taskID := auditEventData.TaskID; taskID != nil {
+	if taskID := common.TaskID; taskID != nil {
 		evt.Tags = append(evt.Tags, fmt.Sprintf("data.taskId:%s", *taskID))
 	}
+
+	switch data := auditEventData.(type) {
+	case *cirrus.GenerateNewScopedAccessTokenData:
+		if value := data.Platform; value != nil {
+			evt.Tags = append(evt.Tags, fmt.Sprintf("data.platform:%s", *value))
+		}
+		if value := data.OwnerUID; value != nil {
+			evt.Tags = append(evt.Tags, fmt.Sprintf("data.ownerUid:%s", *value))
+		}
+		if value := data.Permission; value != nil {
+			evt.Tags = append(evt.Tags, fmt.Sprintf("data.permission:%s", *value))
+		}
+		if value := data.DurationSeconds; value != nil {
+			evt.Tags = append(evt.Tags, fmt.Sprintf("data.durationSeconds:%d", *value))
+		}
+		for _, repositoryName := range data.RepositoryNames {
+			evt.Tags = append(evt.Tags, fmt.Sprintf("data.repositoryName:%s", repositoryName))
+		}
+	}
 }
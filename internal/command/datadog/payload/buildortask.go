@@ -2,6 +2,7 @@ package payload
 
 import (
 	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
 	"go.uber.org/zap"
 	"net/http"
@@ -9,33 +10,11 @@ import (
 )
 
 type BuildOrTask struct {
-	Build struct {
-		ID               *int64  `json:"id"`
-		Status           *string `json:"status"`
-		Branch           *string `json:"branch"`
-		PullRequest      *int64  `json:"pullRequest"`
-		PullRequestDraft *bool   `json:"pullRequestDraft"`
-		ChangeIDInRepo   *string `json:"changeIdInRepo"`
-		User             struct {
-			Username *string `json:"username"`
-		} `json:"user"`
-	} `json:"build"`
-	Task struct {
-		ID               *int64   `json:"id"`
-		Name             *string  `json:"name"`
-		Status           *string  `json:"status"`
-		StatusTimestamp  *int64   `json:"statusTimestamp"`
-		InstanceType     *string  `json:"instanceType"`
-		UniqueLabels     []string `json:"uniqueLabels"`
-		ManualRerunCount *int64   `json:"manualRerunCount"`
-		LocalGroupID     *int64   `json:"localGroupId"`
-	} `json:"task"`
-
-	common
+	cirrus.BuildOrTask
 }
 
 func (buildOrTask BuildOrTask) Enrich(header http.Header, evt *datadogsender.Event, logger *zap.SugaredLogger) {
-	buildOrTask.common.Enrich(header, evt, logger)
+	enrichCommon(&buildOrTask.Common, header, evt, logger)
 
 	if value := buildOrTask.Build.ID; value != nil {
 		evt.Tags = append(evt.Tags, fmt.Sprintf("build_id:%d", *value))
@@ -78,3 +57,16 @@ func (buildOrTask BuildOrTask) Enrich(header http.Header, evt *datadogsender.Eve
 		evt.Tags = append(evt.Tags, fmt.Sprintf("manual_rerun_count:%d", *value))
 	}
 }
+
+func (buildOrTask BuildOrTask) Summary() string {
+	action := cirrus.ValueOr(buildOrTask.Action, "updated")
+
+	if value := buildOrTask.Task.Name; value != nil {
+		return fmt.Sprintf("Task %q in %s was %s, status: %s", *value, repositoryFullName(&buildOrTask.Common),
+			action, cirrus.ValueOr(buildOrTask.Task.Status, "UNKNOWN"))
+	}
+
+	return fmt.Sprintf("Build %d for branch %q in %s was %s, status: %s", cirrus.ValueOr(buildOrTask.Build.ID, 0),
+		cirrus.ValueOr(buildOrTask.Build.Branch, ""), repositoryFullName(&buildOrTask.Common), action,
+		cirrus.ValueOr(buildOrTask.Build.Status, "UNKNOWN"))
+}
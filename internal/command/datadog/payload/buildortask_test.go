@@ -15,7 +15,7 @@ import (
 )
 
 func TestEnrichBuild(t *testing.T) {
-	body, err := os.ReadFile(filepath.Join("testdata", "build.json"))
+	body, err := os.ReadFile(filepath.Join("..", "..", "..", "cirrus", "testdata", "build.json"))
 	require.NoError(t, err)
 
 	evt := &datadogsender.Event{}
@@ -36,10 +36,12 @@ func TestEnrichBuild(t *testing.T) {
 		"build_branch:main",
 		"initializer_username:edigaryev",
 	}, evt.Tags)
+	require.Equal(t, "Build 5082236150611968 for branch \"main\" in edigaryev/awesome-system-calls "+
+		"was updated, status: EXECUTING", payload.Summary())
 }
 
 func TestEnrichTask(t *testing.T) {
-	body, err := os.ReadFile(filepath.Join("testdata", "task.json"))
+	body, err := os.ReadFile(filepath.Join("..", "..", "..", "cirrus", "testdata", "task.json"))
 	require.NoError(t, err)
 
 	evt := &datadogsender.Event{}
@@ -64,4 +66,6 @@ func TestEnrichTask(t *testing.T) {
 		"task_status:EXECUTING",
 		"task_instance_type:CommunityContainer",
 	}, evt.Tags)
+	require.Equal(t, "Task \"Lint (cargo fmt)\" in edigaryev/awesome-system-calls was created, "+
+		"status: EXECUTING", payload.Summary())
 }
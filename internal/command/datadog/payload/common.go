@@ -2,28 +2,13 @@ package payload
 
 import (
 	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
 	"go.uber.org/zap"
 	"net/http"
-	"strconv"
-	"time"
 )
 
-type common struct {
-	Action    *string `json:"action"`
-	Type      *string `json:"type"`
-	Timestamp *int64  `json:"timestamp"`
-	Actor     struct {
-		ID *int64 `json:"id"`
-	}
-	Repository struct {
-		ID    *int64  `json:"id"`
-		Owner *string `json:"owner"`
-		Name  *string `json:"name"`
-	}
-}
-
-func (common common) Enrich(header http.Header, evt *datadogsender.Event, logger *zap.SugaredLogger) {
+func enrichCommon(common *cirrus.Common, header http.Header, evt *datadogsender.Event, logger *zap.SugaredLogger) {
 	if value := common.Action; value != nil {
 		evt.Tags = append(evt.Tags, fmt.Sprintf("action:%s", *value))
 	}
@@ -32,15 +17,9 @@ func (common common) Enrich(header http.Header, evt *datadogsender.Event, logger
 		evt.Tags = append(evt.Tags, fmt.Sprintf("type:%s", *t))
 	}
 
-	if rawTimestamp := header.Get("X-Cirrus-Timestamp"); rawTimestamp != "" {
-		timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
-		if err != nil {
-			logger.Warnf("failed to parse \"X-Cirrus-Timestamp\" timestamp value %q: %v",
-				rawTimestamp, err)
-		} else {
-			evt.Timestamp = time.UnixMilli(timestamp)
-		}
-	}
+	// Unlike the other processors, we don't prefer the body timestamps here,
+	// because the stale event policy needs to know when the event was (re-)delivered
+	evt.Timestamp = cirrus.EventTime(header, logger)
 
 	if value := common.Actor.ID; value != nil {
 		evt.Tags = append(evt.Tags, fmt.Sprintf("actor_id:%d", *value))
@@ -56,3 +35,11 @@ func (common common) Enrich(header http.Header, evt *datadogsender.Event, logger
 		evt.Tags = append(evt.Tags, fmt.Sprintf("repository_name:%s", *value))
 	}
 }
+
+func repositoryFullName(common *cirrus.Common) string {
+	if fullName := common.RepositoryFullName(); fullName != "" {
+		return fullName
+	}
+
+	return "unknown repository"
+}
@@ -0,0 +1,26 @@
+package payload
+
+import (
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// Generic is a payload of the webhook events of types unknown to us,
+// which is only enriched with the fields common to all payloads.
+type Generic struct {
+	EventType string `json:"-"`
+
+	cirrus.Common
+}
+
+func (generic Generic) Enrich(header http.Header, evt *datadogsender.Event, logger *zap.SugaredLogger) {
+	enrichCommon(&generic.Common, header, evt, logger)
+}
+
+func (generic Generic) Summary() string {
+	return fmt.Sprintf("Webhook event %q in %s was %s", generic.EventType,
+		repositoryFullName(&generic.Common), cirrus.ValueOr(generic.Action, "created"))
+}
@@ -0,0 +1,44 @@
+package payload_test
+
+import (
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/datadog/payload"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEnrichGeneric(t *testing.T) {
+	body := []byte(`{
+  "action": "created",
+  "repository": {
+    "id": 5129885287448576,
+    "owner": "edigaryev",
+    "name": "awesome-system-calls"
+  },
+  "somethingNew": {
+    "id": 42
+  }
+}`)
+
+	evt := &datadogsender.Event{}
+
+	payload := payload.Generic{EventType: "something_new"}
+	require.NoError(t, json.Unmarshal(body, &payload))
+	payload.Enrich(http.Header{
+		"X-Cirrus-Timestamp": []string{strconv.FormatInt(time.Now().UnixMilli(), 10)},
+	}, evt, zap.S())
+	require.WithinDuration(t, time.Now(), evt.Timestamp, time.Second)
+	require.Equal(t, []string{
+		"action:created",
+		"repository_id:5129885287448576",
+		"repository_owner:edigaryev",
+		"repository_name:awesome-system-calls",
+	}, evt.Tags)
+	require.Equal(t, "Webhook event \"something_new\" in edigaryev/awesome-system-calls was created",
+		payload.Summary())
+}
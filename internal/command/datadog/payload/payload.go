@@ -8,4 +8,21 @@ import (
 
 type Payload interface {
 	Enrich(http.Header, *datadogsender.Event, *zap.SugaredLogger)
+
+	// Summary returns a short human-readable description of the payload.
+	Summary() string
+}
+
+// New returns an empty payload to decode the webhook event of the given type into,
+// falling back to the Generic payload for the event types unknown to us,
+// in which case the second return value is false.
+func New(presentedEventType string) (Payload, bool) {
+	switch presentedEventType {
+	case "audit_event":
+		return &AuditEvent{}, true
+	case "build", "task":
+		return &BuildOrTask{}, true
+	default:
+		return &Generic{EventType: presentedEventType}, false
+	}
 }
@@ -0,0 +1,25 @@
+// Package decoding provides the command-line flags controlling
+// how the processors decode the webhook event payloads.
+package decoding
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/spf13/cobra"
+)
+
+var strictDecoding bool
+
+func AppendFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&strictDecoding, "strict-decoding", false,
+		"reject the webhook events with fields unknown to this server instead of ignoring these fields")
+}
+
+// Mode returns the decoding mode chosen with the command-line flags
+// registered by AppendFlags, defaulting to cirrus.DecodingModeLenient.
+func Mode() cirrus.DecodingMode {
+	if strictDecoding {
+		return cirrus.DecodingModeStrict
+	}
+
+	return cirrus.DecodingModeLenient
+}
@@ -0,0 +1,94 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type bulkAction struct {
+	Index bulkActionIndex `json:"index"`
+}
+
+type bulkActionIndex struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []struct {
+		Index struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"index"`
+	} `json:"items"`
+}
+
+// bulk indexes the documents and returns the per-document errors.
+func (processor *Processor) bulk(ctx context.Context, documents []*Document) []error {
+	errs := make([]error, len(documents))
+
+	setAll := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+
+		return errs
+	}
+
+	var buf bytes.Buffer
+
+	for _, document := range documents {
+		actionJSON, err := json.Marshal(bulkAction{Index: bulkActionIndex{
+			Index: document.Index,
+			ID:    document.ID,
+		}})
+		if err != nil {
+			return setAll(err)
+		}
+
+		buf.Write(actionJSON)
+		buf.WriteByte('\n')
+		buf.Write(document.Body)
+		buf.WriteByte('\n')
+	}
+
+	resp, err := processor.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", &buf)
+	if err != nil {
+		return setAll(err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return setAll(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return setAll(fmt.Errorf("bulk request failed with HTTP %d: %s", resp.StatusCode, responseBody))
+	}
+
+	var bulkResponse bulkResponse
+
+	if err := json.Unmarshal(responseBody, &bulkResponse); err != nil {
+		return setAll(fmt.Errorf("failed to parse bulk response: %v", err))
+	}
+
+	if len(bulkResponse.Items) != len(documents) {
+		return setAll(fmt.Errorf("bulk response contains %d items, expected %d",
+			len(bulkResponse.Items), len(documents)))
+	}
+
+	for i, item := range bulkResponse.Items {
+		if item.Index.Status < 200 || item.Index.Status > 299 {
+			errs[i] = fmt.Errorf("failed to index document %q into %q with HTTP %d: %s",
+				documents[i].ID, documents[i].Index, item.Index.Status, item.Index.Error)
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,74 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+type Document struct {
+	Index string
+	ID    string
+	Body  []byte
+}
+
+// NewDocument creates a document for the webhook event.
+//
+// The document is the webhook event's body with the "@timestamp" and "event_type"
+// fields added, and is indexed into a daily "<prefix>-YYYY.MM.DD" index.
+//
+// The document's ID is derived from the event's identity, and its index
+// from the timestamps in the body, so that the re-delivered events overwrite
+// the previously indexed documents, even when re-delivered on another day.
+// Build events only carry the change's timestamp, which is not when the event
+// happened, but is still the closest stable timestamp we have for them.
+func NewDocument(
+	indexPrefix string,
+	header http.Header,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) (*Document, error) {
+	id, err := cirrus.EventID(presentedEventType, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload cirrus.AuditEvent
+
+	if err := cirrus.Decode(body, &payload, cirrus.DecodingModeLenient); err != nil {
+		return nil, err
+	}
+
+	timestamp := cirrus.EventTime(header, logger, payload.Timestamp, payload.Task.StatusTimestamp,
+		payload.Build.ChangeTimestamp)
+
+	var fields map[string]json.RawMessage
+
+	if err := cirrus.Decode(body, &fields, cirrus.DecodingModeLenient); err != nil {
+		return nil, err
+	}
+
+	fields["@timestamp"], err = json.Marshal(timestamp.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+
+	fields["event_type"], err = json.Marshal(presentedEventType)
+	if err != nil {
+		return nil, err
+	}
+
+	documentBody, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Document{
+		Index: indexPrefix + "-" + timestamp.UTC().Format("2006.01.02"),
+		ID:    id,
+		Body:  documentBody,
+	}, nil
+}
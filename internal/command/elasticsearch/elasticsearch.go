@@ -0,0 +1,246 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/batch"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//go:embed template.json
+var indexTemplate []byte
+
+var elasticsearchURL string
+var username string
+var password string
+var apiKey string
+var indexPrefix string
+var installTemplate bool
+var bulkSize int
+var flushInterval time.Duration
+
+var (
+	ErrElasticsearchFailed = errors.New("failed to index Cirrus CI events in Elasticsearch")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "elasticsearch",
+		Aliases: []string{"opensearch"},
+		Short:   "Index Cirrus CI webhook events in Elasticsearch or OpenSearch",
+		RunE:    run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&elasticsearchURL, "url", "",
+		"Elasticsearch or OpenSearch URL (defaults to the ELASTICSEARCH_URL environment variable, "+
+			"or http://127.0.0.1:9200 if it's not set)")
+	cmd.PersistentFlags().StringVar(&username, "username", "",
+		"username for the HTTP basic authentication")
+	cmd.PersistentFlags().StringVar(&password, "password", "",
+		"password for the HTTP basic authentication (defaults to the ELASTICSEARCH_PASSWORD environment variable)")
+	cmd.PersistentFlags().StringVar(&apiKey, "api-key", "",
+		"Elasticsearch API key to authenticate with instead of the username and password "+
+			"(defaults to the ELASTICSEARCH_API_KEY environment variable)")
+	cmd.PersistentFlags().StringVar(&indexPrefix, "index-prefix", "cirrus",
+		"prefix of the daily indices to index the webhook events into, the resulting indices "+
+			"are in the \"<prefix>-YYYY.MM.DD\" format")
+	cmd.PersistentFlags().BoolVar(&installTemplate, "install-template", true,
+		"install (or update) the index template for the \"<prefix>-*\" indices on startup")
+	cmd.PersistentFlags().IntVar(&bulkSize, "bulk-size", 100,
+		"maximum number of the webhook events to index using a single bulk request")
+	cmd.PersistentFlags().DurationVar(&flushInterval, "flush-interval", time.Second,
+		"maximum time to wait for more webhook events before sending the bulk request")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	elasticsearchURL = server.SecretFromEnv(elasticsearchURL, "ELASTICSEARCH_URL")
+
+	if elasticsearchURL == "" {
+		elasticsearchURL = "http://127.0.0.1:9200"
+	}
+
+	password = server.SecretFromEnv(password, "ELASTICSEARCH_PASSWORD")
+	apiKey = server.SecretFromEnv(apiKey, "ELASTICSEARCH_API_KEY")
+
+	if bulkSize < 1 {
+		return fmt.Errorf("%w: \"--bulk-size\" should be at least 1", ErrElasticsearchFailed)
+	}
+
+	processor, err := NewProcessor(elasticsearchURL, indexPrefix, bulkSize, flushInterval,
+		WithBasicAuth(username, password), WithAPIKey(apiKey))
+	if err != nil {
+		return err
+	}
+	defer processor.Close()
+
+	if installTemplate {
+		if err := processor.InstallTemplate(cmd.Context()); err != nil {
+			return err
+		}
+	}
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+type Option func(*Processor)
+
+// WithBasicAuth authenticates the requests using the HTTP basic
+// authentication, unless the username is empty.
+func WithBasicAuth(username string, password string) Option {
+	return func(processor *Processor) {
+		if username != "" {
+			processor.username = username
+			processor.password = password
+		}
+	}
+}
+
+// WithAPIKey authenticates the requests using the API key, unless it's empty.
+func WithAPIKey(apiKey string) Option {
+	return func(processor *Processor) {
+		if apiKey != "" {
+			processor.apiKey = apiKey
+		}
+	}
+}
+
+type Processor struct {
+	baseURL     *url.URL
+	indexPrefix string
+
+	username string
+	password string
+	apiKey   string
+
+	httpClient *http.Client
+
+	batcher *batch.Batcher[*Document]
+}
+
+func NewProcessor(
+	rawURL string,
+	indexPrefix string,
+	bulkSize int,
+	flushInterval time.Duration,
+	opts ...Option,
+) (*Processor, error) {
+	baseURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse URL: %v", ErrElasticsearchFailed, err)
+	}
+
+	processor := &Processor{
+		baseURL:     baseURL,
+		indexPrefix: indexPrefix,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(processor)
+	}
+
+	// Index the documents of the concurrent webhook events using a single bulk request
+	processor.batcher = batch.New(bulkSize, flushInterval, 30*time.Second, processor.bulk)
+
+	return processor, nil
+}
+
+// InstallTemplate installs (or updates) the index template shipped with
+// the tool, so that the daily indices get the right mappings on creation.
+func (processor *Processor) InstallTemplate(ctx context.Context) error {
+	var template map[string]any
+
+	if err := json.Unmarshal(indexTemplate, &template); err != nil {
+		return fmt.Errorf("%w: failed to parse index template: %v", ErrElasticsearchFailed, err)
+	}
+
+	template["index_patterns"] = []string{processor.indexPrefix + "-*"}
+
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("%w: failed to marshal index template: %v", ErrElasticsearchFailed, err)
+	}
+
+	resp, err := processor.do(ctx, http.MethodPut, "/_index_template/"+url.PathEscape(processor.indexPrefix),
+		"application/json", bytes.NewReader(templateJSON))
+	if err != nil {
+		return fmt.Errorf("%w: failed to install index template: %v", ErrElasticsearchFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+
+		return fmt.Errorf("%w: failed to install index template, got HTTP %d: %s",
+			ErrElasticsearchFailed, resp.StatusCode, responseBody)
+	}
+
+	return nil
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	document, err := NewDocument(processor.indexPrefix, ctx.Request().Header, presentedEventType, body, logger)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrElasticsearchFailed, err)
+	}
+
+	if err := processor.batcher.Submit(ctx.Request().Context(), document); err != nil {
+		return fmt.Errorf("%w: %v", ErrElasticsearchFailed, err)
+	}
+
+	return nil
+}
+
+// Close indexes the pending documents and stops the processor.
+func (processor *Processor) Close() {
+	processor.batcher.Close()
+}
+
+func (processor *Processor) do(
+	ctx context.Context,
+	method string,
+	path string,
+	contentType string,
+	body io.Reader,
+) (*http.Response, error) {
+	requestURL := processor.baseURL.JoinPath(strings.TrimPrefix(path, "/"))
+
+	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", contentType)
+
+	switch {
+	case processor.apiKey != "":
+		request.Header.Set("Authorization", "ApiKey "+processor.apiKey)
+	case processor.username != "":
+		request.SetBasicAuth(processor.username, processor.password)
+	}
+
+	return processor.httpClient.Do(request)
+}
@@ -0,0 +1,176 @@
+package elasticsearch_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/elasticsearch"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeElasticsearch struct {
+	templates    map[string]map[string]any
+	documents    map[string]map[string]any
+	bulkRequests int
+	failIDs      map[string]bool
+	mtx          sync.Mutex
+}
+
+func newFakeElasticsearch(t *testing.T) (*fakeElasticsearch, string) {
+	fake := &fakeElasticsearch{
+		templates: map[string]map[string]any{},
+		documents: map[string]map[string]any{},
+		failIDs:   map[string]bool{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /_index_template/{name}", func(writer http.ResponseWriter, request *http.Request) {
+		fake.mtx.Lock()
+		defer fake.mtx.Unlock()
+
+		var template map[string]any
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&template))
+
+		fake.templates[request.PathValue("name")] = template
+
+		_, _ = writer.Write([]byte(`{"acknowledged":true}`))
+	})
+	mux.HandleFunc("POST /_bulk", func(writer http.ResponseWriter, request *http.Request) {
+		fake.mtx.Lock()
+		defer fake.mtx.Unlock()
+
+		require.Equal(t, "ApiKey secret", request.Header.Get("Authorization"))
+		require.Equal(t, "application/x-ndjson", request.Header.Get("Content-Type"))
+
+		fake.bulkRequests++
+
+		var items []map[string]any
+
+		scanner := bufio.NewScanner(request.Body)
+		scanner.Buffer(nil, 1024*1024)
+
+		for scanner.Scan() {
+			var action map[string]map[string]string
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &action))
+
+			require.True(t, scanner.Scan())
+
+			var document map[string]any
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &document))
+
+			index, id := action["index"]["_index"], action["index"]["_id"]
+
+			if fake.failIDs[id] {
+				items = append(items, map[string]any{"index": map[string]any{
+					"status": 400,
+					"error":  map[string]any{"type": "mapper_parsing_exception"},
+				}})
+
+				continue
+			}
+
+			fake.documents[index+"/"+id] = document
+			items = append(items, map[string]any{"index": map[string]any{"status": 201}})
+		}
+
+		require.NoError(t, json.NewEncoder(writer).Encode(map[string]any{
+			"errors": false,
+			"items":  items,
+		}))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return fake, server.URL
+}
+
+func TestIndex(t *testing.T) {
+	fake, url := newFakeElasticsearch(t)
+
+	processor, err := elasticsearch.NewProcessor(url, "cirrus", 3, 100*time.Millisecond,
+		elasticsearch.WithAPIKey("secret"))
+	require.NoError(t, err)
+	defer processor.Close()
+
+	require.NoError(t, processor.InstallTemplate(context.Background()))
+	require.Equal(t, []any{"cirrus-*"}, fake.templates["cirrus"]["index_patterns"])
+	require.Contains(t, fake.templates["cirrus"], "template")
+
+	// Index the events concurrently, which should result in a single bulk request
+	var wg sync.WaitGroup
+
+	for eventType, name := range map[string]string{
+		"build":       "build.json",
+		"task":        "task.json",
+		"audit_event": "audit_event.json",
+	} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			require.NoError(t, testutil.Deliver(processor.ProcessWebhookEvent, eventType, testutil.Testdata(t, name)))
+		}()
+	}
+
+	wg.Wait()
+
+	require.Equal(t, 1, fake.bulkRequests)
+	require.Len(t, fake.documents, 3)
+
+	// Re-delivery should overwrite the existing document
+	require.NoError(t, testutil.Deliver(processor.ProcessWebhookEvent, "task", testutil.Testdata(t, "task.json")))
+	require.Equal(t, 2, fake.bulkRequests)
+	require.Len(t, fake.documents, 3)
+
+	// Task's index is determined by its status timestamp
+	var taskDocument map[string]any
+
+	for key, document := range fake.documents {
+		if document["event_type"] == "task" {
+			require.Regexp(t, `^cirrus-2024\.07\.31/[0-9a-f]{64}$`, key)
+			taskDocument = document
+		}
+	}
+
+	require.NotNil(t, taskDocument)
+	require.Equal(t, "2024-07-31T06:54:29.403Z", taskDocument["@timestamp"])
+	require.Equal(t, "Lint (cargo fmt)", taskDocument["task"].(map[string]any)["name"])
+
+	// Audit event's ID is used as is
+	require.Contains(t, fake.documents, "cirrus-2024.08.01/bb2bde61-24e6-475c-a8a7-3f03bedcbd61")
+
+	// Build's index is determined by its change timestamp
+	buildCount := 0
+
+	for key, document := range fake.documents {
+		if document["event_type"] == "build" {
+			require.Regexp(t, `^cirrus-2024\.07\.31/`, key)
+			require.Equal(t, "2024-07-31T06:18:10Z", document["@timestamp"])
+			buildCount++
+		}
+	}
+
+	require.Equal(t, 1, buildCount)
+}
+
+func TestIndexFailure(t *testing.T) {
+	fake, url := newFakeElasticsearch(t)
+	fake.failIDs["bb2bde61-24e6-475c-a8a7-3f03bedcbd61"] = true
+
+	processor, err := elasticsearch.NewProcessor(url, "cirrus", 1, time.Second,
+		elasticsearch.WithAPIKey("secret"))
+	require.NoError(t, err)
+	defer processor.Close()
+
+	err = testutil.Deliver(processor.ProcessWebhookEvent, "audit_event", testutil.Testdata(t, "audit_event.json"))
+	require.ErrorIs(t, err, elasticsearch.ErrElasticsearchFailed)
+	require.NoError(t, testutil.Deliver(processor.ProcessWebhookEvent, "task", testutil.Testdata(t, "task.json")))
+}
@@ -0,0 +1,48 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrFileFailed = errors.New("failed to write Cirrus CI events to the file")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "file",
+		Short: "Append Cirrus CI webhook events to a local JSONL file",
+		Long: "Append Cirrus CI webhook events to a local JSONL file.\n\n" +
+			"The webhook events are written by the server itself using the --file flags, " +
+			"which are also available for all the other processors, so this processor does nothing else.",
+		RunE: run,
+	}
+
+	server.AppendFlags(cmd)
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	path, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		return fmt.Errorf("%w: \"--file\" is required", ErrFileFailed)
+	}
+
+	return server.New(processWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+func processWebhookEvent(_ echo.Context, presentedEventType string, _ []byte, logger *zap.SugaredLogger) error {
+	logger.Debugf("written event %q to the file", presentedEventType)
+
+	return nil
+}
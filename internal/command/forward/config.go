@@ -0,0 +1,84 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cloudevents"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+var ErrInvalidConfig = errors.New("invalid forwarder configuration")
+
+type Config struct {
+	Destinations []DestinationConfig `yaml:"destinations"`
+}
+
+type DestinationConfig struct {
+	// URL is where the webhook events are POSTed to.
+	URL string `yaml:"url"`
+
+	// EventTypes limits the events forwarded to this destination,
+	// all events are forwarded when empty.
+	EventTypes []string `yaml:"event-types"`
+
+	// Headers are added to each request.
+	Headers map[string]string `yaml:"headers"`
+
+	// SecretToken, when set, is used to re-sign the (possibly transformed)
+	// body using the same scheme as Cirrus CI uses for the "X-Cirrus-Signature".
+	SecretToken string `yaml:"secret-token"`
+
+	// Template is a Go text/template[1] executed against the decoded
+	// webhook event payload, should produce a valid JSON.
+	//
+	// [1]: https://pkg.go.dev/text/template
+	Template string `yaml:"template"`
+
+	// Expression is a jq[1] expression evaluated against the decoded
+	// webhook event payload, should produce exactly one value.
+	//
+	// [1]: https://jqlang.github.io/jq/manual/
+	Expression string `yaml:"expression"`
+
+	// Format is either cloudevents.FormatRaw (the default), cloudevents.FormatCloudEventsStructured
+	// or cloudevents.FormatCloudEventsBinary. When the CloudEvents format is used, the
+	// (possibly transformed) body becomes the CloudEvent's data.
+	Format cloudevents.Format `yaml:"format"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	configBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read %q: %v", ErrInvalidConfig, path, err)
+	}
+
+	var config Config
+
+	if err := yaml.Unmarshal(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %q: %v", ErrInvalidConfig, path, err)
+	}
+
+	if len(config.Destinations) == 0 {
+		return nil, fmt.Errorf("%w: no destinations configured in %q", ErrInvalidConfig, path)
+	}
+
+	for i, destination := range config.Destinations {
+		if destination.URL == "" {
+			return nil, fmt.Errorf("%w: destination #%d has no URL", ErrInvalidConfig, i+1)
+		}
+
+		if destination.Format != "" {
+			if _, err := cloudevents.ParseFormat(string(destination.Format)); err != nil {
+				return nil, fmt.Errorf("%w: destination #%d has an %v", ErrInvalidConfig, i+1, err)
+			}
+		}
+
+		if destination.Template != "" && destination.Expression != "" {
+			return nil, fmt.Errorf("%w: destination #%d has both a template and an expression, "+
+				"please specify only one", ErrInvalidConfig, i+1)
+		}
+	}
+
+	return &config, nil
+}
@@ -0,0 +1,212 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cloudevents"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+var configPath string
+
+var (
+	ErrForwardFailed = errors.New("failed to forward Cirrus CI events")
+)
+
+// forwardedHeaders are the Cirrus CI headers passed through to the destinations.
+//
+//nolint:gochecknoglobals
+var forwardedHeaders = []string{"X-Cirrus-Event", "X-Cirrus-Timestamp"}
+
+// idempotencyKeyHeader carries the event ID that stays the same across the re-deliveries,
+// since a failure of a single destination makes Cirrus CI re-deliver the event to all of them.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "forward",
+		Short: "Forward Cirrus CI webhook events to arbitrary HTTP endpoints",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&configPath, "config", "",
+		"path to a YAML file describing the destinations to forward the webhook events to")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	if configPath == "" {
+		return fmt.Errorf("%w: \"--config\" is required", ErrForwardFailed)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	processor, err := NewProcessor(config)
+	if err != nil {
+		return err
+	}
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+type Destination struct {
+	config        DestinationConfig
+	eventTypesSet mapset.Set[string]
+	transformer   Transformer
+}
+
+func NewDestination(config DestinationConfig) (*Destination, error) {
+	var transformer Transformer = identityTransformer{}
+	var err error
+
+	switch {
+	case config.Template != "":
+		transformer, err = newTemplateTransformer(config.Template)
+	case config.Expression != "":
+		transformer, err = newExpressionTransformer(config.Expression)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Destination{
+		config:        config,
+		eventTypesSet: mapset.NewSet[string](config.EventTypes...),
+		transformer:   transformer,
+	}, nil
+}
+
+func (destination *Destination) Forward(
+	ctx context.Context,
+	presentedEventType string,
+	header http.Header,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	transformedBody, err := destination.transformer.Transform(body)
+	if err != nil {
+		return err
+	}
+
+	eventID, err := cirrus.EventID(presentedEventType, body)
+	if err != nil {
+		return err
+	}
+
+	encodedHeader := http.Header{
+		"Content-Type": []string{"application/json"},
+	}
+
+	if mode, ok := destination.config.Format.Mode(); ok {
+		event, err := cloudevents.New(header, presentedEventType, body, transformedBody, logger)
+		if err != nil {
+			return err
+		}
+
+		encodedHeader, transformedBody, err = event.Encode(mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, destination.config.URL,
+		bytes.NewReader(transformedBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for key, values := range encodedHeader {
+		req.Header[key] = values
+	}
+
+	for _, key := range forwardedHeaders {
+		if value := header.Get(key); value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+
+	req.Header.Set(idempotencyKeyHeader, eventID)
+
+	for key, value := range destination.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	if secretToken := destination.config.SecretToken; secretToken != "" {
+		req.Header.Set("X-Cirrus-Signature", server.Sign(secretToken, transformedBody))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("destination unexpectedly responded with HTTP %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+type Processor struct {
+	destinations []*Destination
+}
+
+func NewProcessor(config *Config) (*Processor, error) {
+	processor := &Processor{}
+
+	for _, destinationConfig := range config.Destinations {
+		destination, err := NewDestination(destinationConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		processor.destinations = append(processor.destinations, destination)
+	}
+
+	return processor, nil
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	var errs []error
+
+	for _, destination := range processor.destinations {
+		if destination.eventTypesSet.Cardinality() != 0 && !destination.eventTypesSet.Contains(presentedEventType) {
+			continue
+		}
+
+		if err := destination.Forward(ctx.Request().Context(), presentedEventType,
+			ctx.Request().Header, body, logger); err != nil {
+			logger.Warnf("failed to forward event of type %q to %s: %v",
+				presentedEventType, destination.config.URL, err)
+
+			errs = append(errs, fmt.Errorf("%s: %w", destination.config.URL, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%w: %v", ErrForwardFailed, err)
+	}
+
+	return nil
+}
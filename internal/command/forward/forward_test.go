@@ -0,0 +1,186 @@
+package forward_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/forward"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type receivedRequest struct {
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+func newReceiver(t *testing.T) (*httptest.Server, *[]receivedRequest) {
+	var requests []receivedRequest
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, err := io.ReadAll(request.Body)
+		require.NoError(t, err)
+
+		requests = append(requests, receivedRequest{
+			Path:   request.URL.Path,
+			Header: request.Header,
+			Body:   string(body),
+		})
+
+		if request.URL.Path == "/fail" {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(receiver.Close)
+
+	return receiver, &requests
+}
+
+func loadProcessor(t *testing.T, config string) *forward.Processor {
+	configPath := filepath.Join(t.TempDir(), "forward.yml")
+	require.NoError(t, os.WriteFile(configPath, []byte(config), 0600))
+
+	loadedConfig, err := forward.LoadConfig(configPath)
+	require.NoError(t, err)
+
+	processor, err := forward.NewProcessor(loadedConfig)
+	require.NoError(t, err)
+
+	return processor
+}
+
+func forwardTestdata(t *testing.T, processor *forward.Processor, eventType string, name string) error {
+	return testutil.Deliver(processor.ProcessWebhookEvent, eventType, testutil.Testdata(t, name))
+}
+
+func eventID(t *testing.T, eventType string, name string) string {
+	id, err := cirrus.EventID(eventType, testutil.Testdata(t, name))
+	require.NoError(t, err)
+
+	return id
+}
+
+func TestForward(t *testing.T) {
+	receiver, requests := newReceiver(t)
+
+	processor := loadProcessor(t, `
+destinations:
+  - url: `+receiver.URL+`/raw
+    headers:
+      Authorization: Bearer internal
+    secret-token: raw-secret
+  - url: `+receiver.URL+`/template
+    event-types: [task]
+    template: '{"repository": {{ json .repository.name }}, "task": {{ .task.id }}}'
+  - url: `+receiver.URL+`/expression
+    event-types: [task]
+    expression: '{status: .task.status, build: .build.id}'
+    secret-token: expression-secret
+  - url: `+receiver.URL+`/audit
+    event-types: [audit_event]
+`)
+
+	require.NoError(t, forwardTestdata(t, processor, "task", "task.json"))
+	require.Len(t, *requests, 3)
+
+	raw := (*requests)[0]
+	require.Equal(t, "/raw", raw.Path)
+	require.Equal(t, "Bearer internal", raw.Header.Get("Authorization"))
+	require.Equal(t, "task", raw.Header.Get("X-Cirrus-Event"))
+	require.Equal(t, "1722408869403", raw.Header.Get("X-Cirrus-Timestamp"))
+	require.True(t, strings.HasPrefix(raw.Body, "{\n  \"action\": \"created\""))
+	require.Equal(t, eventID(t, "task", "task.json"), raw.Header.Get("Idempotency-Key"))
+	require.Equal(t, sign("raw-secret", raw.Body), raw.Header.Get("X-Cirrus-Signature"))
+
+	template := (*requests)[1]
+	require.Equal(t, "/template", template.Path)
+	require.JSONEq(t, `{"repository": "awesome-system-calls", "task": 6017965227769856}`, template.Body)
+	require.Empty(t, template.Header.Get("X-Cirrus-Signature"))
+	require.Equal(t, eventID(t, "task", "task.json"), template.Header.Get("Idempotency-Key"))
+
+	expression := (*requests)[2]
+	require.Equal(t, "/expression", expression.Path)
+	require.JSONEq(t, `{"status": "EXECUTING", "build": 5082236150611968}`, expression.Body)
+	require.Equal(t, sign("expression-secret", expression.Body), expression.Header.Get("X-Cirrus-Signature"))
+}
+
+func TestForwardFailure(t *testing.T) {
+	receiver, requests := newReceiver(t)
+
+	processor := loadProcessor(t, `
+destinations:
+  - url: `+receiver.URL+`/fail
+  - url: `+receiver.URL+`/ok
+`)
+
+	err := forwardTestdata(t, processor, "build", "build.json")
+	require.ErrorIs(t, err, forward.ErrForwardFailed)
+	require.ErrorContains(t, err, "HTTP 503")
+
+	// Failing destination shouldn't prevent forwarding to the others
+	require.Len(t, *requests, 2)
+	require.Equal(t, "/ok", (*requests)[1].Path)
+}
+
+func TestInvalidConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "forward.yml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+destinations:
+  - url: http://localhost
+    template: '{}'
+    expression: '.'
+`), 0600))
+
+	_, err := forward.LoadConfig(configPath)
+	require.ErrorIs(t, err, forward.ErrInvalidConfig)
+
+	_, err = forward.NewDestination(forward.DestinationConfig{URL: "http://localhost", Expression: "{"})
+	require.ErrorIs(t, err, forward.ErrInvalidConfig)
+}
+
+func sign(secretToken string, body string) string {
+	hmacSHA256 := hmac.New(sha256.New, []byte(secretToken))
+	hmacSHA256.Write([]byte(body))
+
+	return hex.EncodeToString(hmacSHA256.Sum(nil))
+}
+
+func TestForwardCloudEvents(t *testing.T) {
+	receiver, requests := newReceiver(t)
+
+	processor := loadProcessor(t, `
+destinations:
+  - url: `+receiver.URL+`/structured
+    format: cloudevents-structured
+    secret-token: structured-secret
+  - url: `+receiver.URL+`/binary
+    format: cloudevents-binary
+    expression: '{status: .task.status}'
+`)
+
+	require.NoError(t, forwardTestdata(t, processor, "task", "task.json"))
+	require.Len(t, *requests, 2)
+
+	structured := (*requests)[0]
+	require.Equal(t, "application/cloudevents+json", structured.Header.Get("Content-Type"))
+	require.Equal(t, sign("structured-secret", structured.Body), structured.Header.Get("X-Cirrus-Signature"))
+	require.Contains(t, structured.Body, `"type":"com.cirrus-ci.task.created"`)
+	require.Contains(t, structured.Body, `"time":"2024-07-31T06:54:29.403Z"`)
+	require.Contains(t, structured.Body, `"data":{`)
+
+	binary := (*requests)[1]
+	require.Equal(t, "application/json", binary.Header.Get("Content-Type"))
+	require.Equal(t, "com.cirrus-ci.task.created", binary.Header.Get("ce-type"))
+	require.Equal(t, "https://cirrus-ci.com/github/edigaryev/awesome-system-calls", binary.Header.Get("ce-source"))
+	require.Equal(t, "task/6017965227769856", binary.Header.Get("ce-subject"))
+	require.JSONEq(t, `{"status": "EXECUTING"}`, binary.Body)
+}
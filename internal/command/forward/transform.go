@@ -0,0 +1,156 @@
+package forward
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/itchyny/gojq"
+	"text/template"
+)
+
+var ErrTransformationFailed = errors.New("failed to transform the webhook event")
+
+// Transformer rewrites the webhook event's body before it's forwarded.
+type Transformer interface {
+	Transform(body []byte) ([]byte, error)
+}
+
+type identityTransformer struct{}
+
+func (identityTransformer) Transform(body []byte) ([]byte, error) {
+	return body, nil
+}
+
+type templateTransformer struct {
+	template *template.Template
+}
+
+func newTemplateTransformer(text string) (*templateTransformer, error) {
+	tmpl, err := template.New("").Option("missingkey=zero").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			valueJSON, err := json.Marshal(v)
+
+			return string(valueJSON), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse the template: %v", ErrInvalidConfig, err)
+	}
+
+	return &templateTransformer{
+		template: tmpl,
+	}, nil
+}
+
+func (transformer *templateTransformer) Transform(body []byte) ([]byte, error) {
+	payload, err := decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	if err := transformer.template.Execute(&buf, payload); err != nil {
+		return nil, fmt.Errorf("%w: failed to execute the template: %v", ErrTransformationFailed, err)
+	}
+
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("%w: template produced an invalid JSON: %s", ErrTransformationFailed, buf.String())
+	}
+
+	return buf.Bytes(), nil
+}
+
+type expressionTransformer struct {
+	code *gojq.Code
+}
+
+func newExpressionTransformer(expression string) (*expressionTransformer, error) {
+	query, err := gojq.Parse(expression)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse the expression: %v", ErrInvalidConfig, err)
+	}
+
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to compile the expression: %v", ErrInvalidConfig, err)
+	}
+
+	return &expressionTransformer{
+		code: code,
+	}, nil
+}
+
+func (transformer *expressionTransformer) Transform(body []byte) ([]byte, error) {
+	payload, err := decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	iter := transformer.code.Run(payload)
+
+	result, ok := iter.Next()
+	if !ok {
+		return nil, fmt.Errorf("%w: expression produced no value", ErrTransformationFailed)
+	}
+
+	if err, ok := result.(error); ok {
+		return nil, fmt.Errorf("%w: failed to evaluate the expression: %v", ErrTransformationFailed, err)
+	}
+
+	if _, ok := iter.Next(); ok {
+		return nil, fmt.Errorf("%w: expression produced more than one value", ErrTransformationFailed)
+	}
+
+	resultJSON, err := gojq.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to marshal the expression's result: %v", ErrTransformationFailed, err)
+	}
+
+	return resultJSON, nil
+}
+
+// decode decodes the body into the types understood both by the text/template
+// and gojq, preserving the precision of the 64-bit IDs.
+func decode(body []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var payload any
+
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse the webhook event as JSON: %v", ErrTransformationFailed, err)
+	}
+
+	return normalize(payload), nil
+}
+
+// normalize converts json.Number's into the int's when possible, as gojq
+// doesn't support json.Number, and into float64's otherwise.
+func normalize(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, item := range value {
+			value[key] = normalize(item)
+		}
+
+		return value
+	case []any:
+		for i, item := range value {
+			value[i] = normalize(item)
+		}
+
+		return value
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return int(integer)
+		}
+
+		float, _ := value.Float64()
+
+		return float
+	default:
+		return value
+	}
+}
@@ -4,7 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	payloadpkg "github.com/cirruslabs/cirrus-webhooks-server/internal/command/datadog/payload"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/decoding"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
 	"github.com/labstack/echo/v4"
 	"github.com/spf13/cobra"
@@ -23,6 +24,7 @@ func NewCommand() *cobra.Command {
 	}
 
 	server.AppendFlags(cmd, "task")
+	decoding.AppendFlags(cmd)
 
 	cmd.PersistentFlags().StringVar(&dxInstance, "dx-instance", "",
 		"DX instance to use when sending webhook events as DX Pipeline events to the Data Cloud API")
@@ -42,9 +44,9 @@ func run(cmd *cobra.Command, _ []string) error {
 
 func processWebhookEvent(ctx echo.Context, presentedEventType string, body []byte, logger *zap.SugaredLogger) error {
 	// Decode the event
-	var payload payloadpkg.BuildOrTask
+	var payload cirrus.BuildOrTask
 
-	if err := json.Unmarshal(body, &payload); err != nil {
+	if err := cirrus.Decode(body, &payload, decoding.Mode()); err != nil {
 		return fmt.Errorf("failed to parse the webhook event of type %q as JSON: %w",
 			presentedEventType, err)
 	}
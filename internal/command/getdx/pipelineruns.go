@@ -2,7 +2,7 @@ package getdx
 
 import (
 	"fmt"
-	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/datadog/payload"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
 	"strconv"
 )
 
@@ -61,7 +61,7 @@ type PipelineRunsRequest struct {
 	GithubUsername string `json:"github_username"`
 }
 
-func (pipelineRunsRequest *PipelineRunsRequest) Enrich(payload *payload.BuildOrTask) error {
+func (pipelineRunsRequest *PipelineRunsRequest) Enrich(payload *cirrus.BuildOrTask) error {
 	if value := payload.Task.Name; value != nil {
 		pipelineRunsRequest.PipelineName = *value
 	} else {
@@ -95,10 +95,7 @@ func (pipelineRunsRequest *PipelineRunsRequest) Enrich(payload *payload.BuildOrT
 		}
 	}
 
-	if payload.Repository.Owner != nil && payload.Repository.Name != nil {
-		pipelineRunsRequest.Repository = fmt.Sprintf("%s/%s",
-			*payload.Repository.Owner, *payload.Repository.Name)
-	}
+	pipelineRunsRequest.Repository = payload.RepositoryFullName()
 
 	if value := payload.Build.ChangeIDInRepo; value != nil {
 		pipelineRunsRequest.CommitSHA = *value
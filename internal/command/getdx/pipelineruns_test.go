@@ -1,14 +1,14 @@
 package getdx_test
 
 import (
-	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/datadog/payload"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/getdx"
 	"github.com/stretchr/testify/require"
 	"testing"
 )
 
 func TestPipelineRunsRequestEnrichment(t *testing.T) {
-	var payload payload.BuildOrTask
+	var payload cirrus.BuildOrTask
 
 	buildID := int64(42)
 	payload.Build.ID = &buildID
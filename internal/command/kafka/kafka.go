@@ -0,0 +1,226 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cloudevents"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	"go.uber.org/zap"
+	"os"
+)
+
+var brokers []string
+var topic string
+var key string
+var format string
+var saslMechanism string
+var saslUsername string
+var saslPassword string
+var tlsEnabled bool
+var tlsCAFile string
+var tlsInsecureSkipVerify bool
+
+var (
+	ErrKafkaFailed = errors.New("failed to publish Cirrus CI events to Kafka")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kafka",
+		Short: "Publish Cirrus CI webhook events to a Kafka topic",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringSliceVar(&brokers, "brokers", []string{},
+		"comma-separated list of the Kafka seed brokers (for example, --brokers=127.0.0.1:9092)")
+	cmd.PersistentFlags().StringVar(&topic, "topic", "",
+		"Kafka topic to publish the webhook events to")
+	cmd.PersistentFlags().StringVar(&key, "key", string(KeyModeBuild),
+		"what to key the records by to preserve the ordering of the related events: "+
+			"\"build\" for the build ID, falling back to the repository, or \"repository\"")
+	cmd.PersistentFlags().StringVar(&format, "format", string(cloudevents.FormatRaw),
+		"record format: \"raw\" for the webhook event's body as is, \"cloudevents-structured\" or "+
+			"\"cloudevents-binary\" for the CloudEvents in the structured or binary content mode")
+	cmd.PersistentFlags().StringVar(&saslMechanism, "sasl-mechanism", "",
+		"SASL mechanism to authenticate with: \"plain\", \"scram-sha-256\" or \"scram-sha-512\"")
+	cmd.PersistentFlags().StringVar(&saslUsername, "sasl-username", "",
+		"SASL username to authenticate with")
+	cmd.PersistentFlags().StringVar(&saslPassword, "sasl-password", "",
+		"SASL password to authenticate with (defaults to the KAFKA_SASL_PASSWORD environment variable)")
+	cmd.PersistentFlags().BoolVar(&tlsEnabled, "tls", false,
+		"connect to the Kafka brokers using TLS")
+	cmd.PersistentFlags().StringVar(&tlsCAFile, "tls-ca-file", "",
+		"PEM-encoded CA certificates file to verify the Kafka brokers' certificates with "+
+			"instead of the system's CA certificates (implies --tls)")
+	cmd.PersistentFlags().BoolVar(&tlsInsecureSkipVerify, "tls-insecure-skip-verify", false,
+		"do not verify the Kafka brokers' certificates (implies --tls)")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	saslPassword = server.SecretFromEnv(saslPassword, "KAFKA_SASL_PASSWORD")
+
+	if len(brokers) == 0 {
+		return fmt.Errorf("%w: \"--brokers\" is required", ErrKafkaFailed)
+	}
+
+	if topic == "" {
+		return fmt.Errorf("%w: \"--topic\" is required", ErrKafkaFailed)
+	}
+
+	switch KeyMode(key) {
+	case KeyModeBuild, KeyModeRepository:
+		// valid key mode
+	default:
+		return fmt.Errorf("%w: unsupported key %q, please specify either %q or %q",
+			ErrKafkaFailed, key, KeyModeBuild, KeyModeRepository)
+	}
+
+	parsedFormat, err := cloudevents.ParseFormat(format)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKafkaFailed, err)
+	}
+
+	opts, err := clientOpts()
+	if err != nil {
+		return err
+	}
+
+	processor, err := NewProcessor(topic, KeyMode(key), parsedFormat, opts...)
+	if err != nil {
+		return err
+	}
+	defer processor.Close()
+
+	if err := processor.Ping(cmd.Context()); err != nil {
+		zap.S().Warnf("failed to ping Kafka brokers, will retry when publishing: %v", err)
+	}
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+func clientOpts() ([]kgo.Opt, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(brokers...),
+	}
+
+	switch saslMechanism {
+	case "":
+		// no authentication
+	case "plain":
+		opts = append(opts, kgo.SASL(plain.Auth{
+			User: saslUsername,
+			Pass: saslPassword,
+		}.AsMechanism()))
+	case "scram-sha-256":
+		opts = append(opts, kgo.SASL(scram.Auth{
+			User: saslUsername,
+			Pass: saslPassword,
+		}.AsSha256Mechanism()))
+	case "scram-sha-512":
+		opts = append(opts, kgo.SASL(scram.Auth{
+			User: saslUsername,
+			Pass: saslPassword,
+		}.AsSha512Mechanism()))
+	default:
+		return nil, fmt.Errorf("%w: unsupported SASL mechanism %q, please specify either "+
+			"\"plain\", \"scram-sha-256\" or \"scram-sha-512\"", ErrKafkaFailed, saslMechanism)
+	}
+
+	if tlsEnabled || tlsCAFile != "" || tlsInsecureSkipVerify {
+		tlsConfig := &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			//nolint:gosec // explicitly requested by the user
+			InsecureSkipVerify: tlsInsecureSkipVerify,
+		}
+
+		if tlsCAFile != "" {
+			caPEM, err := os.ReadFile(tlsCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("%w: failed to read the CA certificates file: %v", ErrKafkaFailed, err)
+			}
+
+			tlsConfig.RootCAs = x509.NewCertPool()
+
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+				return nil, fmt.Errorf("%w: no CA certificates found in %q", ErrKafkaFailed, tlsCAFile)
+			}
+		}
+
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+
+	return opts, nil
+}
+
+type Processor struct {
+	client  *kgo.Client
+	topic   string
+	keyMode KeyMode
+	format  cloudevents.Format
+}
+
+// NewProcessor creates a Kafka producer with the idempotent producer settings, that is,
+// with the acknowledgement from all in-sync replicas and no duplicates on retries.
+func NewProcessor(topic string, keyMode KeyMode, format cloudevents.Format, opts ...kgo.Opt) (*Processor, error) {
+	opts = append([]kgo.Opt{
+		// Idempotent writes require all in-sync replicas to acknowledge the write,
+		// note that idempotent writes are enabled in the franz-go by default
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		// Default sticky key partitioner hashes the keys the same way
+		// the Java client does, so all events with the same key
+		// will end up in the same partition
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+	}, opts...)
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create Kafka client: %v", ErrKafkaFailed, err)
+	}
+
+	return &Processor{
+		client:  client,
+		topic:   topic,
+		keyMode: keyMode,
+		format:  format,
+	}, nil
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	record, err := NewRecord(processor.topic, processor.keyMode, processor.format,
+		ctx.Request().Header, presentedEventType, body, logger)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKafkaFailed, err)
+	}
+
+	if err := processor.client.ProduceSync(ctx.Request().Context(), record).FirstErr(); err != nil {
+		return fmt.Errorf("%w: %v", ErrKafkaFailed, err)
+	}
+
+	return nil
+}
+
+func (processor *Processor) Close() {
+	processor.client.Close()
+}
+
+// Ping checks the connectivity with the Kafka brokers.
+func (processor *Processor) Ping(ctx context.Context) error {
+	return processor.client.Ping(ctx)
+}
@@ -0,0 +1,109 @@
+package kafka_test
+
+import (
+	"context"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cloudevents"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/kafka"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"testing"
+	"time"
+)
+
+func consume(t *testing.T, cluster *kfake.Cluster, topic string, count int) []*kgo.Record {
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var records []*kgo.Record
+
+	for len(records) < count {
+		fetches := consumer.PollFetches(ctx)
+		require.NoError(t, fetches.Err())
+
+		records = append(records, fetches.Records()...)
+	}
+
+	return records
+}
+
+func headers(record *kgo.Record) map[string]string {
+	result := map[string]string{}
+
+	for _, header := range record.Headers {
+		result[header.Key] = string(header.Value)
+	}
+
+	return result
+}
+
+func TestPublish(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(8, "cirrus"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	processor, err := kafka.NewProcessor("cirrus", kafka.KeyModeBuild, cloudevents.FormatRaw,
+		kgo.SeedBrokers(cluster.ListenAddrs()...))
+	require.NoError(t, err)
+	defer processor.Close()
+
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "build", "build.json")
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "task", "task.json")
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "audit_event", "audit_event.json")
+
+	records := consume(t, cluster, "cirrus", 3)
+
+	recordsByEvent := map[string]*kgo.Record{}
+	for _, record := range records {
+		recordsByEvent[headers(record)["X-Cirrus-Event"]] = record
+	}
+
+	build := recordsByEvent["build"]
+	task := recordsByEvent["task"]
+	auditEvent := recordsByEvent["audit_event"]
+
+	// Events of the same build should end up in the same partition in order
+	require.Equal(t, "5082236150611968", string(build.Key))
+	require.Equal(t, "5082236150611968", string(task.Key))
+	require.Equal(t, build.Partition, task.Partition)
+	require.Less(t, build.Offset, task.Offset)
+
+	require.Equal(t, "event_type:audit_event", string(auditEvent.Key))
+
+	// Only Cirrus CI headers should be carried
+	require.Equal(t, map[string]string{
+		"X-Cirrus-Event":     "task",
+		"X-Cirrus-Timestamp": "1722408869403",
+	}, headers(task))
+	require.Contains(t, string(task.Value), `"name": "Lint (cargo fmt)"`)
+}
+
+func TestPublishCloudEvents(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "cirrus"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	processor, err := kafka.NewProcessor("cirrus", kafka.KeyModeRepository, cloudevents.FormatCloudEventsBinary,
+		kgo.SeedBrokers(cluster.ListenAddrs()...))
+	require.NoError(t, err)
+	defer processor.Close()
+
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "task", "task.json")
+
+	records := consume(t, cluster, "cirrus", 1)
+	require.Equal(t, "edigaryev/awesome-system-calls", string(records[0].Key))
+
+	recordHeaders := headers(records[0])
+	require.Equal(t, "com.cirrus-ci.task.created", recordHeaders["ce_type"])
+	require.Equal(t, "1.0", recordHeaders["ce_specversion"])
+	require.Equal(t, "application/json", recordHeaders["content-type"])
+}
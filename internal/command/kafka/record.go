@@ -0,0 +1,114 @@
+package kafka
+
+import (
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cloudevents"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type KeyMode string
+
+const (
+	// KeyModeBuild keys the records by the build ID, falling back to
+	// the repository, which preserves the ordering of the events within
+	// the build, while spreading the builds across the partitions.
+	KeyModeBuild KeyMode = "build"
+
+	// KeyModeRepository keys the records by the repository, which preserves
+	// the ordering of the events within the repository.
+	KeyModeRepository KeyMode = "repository"
+)
+
+// NewRecord creates a Kafka record for the webhook event.
+func NewRecord(
+	topic string,
+	keyMode KeyMode,
+	format cloudevents.Format,
+	header http.Header,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) (*kgo.Record, error) {
+	var payload cirrus.BuildOrTask
+
+	if err := cirrus.Decode(body, &payload, cirrus.DecodingModeLenient); err != nil {
+		return nil, err
+	}
+
+	record := &kgo.Record{
+		Topic: topic,
+		Key:   []byte(recordKey(keyMode, presentedEventType, &payload)),
+		Value: body,
+	}
+
+	// Carry the Cirrus CI headers
+	for key := range header {
+		if strings.HasPrefix(key, "X-Cirrus-") {
+			record.Headers = append(record.Headers, kgo.RecordHeader{
+				Key:   key,
+				Value: []byte(header.Get(key)),
+			})
+		}
+	}
+
+	mode, ok := format.Mode()
+	if !ok {
+		return record, nil
+	}
+
+	event, err := cloudevents.New(header, presentedEventType, body, nil, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Kafka protocol binding for CloudEvents[1] is very similar to the HTTP one,
+	// except that the attributes in the binary content mode are prefixed with "ce_"
+	//
+	// [1]: https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/kafka-protocol-binding.md
+	if mode == cloudevents.ModeStructured {
+		_, record.Value, err = event.Encode(cloudevents.ModeStructured)
+		if err != nil {
+			return nil, err
+		}
+
+		record.Headers = append(record.Headers, kgo.RecordHeader{
+			Key:   "content-type",
+			Value: []byte(cloudevents.StructuredContentType),
+		})
+
+		return record, nil
+	}
+
+	for name, value := range event.Attributes() {
+		record.Headers = append(record.Headers, kgo.RecordHeader{
+			Key:   "ce_" + name,
+			Value: []byte(value),
+		})
+	}
+
+	record.Headers = append(record.Headers, kgo.RecordHeader{
+		Key:   "content-type",
+		Value: []byte(event.DataContentType),
+	})
+
+	return record, nil
+}
+
+func recordKey(keyMode KeyMode, presentedEventType string, payload *cirrus.BuildOrTask) string {
+	if keyMode == KeyModeBuild && payload.Build.ID != nil {
+		return strconv.FormatInt(*payload.Build.ID, 10)
+	}
+
+	if fullName := payload.RepositoryFullName(); fullName != "" {
+		return fullName
+	}
+
+	// Events without a repository, such as the most of the audit events,
+	// still need some key to be ordered relative to each other
+	return fmt.Sprintf("event_type:%s", presentedEventType)
+}
@@ -0,0 +1,110 @@
+package loki
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	payloadpkg "github.com/cirruslabs/cirrus-webhooks-server/internal/command/datadog/payload"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultLabels is a small set of the low-cardinality tags
+// that are promoted to the stream labels by default.
+//
+//nolint:gochecknoglobals
+var defaultLabels = []string{"repository_owner", "status"}
+
+type Entry struct {
+	Labels   map[string]string
+	Time     time.Time
+	Line     string
+	Metadata map[string]string
+}
+
+// NewEntry creates a Loki log entry for the webhook event.
+//
+// The entry is described using the same tags as the Datadog events,
+// plus the "event_type" and "status" (build's or task's status,
+// depending on the event type) tags. The "event_type" tag and the tags
+// named in labelNames become the stream labels and the rest of the tags
+// become the structured metadata, while the line is the webhook event's
+// body as is.
+//
+// The "event_type" label is always present, since Loki
+// rejects the streams without any labels. The values of
+// the repeated tags, such as "data.repositoryName",
+// are joined using commas.
+func NewEntry(
+	header http.Header,
+	presentedEventType string,
+	body []byte,
+	labelNames []string,
+	logger *zap.SugaredLogger,
+) (*Entry, error) {
+	payload, _ := payloadpkg.New(presentedEventType)
+
+	if err := cirrus.Decode(body, payload, cirrus.DecodingModeLenient); err != nil {
+		return nil, err
+	}
+
+	// A superset of the build, task and audit event payloads
+	var timestamps cirrus.AuditEvent
+
+	if err := cirrus.Decode(body, &timestamps, cirrus.DecodingModeLenient); err != nil {
+		return nil, err
+	}
+
+	evt := &datadogsender.Event{}
+
+	payload.Enrich(header, evt, logger)
+
+	tags := map[string]string{}
+
+	for _, tag := range evt.Tags {
+		key, value, _ := strings.Cut(tag, ":")
+
+		if existingValue, ok := tags[key]; ok {
+			value = existingValue + "," + value
+		}
+
+		tags[key] = value
+	}
+
+	switch presentedEventType {
+	case "build":
+		if status, ok := tags["build_status"]; ok {
+			tags["status"] = status
+		}
+	case "task":
+		if status, ok := tags["task_status"]; ok {
+			tags["status"] = status
+		}
+	}
+
+	entry := &Entry{
+		Labels: map[string]string{
+			"event_type": presentedEventType,
+		},
+		Time:     cirrus.EventTime(header, logger, timestamps.Timestamp, timestamps.Task.StatusTimestamp),
+		Line:     string(body),
+		Metadata: map[string]string{},
+	}
+
+	for _, labelName := range labelNames {
+		if value, ok := tags[labelName]; ok {
+			entry.Labels[labelName] = value
+			delete(tags, labelName)
+		}
+	}
+
+	// The "status" tag only duplicates the "build_status" or "task_status" tag
+	delete(tags, "status")
+
+	for key, value := range tags {
+		entry.Metadata[key] = value
+	}
+
+	return entry, nil
+}
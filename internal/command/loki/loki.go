@@ -0,0 +1,212 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var lokiURL string
+var labels []string
+var structuredMetadata bool
+var tenantID string
+var username string
+var password string
+
+var (
+	ErrLokiFailed = errors.New("failed to push Cirrus CI events to Loki")
+
+	labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "loki",
+		Short: "Push Cirrus CI webhook events to Grafana Loki",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&lokiURL, "url", "",
+		"Loki URL to push the webhook events to (for example, http://loki:3100)")
+	cmd.PersistentFlags().StringSliceVar(&labels, "labels", defaultLabels,
+		"comma-separated list of the tags to use as the stream labels in addition to \"event_type\", "+
+			"keep it small since each unique combination of labels creates a new stream")
+	cmd.PersistentFlags().BoolVar(&structuredMetadata, "structured-metadata", true,
+		"attach the rest of the tags as the structured metadata, which requires Loki 2.9 or newer")
+	cmd.PersistentFlags().StringVar(&tenantID, "tenant-id", "",
+		"tenant ID to push the webhook events as (sets the X-Scope-OrgID header)")
+	cmd.PersistentFlags().StringVar(&username, "username", "",
+		"username for the HTTP basic authentication")
+	cmd.PersistentFlags().StringVar(&password, "password", "",
+		"password for the HTTP basic authentication (defaults to the LOKI_PASSWORD environment variable)")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	password = server.SecretFromEnv(password, "LOKI_PASSWORD")
+
+	if lokiURL == "" {
+		return fmt.Errorf("%w: \"--url\" is required", ErrLokiFailed)
+	}
+
+	processor, err := NewProcessor(lokiURL, labels, structuredMetadata,
+		WithTenantID(tenantID), WithBasicAuth(username, password))
+	if err != nil {
+		return err
+	}
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+type Option func(*Processor)
+
+// WithTenantID pushes the entries as the given tenant,
+// which multi-tenant Loki deployments require.
+func WithTenantID(tenantID string) Option {
+	return func(processor *Processor) {
+		processor.tenantID = tenantID
+	}
+}
+
+// WithBasicAuth authenticates the push requests, for example,
+// when pushing to Grafana Cloud or through a reverse proxy.
+func WithBasicAuth(username string, password string) Option {
+	return func(processor *Processor) {
+		processor.username = username
+		processor.password = password
+	}
+}
+
+type Processor struct {
+	pushURL            string
+	labels             []string
+	structuredMetadata bool
+
+	tenantID string
+	username string
+	password string
+
+	httpClient *http.Client
+}
+
+func NewProcessor(rawURL string, labels []string, structuredMetadata bool, opts ...Option) (*Processor, error) {
+	baseURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse URL: %v", ErrLokiFailed, err)
+	}
+
+	for _, label := range labels {
+		if !labelNameRegexp.MatchString(label) {
+			return nil, fmt.Errorf("%w: invalid label name %q", ErrLokiFailed, label)
+		}
+	}
+
+	processor := &Processor{
+		pushURL:            baseURL.JoinPath("loki", "api", "v1", "push").String(),
+		labels:             labels,
+		structuredMetadata: structuredMetadata,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(processor)
+	}
+
+	return processor, nil
+}
+
+type pushRequest struct {
+	Streams []pushStream `json:"streams"`
+}
+
+type pushStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][]any           `json:"values"`
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	entry, err := NewEntry(ctx.Request().Header, presentedEventType, body, processor.labels, logger)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLokiFailed, err)
+	}
+
+	// Loki expects the timestamp to be a string with the nanoseconds since the epoch
+	value := []any{strconv.FormatInt(entry.Time.UnixNano(), 10), entry.Line}
+
+	if processor.structuredMetadata && len(entry.Metadata) != 0 {
+		value = append(value, entry.Metadata)
+	}
+
+	pushRequestJSON, err := json.Marshal(pushRequest{
+		Streams: []pushStream{
+			{
+				Stream: entry.Labels,
+				Values: [][]any{value},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLokiFailed, err)
+	}
+
+	if err := processor.push(ctx.Request().Context(), pushRequestJSON); err != nil {
+		return fmt.Errorf("%w: %v", ErrLokiFailed, err)
+	}
+
+	return nil
+}
+
+func (processor *Processor) push(ctx context.Context, pushRequestJSON []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, processor.pushURL,
+		bytes.NewReader(pushRequestJSON))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	if processor.tenantID != "" {
+		request.Header.Set("X-Scope-OrgID", processor.tenantID)
+	}
+
+	if processor.username != "" {
+		request.SetBasicAuth(processor.username, processor.password)
+	}
+
+	resp, err := processor.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Loki responds with HTTP 204 on success
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		responseBody, _ := io.ReadAll(resp.Body)
+
+		return fmt.Errorf("push request failed with HTTP %d: %s", resp.StatusCode, responseBody)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package loki_test
+
+import (
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/loki"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type pushRequest struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][]any           `json:"values"`
+	} `json:"streams"`
+}
+
+func newFakeLoki(t *testing.T) (*[]pushRequest, string) {
+	var pushRequests []pushRequest
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /loki/api/v1/push", func(writer http.ResponseWriter, request *http.Request) {
+		require.Equal(t, "cirrus", request.Header.Get("X-Scope-OrgID"))
+
+		username, password, ok := request.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "user", username)
+		require.Equal(t, "pass", password)
+
+		var pushRequest pushRequest
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&pushRequest))
+
+		pushRequests = append(pushRequests, pushRequest)
+
+		writer.WriteHeader(http.StatusNoContent)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &pushRequests, server.URL
+}
+
+func TestPush(t *testing.T) {
+	pushRequests, url := newFakeLoki(t)
+
+	processor, err := loki.NewProcessor(url, []string{"repository_owner", "status"}, true,
+		loki.WithTenantID("cirrus"), loki.WithBasicAuth("user", "pass"))
+	require.NoError(t, err)
+
+	body := testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "task", "task.json")
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "audit_event", "audit_event.json")
+
+	require.Len(t, *pushRequests, 2)
+
+	task := (*pushRequests)[0].Streams[0]
+	require.Equal(t, map[string]string{
+		"event_type":       "task",
+		"repository_owner": "edigaryev",
+		"status":           "EXECUTING",
+	}, task.Stream)
+	require.Len(t, task.Values, 1)
+	require.Equal(t, "1722408869403000000", task.Values[0][0])
+	require.Equal(t, string(body), task.Values[0][1])
+
+	metadata := task.Values[0][2].(map[string]any)
+	require.Equal(t, "awesome-system-calls", metadata["repository_name"])
+	require.Equal(t, "6017965227769856", metadata["task_id"])
+	require.Equal(t, "EXECUTING", metadata["task_status"])
+	require.NotContains(t, metadata, "repository_owner")
+	require.NotContains(t, metadata, "status")
+
+	auditEvent := (*pushRequests)[1].Streams[0]
+	require.Equal(t, map[string]string{
+		"event_type": "audit_event",
+	}, auditEvent.Stream)
+	require.Equal(t, "graphql.mutation", auditEvent.Values[0][2].(map[string]any)["type"])
+}
+
+func TestPushAuditEvent(t *testing.T) {
+	pushRequests, url := newFakeLoki(t)
+
+	processor, err := loki.NewProcessor(url, nil, true,
+		loki.WithTenantID("cirrus"), loki.WithBasicAuth("user", "pass"))
+	require.NoError(t, err)
+
+	body := testutil.Testdata(t, "audit_event.json", func(payload map[string]any) {
+		payload["data"] = `{"mutationName": "GenerateNewScopedAccessToken", ` +
+			`"repositoryNames": ["awesome-system-calls", "cirrus-cli"]}`
+	})
+
+	// The audit event's own timestamp is preferred over the delivery time
+	testutil.MustDeliver(t, processor.ProcessWebhookEvent, "audit_event", body,
+		testutil.WithTimestamp(time.Date(2024, 8, 2, 0, 0, 0, 0, time.UTC)))
+
+	auditEvent := (*pushRequests)[0].Streams[0]
+	require.Equal(t, "1722518406287000000", auditEvent.Values[0][0])
+
+	// Repeated tags are not lost
+	metadata := auditEvent.Values[0][2].(map[string]any)
+	require.Equal(t, "awesome-system-calls,cirrus-cli", metadata["data.repositoryName"])
+}
+
+func TestPushWithoutStructuredMetadata(t *testing.T) {
+	pushRequests, url := newFakeLoki(t)
+
+	processor, err := loki.NewProcessor(url, []string{"build_branch"}, false,
+		loki.WithTenantID("cirrus"), loki.WithBasicAuth("user", "pass"))
+	require.NoError(t, err)
+
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "build", "build.json")
+
+	build := (*pushRequests)[0].Streams[0]
+	require.Equal(t, map[string]string{
+		"event_type":   "build",
+		"build_branch": "main",
+	}, build.Stream)
+	require.Len(t, build.Values[0], 2)
+}
+
+func TestPushWithoutLabels(t *testing.T) {
+	pushRequests, url := newFakeLoki(t)
+
+	processor, err := loki.NewProcessor(url, nil, true,
+		loki.WithTenantID("cirrus"), loki.WithBasicAuth("user", "pass"))
+	require.NoError(t, err)
+
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "build", "build.json")
+
+	// Loki rejects the streams without labels
+	require.Equal(t, map[string]string{
+		"event_type": "build",
+	}, (*pushRequests)[0].Streams[0].Stream)
+}
+
+func TestInvalidLabel(t *testing.T) {
+	_, err := loki.NewProcessor("http://localhost:3100", []string{"repository-owner"}, true)
+	require.ErrorIs(t, err, loki.ErrLokiFailed)
+}
@@ -0,0 +1,257 @@
+package msteams
+
+import (
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"strings"
+)
+
+// Message is a message with an Adaptive Card attachment as expected
+// by the Microsoft Teams workflow webhooks[1].
+//
+// [1]: https://support.microsoft.com/en-us/office/create-incoming-webhooks-with-workflows-for-microsoft-teams-8ae491c7-0394-4861-ba59-055e33f75498
+type Message struct {
+	Type        string       `json:"type"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+type Attachment struct {
+	ContentType string `json:"contentType"`
+	Content     *Card  `json:"content"`
+}
+
+// Card is an Adaptive Card[1].
+//
+// [1]: https://adaptivecards.io/explorer/AdaptiveCard.html
+type Card struct {
+	Schema  string         `json:"$schema"`
+	Type    string         `json:"type"`
+	Version string         `json:"version"`
+	Body    []CardElement  `json:"body"`
+	Actions []CardAction   `json:"actions,omitempty"`
+	MSTeams map[string]any `json:"msteams,omitempty"`
+}
+
+type CardElement struct {
+	Type   string `json:"type"`
+	Text   string `json:"text,omitempty"`
+	Size   string `json:"size,omitempty"`
+	Weight string `json:"weight,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Wrap   bool   `json:"wrap,omitempty"`
+	Facts  []Fact `json:"facts,omitempty"`
+}
+
+type Fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type CardAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Layout configures which facts are shown on the card and how.
+type Layout struct {
+	// Facts are the names of the facts to show, in the order
+	// of appearance, the facts not applicable to the event
+	// or missing in the payload are skipped
+	Facts []string
+
+	// FullWidth makes the card span the whole width of the Teams channel
+	FullWidth bool
+}
+
+// DefaultFacts are the facts shown on the card by default.
+//
+//nolint:gochecknoglobals
+var DefaultFacts = []string{
+	"repository", "branch", "pull_request", "author", "commit", "task", "status",
+	"instance_type", "actor", "mutation", "repositories",
+}
+
+type cardContent struct {
+	title   string
+	color   string
+	facts   map[string]string
+	actions []CardAction
+}
+
+func NewBuildOrTaskMessage(presentedEventType string, payload *cirrus.BuildOrTask, layout Layout) *Message {
+	content := cardContent{
+		facts: map[string]string{},
+	}
+
+	repository := payload.RepositoryFullName()
+
+	var status string
+
+	if presentedEventType == "task" {
+		status = cirrus.ValueOr(payload.Task.Status, "UNKNOWN")
+		content.title = fmt.Sprintf("Task %q in %s is %s", cirrus.ValueOr(payload.Task.Name, "unknown"),
+			repository, strings.ToLower(status))
+		content.facts["task"] = cirrus.ValueOr(payload.Task.Name, "")
+		content.facts["instance_type"] = cirrus.ValueOr(payload.Task.InstanceType, "")
+
+		if value := payload.Task.ID; value != nil {
+			content.actions = append(content.actions, CardAction{
+				Type:  "Action.OpenUrl",
+				Title: "View task in Cirrus CI",
+				URL:   fmt.Sprintf("https://cirrus-ci.com/task/%d", *value),
+			})
+		}
+	} else {
+		status = cirrus.ValueOr(payload.Build.Status, "UNKNOWN")
+		content.title = fmt.Sprintf("Build %d in %s is %s", cirrus.ValueOr(payload.Build.ID, 0),
+			repository, strings.ToLower(status))
+	}
+
+	content.color = statusColor(status)
+	content.facts["status"] = status
+	content.facts["repository"] = repository
+	content.facts["branch"] = cirrus.ValueOr(payload.Build.Branch, "")
+	content.facts["author"] = cirrus.ValueOr(payload.Build.User.Username, "")
+	content.facts["commit"] = cirrus.ValueOr(payload.Build.ChangeMessageTitle, "")
+
+	if value := payload.Build.ID; value != nil {
+		content.actions = append(content.actions, CardAction{
+			Type:  "Action.OpenUrl",
+			Title: "View build in Cirrus CI",
+			URL:   fmt.Sprintf("https://cirrus-ci.com/build/%d", *value),
+		})
+	}
+
+	if value := payload.Build.PullRequest; value != nil && repository != "" {
+		content.facts["pull_request"] = fmt.Sprintf("#%d", *value)
+		content.actions = append(content.actions, CardAction{
+			Type:  "Action.OpenUrl",
+			Title: fmt.Sprintf("View PR #%d on GitHub", *value),
+			URL:   fmt.Sprintf("https://github.com/%s/pull/%d", repository, *value),
+		})
+	}
+
+	return content.message(layout)
+}
+
+func NewAuditEventMessage(payload *cirrus.AuditEvent, data cirrus.AuditEventData, layout Layout) *Message {
+	actor := cirrus.ValueOr(payload.Actor.Username, "api")
+
+	content := cardContent{
+		title: fmt.Sprintf("Audit event %q was %s by %s", cirrus.ValueOr(payload.Type, "unknown"),
+			cirrus.ValueOr(payload.Action, "created"), actor),
+		color: "Accent",
+		facts: map[string]string{
+			"repository": payload.RepositoryFullName(),
+			"actor":      actor,
+		},
+	}
+
+	if value := payload.ActorLocationIP; value != nil {
+		content.facts["actor"] = fmt.Sprintf("%s (%s)", actor, *value)
+	}
+
+	if data != nil {
+		content.facts["mutation"] = cirrus.ValueOr(data.Common().MutationName, "")
+
+		if tokenData, ok := data.(*cirrus.GenerateNewScopedAccessTokenData); ok {
+			content.facts["repositories"] = strings.Join(tokenData.RepositoryNames, ", ")
+		}
+
+		if value := data.Common().BuildID; value != nil {
+			content.actions = append(content.actions, CardAction{
+				Type:  "Action.OpenUrl",
+				Title: "View build in Cirrus CI",
+				URL:   fmt.Sprintf("https://cirrus-ci.com/build/%s", *value),
+			})
+		}
+
+		if value := data.Common().TaskID; value != nil {
+			content.actions = append(content.actions, CardAction{
+				Type:  "Action.OpenUrl",
+				Title: "View task in Cirrus CI",
+				URL:   fmt.Sprintf("https://cirrus-ci.com/task/%s", *value),
+			})
+		}
+	}
+
+	return content.message(layout)
+}
+
+func (content *cardContent) message(layout Layout) *Message {
+	var facts []Fact
+
+	for _, name := range layout.Facts {
+		if value := content.facts[name]; value != "" {
+			facts = append(facts, Fact{
+				Title: factTitle(name),
+				Value: value,
+			})
+		}
+	}
+
+	card := &Card{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body: []CardElement{
+			{
+				Type:   "TextBlock",
+				Text:   content.title,
+				Size:   "Medium",
+				Weight: "Bolder",
+				Color:  content.color,
+				Wrap:   true,
+			},
+		},
+		Actions: content.actions,
+	}
+
+	if len(facts) != 0 {
+		card.Body = append(card.Body, CardElement{
+			Type:  "FactSet",
+			Facts: facts,
+		})
+	}
+
+	if layout.FullWidth {
+		card.MSTeams = map[string]any{
+			"width": "Full",
+		}
+	}
+
+	return &Message{
+		Type: "message",
+		Attachments: []Attachment{
+			{
+				ContentType: "application/vnd.microsoft.card.adaptive",
+				Content:     card,
+			},
+		},
+	}
+}
+
+func factTitle(name string) string {
+	switch name {
+	case "pull_request":
+		return "Pull Request"
+	case "instance_type":
+		return "Instance Type"
+	default:
+		return strings.ToUpper(name[:1]) + name[1:]
+	}
+}
+
+func statusColor(status string) string {
+	switch status {
+	case "COMPLETED":
+		return "Good"
+	case "FAILED", "ERRORED":
+		return "Attention"
+	case "ABORTED":
+		return "Warning"
+	default:
+		return "Default"
+	}
+}
@@ -0,0 +1,162 @@
+package msteams
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/decoding"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"net/http"
+	"slices"
+)
+
+var webhookURL string
+var facts []string
+var fullWidth bool
+var statuses []string
+
+var (
+	ErrMSTeamsFailed = errors.New("failed to post Cirrus CI events to Microsoft Teams")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "msteams",
+		Short: "Post Cirrus CI webhook events to Microsoft Teams as Adaptive Cards",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+	decoding.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&webhookURL, "webhook-url", "",
+		"Microsoft Teams workflow webhook URL to post the Adaptive Cards to")
+	cmd.PersistentFlags().StringSliceVar(&facts, "facts", DefaultFacts,
+		"comma-separated list of the facts to show on the card, in the order of appearance")
+	cmd.PersistentFlags().BoolVar(&fullWidth, "full-width", false,
+		"make the card span the whole width of the Microsoft Teams channel")
+	cmd.PersistentFlags().StringSliceVar(&statuses, "statuses", []string{"FAILED", "ERRORED"},
+		"comma-separated list of the build and task statuses to post the cards for")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	if webhookURL == "" {
+		return fmt.Errorf("%w: \"--webhook-url\" is required", ErrMSTeamsFailed)
+	}
+
+	knownFacts := mapset.NewSet[string](DefaultFacts...)
+
+	for _, fact := range facts {
+		if !knownFacts.Contains(fact) {
+			return fmt.Errorf("%w: unknown fact %q, supported facts are: %s", ErrMSTeamsFailed,
+				fact, DefaultFacts)
+		}
+	}
+
+	processor := &Processor{
+		WebhookURL: webhookURL,
+		Layout: Layout{
+			Facts:     slices.Clone(facts),
+			FullWidth: fullWidth,
+		},
+		Statuses: mapset.NewSet[string](statuses...),
+	}
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+type Processor struct {
+	WebhookURL string
+	Layout     Layout
+
+	// Statuses are the build and task statuses to post the cards for
+	Statuses mapset.Set[string]
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	var message *Message
+
+	switch presentedEventType {
+	case "audit_event":
+		var payload cirrus.AuditEvent
+
+		if err := cirrus.Decode(body, &payload, decoding.Mode()); err != nil {
+			return fmt.Errorf("failed to parse the webhook event of type %q as JSON: %w",
+				presentedEventType, err)
+		}
+
+		data, err := payload.DecodeData(decoding.Mode())
+		if err != nil {
+			logger.Warnf("failed to unmarshal audit event's data: %v", err)
+		}
+
+		message = NewAuditEventMessage(&payload, data, processor.Layout)
+	case "build", "task":
+		var payload cirrus.BuildOrTask
+
+		if err := cirrus.Decode(body, &payload, decoding.Mode()); err != nil {
+			return fmt.Errorf("failed to parse the webhook event of type %q as JSON: %w",
+				presentedEventType, err)
+		}
+
+		// Only post the new statuses we're interested in,
+		// and not every update of the build or task
+		status := payload.Build.Status
+		if presentedEventType == "task" {
+			status = payload.Task.Status
+		}
+
+		if !payload.IsNewStatus(status) || !processor.Statuses.Contains(*status) {
+			logger.Debugf("skipping event of type %q because its status is not new or not interesting",
+				presentedEventType)
+
+			return nil
+		}
+
+		message = NewBuildOrTaskMessage(presentedEventType, &payload, processor.Layout)
+	default:
+		logger.Debugf("skipping event of type %q because we don't know how to render it",
+			presentedEventType)
+
+		return nil
+	}
+
+	messageJSON, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("%w: failed to marshal the message as JSON: %v", ErrMSTeamsFailed, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx.Request().Context(), http.MethodPost, processor.WebhookURL,
+		bytes.NewReader(messageJSON))
+	if err != nil {
+		return fmt.Errorf("%w: failed to create request: %v", ErrMSTeamsFailed, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to make request: %v", ErrMSTeamsFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: workflow webhook unexpectedly responded with HTTP %d",
+			ErrMSTeamsFailed, resp.StatusCode)
+	}
+
+	return nil
+}
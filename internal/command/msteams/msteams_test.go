@@ -0,0 +1,118 @@
+package msteams_test
+
+import (
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/msteams"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func process(t *testing.T, layout msteams.Layout, eventType string, body []byte) *msteams.Message {
+	messages := processAll(t, layout, eventType, body)
+	require.Len(t, messages, 1)
+	require.Equal(t, "message", messages[0].Type)
+	require.Len(t, messages[0].Attachments, 1)
+	require.Equal(t, "application/vnd.microsoft.card.adaptive", messages[0].Attachments[0].ContentType)
+
+	return messages[0]
+}
+
+func processAll(t *testing.T, layout msteams.Layout, eventType string, body []byte) []*msteams.Message {
+	var messages []*msteams.Message
+
+	workflow := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var message msteams.Message
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&message))
+		messages = append(messages, &message)
+
+		writer.WriteHeader(http.StatusAccepted)
+	}))
+	defer workflow.Close()
+
+	processor := &msteams.Processor{
+		WebhookURL: workflow.URL,
+		Layout:     layout,
+		Statuses:   mapset.NewSet("FAILED", "ERRORED"),
+	}
+
+	ctx := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+	require.NoError(t, processor.ProcessWebhookEvent(ctx, eventType, body, zap.S()))
+
+	return messages
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	body, err := os.ReadFile(filepath.Join("..", "..", "cirrus", "testdata", name))
+	require.NoError(t, err)
+
+	return body
+}
+
+func TestTaskCard(t *testing.T) {
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(readTestdata(t, "task.json"), &payload))
+	payload["build"].(map[string]any)["pullRequest"] = 7
+	payload["task"].(map[string]any)["status"] = "FAILED"
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	message := process(t, msteams.Layout{Facts: msteams.DefaultFacts, FullWidth: true}, "task", body)
+	card := message.Attachments[0].Content
+
+	require.Equal(t, "AdaptiveCard", card.Type)
+	require.Equal(t, map[string]any{"width": "Full"}, card.MSTeams)
+	require.Equal(t, "Task \"Lint (cargo fmt)\" in edigaryev/awesome-system-calls is failed", card.Body[0].Text)
+	require.Equal(t, []msteams.Fact{
+		{Title: "Repository", Value: "edigaryev/awesome-system-calls"},
+		{Title: "Branch", Value: "main"},
+		{Title: "Pull Request", Value: "#7"},
+		{Title: "Author", Value: "edigaryev"},
+		{Title: "Commit", Value: "Periodic update (#7)"},
+		{Title: "Task", Value: "Lint (cargo fmt)"},
+		{Title: "Status", Value: "FAILED"},
+		{Title: "Instance Type", Value: "CommunityContainer"},
+	}, card.Body[1].Facts)
+	require.Equal(t, []msteams.CardAction{
+		{Type: "Action.OpenUrl", Title: "View task in Cirrus CI", URL: "https://cirrus-ci.com/task/6017965227769856"},
+		{Type: "Action.OpenUrl", Title: "View build in Cirrus CI", URL: "https://cirrus-ci.com/build/5082236150611968"},
+		{Type: "Action.OpenUrl", Title: "View PR #7 on GitHub", URL: "https://github.com/edigaryev/awesome-system-calls/pull/7"},
+	}, card.Actions)
+}
+
+func TestSkipsUninterestingStatuses(t *testing.T) {
+	// Executing task is not interesting
+	require.Empty(t, processAll(t, msteams.Layout{Facts: msteams.DefaultFacts}, "task",
+		readTestdata(t, "task.json")))
+
+	// Failed task which status didn't change was already posted
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(readTestdata(t, "task.json"), &payload))
+	payload["task"].(map[string]any)["status"] = "FAILED"
+	payload["action"] = "updated"
+	payload["old_status"] = "FAILED"
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	require.Empty(t, processAll(t, msteams.Layout{Facts: msteams.DefaultFacts}, "task", body))
+}
+
+func TestAuditEventCard(t *testing.T) {
+	message := process(t, msteams.Layout{Facts: []string{"mutation", "repositories", "actor"}},
+		"audit_event", readTestdata(t, "audit_event.json"))
+	card := message.Attachments[0].Content
+
+	require.Nil(t, card.MSTeams)
+	require.Equal(t, "Audit event \"graphql.mutation\" was created by edigaryev", card.Body[0].Text)
+	require.Equal(t, []msteams.Fact{
+		{Title: "Mutation", Value: "GenerateNewScopedAccessToken"},
+		{Title: "Repositories", Value: "awesome-system-calls"},
+		{Title: "Actor", Value: "edigaryev (1.2.3.4)"},
+	}, card.Body[1].Facts)
+}
@@ -0,0 +1,180 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cloudevents"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/labstack/echo/v4"
+	natspkg "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+var natsURL string
+var credsFile string
+var subjectPrefix string
+var stream string
+var format string
+
+var (
+	ErrNATSFailed = errors.New("failed to publish Cirrus CI events to NATS")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "nats",
+		Short: "Publish Cirrus CI webhook events to NATS JetStream",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&natsURL, "url", natspkg.DefaultURL,
+		"comma-separated list of the NATS server URLs to connect to")
+	cmd.PersistentFlags().StringVar(&credsFile, "creds-file", "",
+		"NATS user credentials file to authenticate with")
+	cmd.PersistentFlags().StringVar(&subjectPrefix, "subject-prefix", "cirrus",
+		"prefix of the subjects to publish the webhook events to, the resulting subjects are in the "+
+			"\"<prefix>.<event type>.<owner>.<repository>.<status>\" format")
+	cmd.PersistentFlags().StringVar(&stream, "stream", "",
+		"if specified, a JetStream stream with this name capturing the \"<prefix>.>\" subjects "+
+			"will be created, otherwise such stream is expected to already exist")
+	cmd.PersistentFlags().StringVar(&format, "format", string(cloudevents.FormatRaw),
+		"message format: \"raw\" for the webhook event's body as is, \"cloudevents-structured\" or "+
+			"\"cloudevents-binary\" for the CloudEvents in the structured or binary content mode")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	parsedFormat, err := cloudevents.ParseFormat(format)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNATSFailed, err)
+	}
+
+	var opts []natspkg.Option
+
+	if credsFile != "" {
+		opts = append(opts, natspkg.UserCredentials(credsFile))
+	}
+
+	nc, err := natspkg.Connect(natsURL, opts...)
+	if err != nil {
+		return fmt.Errorf("%w: failed to connect to NATS: %v", ErrNATSFailed, err)
+	}
+	defer nc.Close()
+
+	processor, err := NewProcessor(cmd.Context(), nc, subjectPrefix, stream, parsedFormat)
+	if err != nil {
+		return err
+	}
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+type Processor struct {
+	js            jetstream.JetStream
+	subjectPrefix string
+	format        cloudevents.Format
+}
+
+// NewProcessor creates a JetStream publisher, creating (or updating)
+// the stream capturing the "<prefix>.>" subjects if the stream name is specified.
+func NewProcessor(
+	ctx context.Context,
+	nc *natspkg.Conn,
+	subjectPrefix string,
+	stream string,
+	format cloudevents.Format,
+) (*Processor, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to initialize JetStream: %v", ErrNATSFailed, err)
+	}
+
+	if stream != "" {
+		if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+			Name:     stream,
+			Subjects: []string{subjectPrefix + ".>"},
+		}); err != nil {
+			return nil, fmt.Errorf("%w: failed to create or update stream %q: %v",
+				ErrNATSFailed, stream, err)
+		}
+	}
+
+	return &Processor{
+		js:            js,
+		subjectPrefix: subjectPrefix,
+		format:        format,
+	}, nil
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	var payload cirrus.BuildOrTask
+
+	if err := cirrus.Decode(body, &payload, cirrus.DecodingModeLenient); err != nil {
+		return fmt.Errorf("%w: %v", ErrNATSFailed, err)
+	}
+
+	event, err := cloudevents.New(ctx.Request().Header, presentedEventType, body, nil, logger)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNATSFailed, err)
+	}
+
+	msg := &natspkg.Msg{
+		Subject: Subject(processor.subjectPrefix, presentedEventType, &payload),
+		Header:  natspkg.Header{},
+		Data:    body,
+	}
+
+	// Carry the Cirrus CI headers
+	for key := range ctx.Request().Header {
+		if strings.HasPrefix(key, "X-Cirrus-") {
+			msg.Header.Set(key, ctx.Request().Header.Get(key))
+		}
+	}
+
+	// NATS protocol binding for CloudEvents[1] mirrors the HTTP one,
+	// except that NATS headers are case-sensitive and the binding expects
+	// the attributes to be spelled in lowercase (e.g. "ce-type")
+	//
+	// [1]: https://github.com/cloudevents/spec/blob/main/cloudevents/bindings/nats-protocol-binding.md
+	var encodedHeader http.Header
+
+	if mode, ok := processor.format.Mode(); ok {
+		encodedHeader, msg.Data, err = event.Encode(mode)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNATSFailed, err)
+	}
+
+	for key, values := range encodedHeader {
+		if strings.HasPrefix(key, "Ce-") {
+			key = strings.ToLower(key)
+		}
+
+		msg.Header[key] = values
+	}
+
+	// Re-deliveries of the same event will be de-duplicated by the JetStream, and only
+	// respond to Cirrus CI once the event is durably stored, so that Cirrus CI
+	// re-delivers it otherwise
+	if _, err := processor.js.PublishMsg(ctx.Request().Context(), msg,
+		jetstream.WithMsgID(event.ID)); err != nil {
+		return fmt.Errorf("%w: %v", ErrNATSFailed, err)
+	}
+
+	return nil
+}
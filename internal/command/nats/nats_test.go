@@ -0,0 +1,108 @@
+package nats_test
+
+import (
+	"context"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cloudevents"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/nats"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	natspkg "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T) *natspkg.Conn {
+	natsServer, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.NoError(t, err)
+
+	natsServer.Start()
+	t.Cleanup(natsServer.Shutdown)
+	require.True(t, natsServer.ReadyForConnections(10*time.Second))
+
+	nc, err := natspkg.Connect(natsServer.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	return nc
+}
+
+func TestPublish(t *testing.T) {
+	nc := startServer(t)
+	ctx := context.Background()
+
+	processor, err := nats.NewProcessor(ctx, nc, "cirrus", "CIRRUS", cloudevents.FormatRaw)
+	require.NoError(t, err)
+
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "task", "task.json")
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "audit_event", "audit_event.json")
+
+	// Re-delivery of the same event should be de-duplicated
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "task", "task.json")
+
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+
+	stream, err := js.Stream(ctx, "CIRRUS")
+	require.NoError(t, err)
+
+	info, err := stream.Info(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, info.State.Msgs)
+
+	task, err := stream.GetLastMsgForSubject(ctx, "cirrus.task.*.*.EXECUTING")
+	require.NoError(t, err)
+	require.Equal(t, "cirrus.task.edigaryev.awesome-system-calls.EXECUTING", task.Subject)
+	require.Equal(t, "task", task.Header.Get("X-Cirrus-Event"))
+	require.Contains(t, string(task.Data), `"name": "Lint (cargo fmt)"`)
+
+	auditEvent, err := stream.GetLastMsgForSubject(ctx, "cirrus.audit_event.>")
+	require.NoError(t, err)
+	require.Equal(t, "cirrus.audit_event.none.none.none", auditEvent.Subject)
+}
+
+func TestPublishCloudEvents(t *testing.T) {
+	nc := startServer(t)
+	ctx := context.Background()
+
+	processor, err := nats.NewProcessor(ctx, nc, "ci", "CI", cloudevents.FormatCloudEventsBinary)
+	require.NoError(t, err)
+
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "build", "build.json")
+
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+
+	stream, err := js.Stream(ctx, "CI")
+	require.NoError(t, err)
+
+	build, err := stream.GetLastMsgForSubject(ctx, "ci.build.>")
+	require.NoError(t, err)
+	require.Equal(t, "ci.build.edigaryev.awesome-system-calls.EXECUTING", build.Subject)
+	require.Equal(t, "com.cirrus-ci.build.updated", build.Header.Get("ce-type"))
+}
+
+func TestSubject(t *testing.T) {
+	owner := "some.owner"
+	name := "repo>with*wildcards"
+	status := "FAILED"
+
+	var payload cirrus.BuildOrTask
+	payload.Repository.Owner = &owner
+	payload.Repository.Name = &name
+	payload.Task.Status = &status
+
+	require.Equal(t, "cirrus.task.some_owner.repo_with_wildcards.FAILED",
+		nats.Subject("cirrus", "task", &payload))
+	require.Equal(t, "cirrus.build.some_owner.repo_with_wildcards.none",
+		nats.Subject("cirrus", "build", &payload))
+}
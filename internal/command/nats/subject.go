@@ -0,0 +1,47 @@
+package nats
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"strings"
+)
+
+// Subject returns a subject in the "<prefix>.<event type>.<owner>.<repository>.<status>" format,
+// so that the consumers can subscribe using wildcards, for example, "cirrus.task.*.*.FAILED".
+//
+// Values missing in the payload are substituted with "none".
+func Subject(prefix string, presentedEventType string, payload *cirrus.BuildOrTask) string {
+	var status *string
+
+	switch presentedEventType {
+	case "task":
+		status = payload.Task.Status
+	case "build":
+		status = payload.Build.Status
+	}
+
+	return strings.Join([]string{
+		prefix,
+		token(&presentedEventType),
+		token(payload.Repository.Owner),
+		token(payload.Repository.Name),
+		token(status),
+	}, ".")
+}
+
+// token makes sure that the value can be used as a single subject token[1].
+//
+// [1]: https://docs.nats.io/nats-concepts/subjects#characters-allowed-and-recommended-for-subject-names
+func token(value *string) string {
+	if value == nil || *value == "" {
+		return "none"
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		default:
+			return r
+		}
+	}, *value)
+}
@@ -0,0 +1,126 @@
+package otel
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log"
+)
+
+func repositoryAttributes(payload *cirrus.BuildOrTask) []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+
+	attributes = appendString(attributes, "cirrus.repository.owner", payload.Repository.Owner)
+	attributes = appendString(attributes, "cirrus.repository.name", payload.Repository.Name)
+	attributes = appendInt(attributes, "cirrus.repository.id", payload.Repository.ID)
+
+	return attributes
+}
+
+func buildAttributes(payload *cirrus.BuildOrTask) []attribute.KeyValue {
+	return append(repositoryAttributes(payload), buildFieldAttributes(payload)...)
+}
+
+func taskAttributes(payload *cirrus.BuildOrTask) []attribute.KeyValue {
+	attributes := repositoryAttributes(payload)
+
+	attributes = appendInt(attributes, "cirrus.build.id", payload.Build.ID)
+	attributes = appendString(attributes, "cirrus.build.branch", payload.Build.Branch)
+
+	return append(attributes, taskFieldAttributes(payload)...)
+}
+
+// eventAttributes describes the webhook event itself, the repository is omitted
+// since it's described by the resource attributes of the log records.
+func eventAttributes(presentedEventType string, payload *cirrus.BuildOrTask) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attribute.String("cirrus.event_type", presentedEventType),
+	}
+
+	attributes = appendString(attributes, "cirrus.action", payload.Action)
+	attributes = appendString(attributes, "cirrus.type", payload.Type)
+	attributes = appendString(attributes, "cirrus.actor.username", payload.Actor.Username)
+	attributes = appendString(attributes, "cirrus.old_status", payload.OldStatus)
+
+	attributes = append(attributes, buildFieldAttributes(payload)...)
+
+	return append(attributes, taskFieldAttributes(payload)...)
+}
+
+func buildFieldAttributes(payload *cirrus.BuildOrTask) []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+
+	attributes = appendInt(attributes, "cirrus.build.id", payload.Build.ID)
+	attributes = appendString(attributes, "cirrus.build.status", payload.Build.Status)
+	attributes = appendString(attributes, "cirrus.build.branch", payload.Build.Branch)
+	attributes = appendString(attributes, "cirrus.build.change_id", payload.Build.ChangeIDInRepo)
+	attributes = appendString(attributes, "cirrus.build.change_message_title", payload.Build.ChangeMessageTitle)
+	attributes = appendInt(attributes, "cirrus.build.pull_request", payload.Build.PullRequest)
+	attributes = appendString(attributes, "cirrus.build.user", payload.Build.User.Username)
+
+	return attributes
+}
+
+func taskFieldAttributes(payload *cirrus.BuildOrTask) []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+
+	attributes = appendInt(attributes, "cirrus.task.id", payload.Task.ID)
+	attributes = appendString(attributes, "cirrus.task.name", payload.Task.Name)
+	attributes = appendString(attributes, "cirrus.task.name_alias", payload.Task.NameAlias)
+	attributes = appendString(attributes, "cirrus.task.status", payload.Task.Status)
+	attributes = appendString(attributes, "cirrus.task.instance_type", payload.Task.InstanceType)
+	attributes = appendInt(attributes, "cirrus.task.manual_rerun_count", payload.Task.ManualRerunCount)
+	attributes = appendBool(attributes, "cirrus.task.automatic_re_run", payload.Task.AutomaticReRun)
+
+	if len(payload.Task.UniqueLabels) != 0 {
+		attributes = append(attributes, attribute.StringSlice("cirrus.task.labels", payload.Task.UniqueLabels))
+	}
+
+	return attributes
+}
+
+func appendString(attributes []attribute.KeyValue, key string, value *string) []attribute.KeyValue {
+	if value == nil {
+		return attributes
+	}
+
+	return append(attributes, attribute.String(key, *value))
+}
+
+func appendInt(attributes []attribute.KeyValue, key string, value *int64) []attribute.KeyValue {
+	if value == nil {
+		return attributes
+	}
+
+	return append(attributes, attribute.Int64(key, *value))
+}
+
+func appendBool(attributes []attribute.KeyValue, key string, value *bool) []attribute.KeyValue {
+	if value == nil {
+		return attributes
+	}
+
+	return append(attributes, attribute.Bool(key, *value))
+}
+
+// logKeyValue converts the attribute to the log attribute,
+// which only needs to support the types used above.
+func logKeyValue(kv attribute.KeyValue) log.KeyValue {
+	key := string(kv.Key)
+
+	switch kv.Value.Type() {
+	case attribute.BOOL:
+		return log.Bool(key, kv.Value.AsBool())
+	case attribute.INT64:
+		return log.Int64(key, kv.Value.AsInt64())
+	case attribute.STRINGSLICE:
+		var values []log.Value
+
+		for _, value := range kv.Value.AsStringSlice() {
+			values = append(values, log.StringValue(value))
+		}
+
+		return log.Slice(key, values...)
+	default:
+		return log.String(key, kv.Value.Emit())
+	}
+}
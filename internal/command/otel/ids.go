@@ -0,0 +1,85 @@
+package otel
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"go.opentelemetry.io/otel/trace"
+	"strconv"
+)
+
+type idsKey struct{}
+
+type ids struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+// idGenerator hands out the trace and span IDs attached to the context
+// with withIDs, falling back to the random IDs otherwise.
+//
+// This lets the task spans reference the build's root span before the latter
+// is even started, and makes the spans of the re-delivered events to have
+// the same IDs, so that the tracing backends could de-duplicate them.
+type idGenerator struct{}
+
+func withIDs(ctx context.Context, traceID trace.TraceID, spanID trace.SpanID) context.Context {
+	return context.WithValue(ctx, idsKey{}, ids{traceID: traceID, spanID: spanID})
+}
+
+func (idGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if ids, ok := ctx.Value(idsKey{}).(ids); ok {
+		return ids.traceID, ids.spanID
+	}
+
+	var traceID trace.TraceID
+	_, _ = rand.Read(traceID[:])
+
+	return traceID, randomSpanID()
+}
+
+func (idGenerator) NewSpanID(ctx context.Context, _ trace.TraceID) trace.SpanID {
+	if ids, ok := ctx.Value(idsKey{}).(ids); ok {
+		return ids.spanID
+	}
+
+	return randomSpanID()
+}
+
+func randomSpanID() trace.SpanID {
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+
+	return spanID
+}
+
+// BuildTraceID returns the ID of the trace representing the Cirrus CI build.
+func BuildTraceID(buildID int64) trace.TraceID {
+	var traceID trace.TraceID
+
+	copy(traceID[:], digest("build", buildID))
+
+	return traceID
+}
+
+func buildSpanID(buildID int64) trace.SpanID {
+	var spanID trace.SpanID
+
+	copy(spanID[:], digest("build-span", buildID))
+
+	return spanID
+}
+
+func taskSpanID(taskID int64) trace.SpanID {
+	var spanID trace.SpanID
+
+	copy(spanID[:], digest("task-span", taskID))
+
+	return spanID
+}
+
+func digest(kind string, id int64) []byte {
+	sum := sha256.Sum256([]byte(kind + ":" + strconv.FormatInt(id, 10)))
+
+	return sum[:]
+}
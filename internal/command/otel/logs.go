@@ -0,0 +1,97 @@
+package otel
+
+import (
+	"context"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"time"
+)
+
+// maxLoggers is how many repositories' logger providers are kept around,
+// the least recently used ones are re-created when their repository shows up again.
+const maxLoggers = 1024
+
+// logs emits every webhook event as a log record. The repository is
+// the resource emitting the log records, so we keep a logger provider
+// per repository, all of which share the same log processor.
+type logs struct {
+	logProcessor sdklog.Processor
+	baseResource *resource.Resource
+
+	loggers *lru.Cache[string, log.Logger]
+}
+
+func newLogs(logProcessor sdklog.Processor, baseResource *resource.Resource) (*logs, error) {
+	loggers, err := lru.New[string, log.Logger](maxLoggers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logs{
+		logProcessor: logProcessor,
+		baseResource: baseResource,
+		loggers:      loggers,
+	}, nil
+}
+
+func (logs *logs) emit(
+	ctx context.Context,
+	presentedEventType string,
+	eventTime time.Time,
+	body []byte,
+	payload *cirrus.BuildOrTask,
+) error {
+	logger, err := logs.logger(payload)
+	if err != nil {
+		return err
+	}
+
+	var record log.Record
+
+	record.SetTimestamp(eventTime)
+	record.SetObservedTimestamp(time.Now())
+	record.SetBody(log.StringValue(string(body)))
+
+	if cirrus.IsFailedStatus(payload.Build.Status) || cirrus.IsFailedStatus(payload.Task.Status) {
+		record.SetSeverity(log.SeverityError)
+		record.SetSeverityText("ERROR")
+	} else {
+		record.SetSeverity(log.SeverityInfo)
+		record.SetSeverityText("INFO")
+	}
+
+	for _, kv := range eventAttributes(presentedEventType, payload) {
+		record.AddAttributes(logKeyValue(kv))
+	}
+
+	logger.Emit(ctx, record)
+
+	return nil
+}
+
+func (logs *logs) logger(payload *cirrus.BuildOrTask) (log.Logger, error) {
+	fullName := payload.RepositoryFullName()
+
+	if logger, ok := logs.loggers.Get(fullName); ok {
+		return logger, nil
+	}
+
+	res, err := resource.Merge(logs.baseResource, resource.NewSchemaless(repositoryAttributes(payload)...))
+	if err != nil {
+		return nil, err
+	}
+
+	// Note that we never shut down these logger providers, since that would
+	// shut down the shared log processor, which is shut down directly instead
+	logger := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(logs.logProcessor),
+	).Logger(instrumentationName)
+
+	logs.loggers.Add(fullName, logger)
+
+	return logger, nil
+}
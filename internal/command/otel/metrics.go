@@ -0,0 +1,115 @@
+package otel
+
+import (
+	"context"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Bucket boundaries (in seconds) that fit the typical CI build and task durations
+var durationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200, 14400}
+
+type metrics struct {
+	events             metric.Int64Counter
+	buildStatusUpdates metric.Int64Counter
+	taskStatusUpdates  metric.Int64Counter
+	buildDuration      metric.Float64Histogram
+	taskDuration       metric.Float64Histogram
+}
+
+func newMetrics(meter metric.Meter) (*metrics, error) {
+	var metrics metrics
+	var err error
+
+	metrics.events, err = meter.Int64Counter("cirrus.webhook.events",
+		metric.WithDescription("Number of the received webhook events"),
+		metric.WithUnit("{event}"))
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.buildStatusUpdates, err = meter.Int64Counter("cirrus.build.status_updates",
+		metric.WithDescription("Number of times the builds got a new status"),
+		metric.WithUnit("{update}"))
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.taskStatusUpdates, err = meter.Int64Counter("cirrus.task.status_updates",
+		metric.WithDescription("Number of times the tasks got a new status"),
+		metric.WithUnit("{update}"))
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.buildDuration, err = meter.Float64Histogram("cirrus.build.duration",
+		metric.WithDescription("Duration of the finished builds"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.taskDuration, err = meter.Float64Histogram("cirrus.task.duration",
+		metric.WithDescription("Duration of the finished tasks"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &metrics, nil
+}
+
+func (metrics *metrics) record(ctx context.Context, presentedEventType string, payload *cirrus.BuildOrTask) {
+	attributes := repositoryMetricAttributes(payload)
+
+	eventAttributes := append([]attribute.KeyValue{
+		attribute.String("cirrus.event_type", presentedEventType),
+	}, attributes...)
+	eventAttributes = appendString(eventAttributes, "cirrus.action", payload.Action)
+
+	metrics.events.Add(ctx, 1, metric.WithAttributes(eventAttributes...))
+
+	switch presentedEventType {
+	case "build":
+		if !payload.IsNewStatus(payload.Build.Status) {
+			return
+		}
+
+		attributes = append(attributes, attribute.String("cirrus.build.status", *payload.Build.Status))
+
+		metrics.buildStatusUpdates.Add(ctx, 1, metric.WithAttributes(attributes...))
+
+		if cirrus.IsFinalBuildStatus(payload.Build.Status) && payload.Build.DurationInSeconds != nil {
+			metrics.buildDuration.Record(ctx, float64(*payload.Build.DurationInSeconds),
+				metric.WithAttributes(attributes...))
+		}
+	case "task":
+		if !payload.IsNewStatus(payload.Task.Status) {
+			return
+		}
+
+		attributes = append(attributes, attribute.String("cirrus.task.status", *payload.Task.Status))
+		attributes = appendString(attributes, "cirrus.task.instance_type", payload.Task.InstanceType)
+
+		metrics.taskStatusUpdates.Add(ctx, 1, metric.WithAttributes(attributes...))
+
+		if cirrus.IsFinalTaskStatus(payload.Task.Status) && payload.Task.DurationInSeconds != nil {
+			metrics.taskDuration.Record(ctx, float64(*payload.Task.DurationInSeconds),
+				metric.WithAttributes(attributes...))
+		}
+	}
+}
+
+// repositoryMetricAttributes omits the repository ID, which
+// would only duplicate the owner and name as yet another label.
+func repositoryMetricAttributes(payload *cirrus.BuildOrTask) []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+
+	attributes = appendString(attributes, "cirrus.repository.owner", payload.Repository.Owner)
+	attributes = appendString(attributes, "cirrus.repository.name", payload.Repository.Name)
+
+	return attributes
+}
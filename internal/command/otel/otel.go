@@ -0,0 +1,352 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const instrumentationName = "github.com/cirruslabs/cirrus-webhooks-server"
+
+var protocol string
+var endpoint string
+var signals []string
+var serviceName string
+var stateTTL time.Duration
+
+var (
+	ErrOTelFailed = errors.New("failed to export Cirrus CI events to OpenTelemetry")
+)
+
+type Protocol string
+
+const (
+	ProtocolHTTP Protocol = "http/protobuf"
+	ProtocolGRPC Protocol = "grpc"
+)
+
+const (
+	SignalTraces  = "traces"
+	SignalLogs    = "logs"
+	SignalMetrics = "metrics"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "otel",
+		Short: "Export Cirrus CI webhook events as OpenTelemetry traces, logs and metrics",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&protocol, "protocol", string(ProtocolHTTP),
+		"OTLP protocol to export with: \"http/protobuf\" or \"grpc\"")
+	cmd.PersistentFlags().StringVar(&endpoint, "endpoint", "",
+		"OTLP endpoint URL to export to (for example, http://localhost:4318), "+
+			"if not specified, the standard OTEL_EXPORTER_OTLP_* environment variables are used")
+	cmd.PersistentFlags().StringSliceVar(&signals, "signals", []string{SignalTraces, SignalLogs, SignalMetrics},
+		"comma-separated list of the signals to export: \"traces\", \"logs\" and/or \"metrics\"")
+	cmd.PersistentFlags().StringVar(&serviceName, "service-name", "cirrus-ci",
+		"\"service.name\" resource attribute of the exported telemetry")
+	cmd.PersistentFlags().DurationVar(&stateTTL, "state-ttl", 24*time.Hour,
+		"forget about the builds that had no events for this long, "+
+			"for example, because their final event was missed")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	switch Protocol(protocol) {
+	case ProtocolHTTP, ProtocolGRPC:
+		// valid protocol
+	default:
+		return fmt.Errorf("%w: unsupported protocol %q, please specify either %q or %q",
+			ErrOTelFailed, protocol, ProtocolHTTP, ProtocolGRPC)
+	}
+
+	opts := []Option{
+		WithStateTTL(stateTTL),
+	}
+
+	for _, signal := range signals {
+		switch signal {
+		case SignalTraces:
+			spanExporter, err := NewSpanExporter(cmd.Context(), Protocol(protocol), endpoint)
+			if err != nil {
+				return fmt.Errorf("%w: failed to create span exporter: %v", ErrOTelFailed, err)
+			}
+
+			opts = append(opts, WithSpanProcessor(sdktrace.NewBatchSpanProcessor(spanExporter)))
+		case SignalLogs:
+			logExporter, err := NewLogExporter(cmd.Context(), Protocol(protocol), endpoint)
+			if err != nil {
+				return fmt.Errorf("%w: failed to create log exporter: %v", ErrOTelFailed, err)
+			}
+
+			opts = append(opts, WithLogProcessor(sdklog.NewBatchProcessor(logExporter)))
+		case SignalMetrics:
+			metricExporter, err := NewMetricExporter(cmd.Context(), Protocol(protocol), endpoint)
+			if err != nil {
+				return fmt.Errorf("%w: failed to create metric exporter: %v", ErrOTelFailed, err)
+			}
+
+			opts = append(opts, WithMetricReader(sdkmetric.NewPeriodicReader(metricExporter)))
+		default:
+			return fmt.Errorf("%w: unsupported signal %q, please specify %q, %q and/or %q",
+				ErrOTelFailed, signal, SignalTraces, SignalLogs, SignalMetrics)
+		}
+	}
+
+	processor, err := NewProcessor(serviceName, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Flush the remaining telemetry even though the command's context is already cancelled
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := processor.Shutdown(shutdownCtx); err != nil {
+			zap.S().Warnf("failed to flush the remaining telemetry: %v", err)
+		}
+	}()
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+// NewSpanExporter creates an OTLP span exporter. The endpoint, when not empty,
+// is a base URL, just like the OTEL_EXPORTER_OTLP_ENDPOINT environment variable.
+func NewSpanExporter(ctx context.Context, protocol Protocol, endpoint string) (sdktrace.SpanExporter, error) {
+	if protocol == ProtocolGRPC {
+		var opts []otlptracegrpc.Option
+
+		if endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(endpoint))
+		}
+
+		return otlptracegrpc.New(ctx, opts...)
+	}
+
+	var opts []otlptracehttp.Option
+
+	if endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(signalURL(endpoint, SignalTraces)))
+	}
+
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// NewLogExporter creates an OTLP log exporter, see NewSpanExporter.
+func NewLogExporter(ctx context.Context, protocol Protocol, endpoint string) (sdklog.Exporter, error) {
+	if protocol == ProtocolGRPC {
+		var opts []otlploggrpc.Option
+
+		if endpoint != "" {
+			opts = append(opts, otlploggrpc.WithEndpointURL(endpoint))
+		}
+
+		return otlploggrpc.New(ctx, opts...)
+	}
+
+	var opts []otlploghttp.Option
+
+	if endpoint != "" {
+		opts = append(opts, otlploghttp.WithEndpointURL(signalURL(endpoint, SignalLogs)))
+	}
+
+	return otlploghttp.New(ctx, opts...)
+}
+
+// NewMetricExporter creates an OTLP metric exporter, see NewSpanExporter.
+func NewMetricExporter(ctx context.Context, protocol Protocol, endpoint string) (sdkmetric.Exporter, error) {
+	if protocol == ProtocolGRPC {
+		var opts []otlpmetricgrpc.Option
+
+		if endpoint != "" {
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(endpoint))
+		}
+
+		return otlpmetricgrpc.New(ctx, opts...)
+	}
+
+	var opts []otlpmetrichttp.Option
+
+	if endpoint != "" {
+		opts = append(opts, otlpmetrichttp.WithEndpointURL(signalURL(endpoint, SignalMetrics)))
+	}
+
+	return otlpmetrichttp.New(ctx, opts...)
+}
+
+// signalURL appends the signal-specific path to the base URL, since the OTLP/HTTP
+// exporters take the endpoint URL's path as is, unlike the environment variable.
+func signalURL(endpoint string, signal string) string {
+	return strings.TrimSuffix(endpoint, "/") + "/v1/" + signal
+}
+
+type Option func(*Processor)
+
+// WithSpanProcessor makes the processor emit the builds and tasks as spans
+// to the span processor, which is responsible for exporting them.
+func WithSpanProcessor(spanProcessor sdktrace.SpanProcessor) Option {
+	return func(processor *Processor) {
+		processor.spanProcessor = spanProcessor
+	}
+}
+
+// WithLogProcessor makes the processor emit every webhook event
+// as a log record to the log processor.
+func WithLogProcessor(logProcessor sdklog.Processor) Option {
+	return func(processor *Processor) {
+		processor.logProcessor = logProcessor
+	}
+}
+
+// WithMetricReader makes the processor record the metrics
+// about the builds and tasks to be collected by the reader.
+func WithMetricReader(metricReader sdkmetric.Reader) Option {
+	return func(processor *Processor) {
+		processor.metricReader = metricReader
+	}
+}
+
+// WithStateTTL overrides how long to remember about the builds that had no events.
+func WithStateTTL(stateTTL time.Duration) Option {
+	return func(processor *Processor) {
+		processor.stateTTL = stateTTL
+	}
+}
+
+type Processor struct {
+	spanProcessor sdktrace.SpanProcessor
+	logProcessor  sdklog.Processor
+	metricReader  sdkmetric.Reader
+	stateTTL      time.Duration
+
+	tracerProvider *sdktrace.TracerProvider
+	traces         *traces
+
+	logs *logs
+
+	meterProvider *sdkmetric.MeterProvider
+	metrics       *metrics
+}
+
+func NewProcessor(serviceName string, opts ...Option) (*Processor, error) {
+	processor := &Processor{
+		stateTTL: 24 * time.Hour,
+	}
+
+	for _, opt := range opts {
+		opt(processor)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create resource: %v", ErrOTelFailed, err)
+	}
+
+	if processor.spanProcessor != nil {
+		processor.tracerProvider = sdktrace.NewTracerProvider(
+			sdktrace.WithResource(res),
+			sdktrace.WithIDGenerator(idGenerator{}),
+			sdktrace.WithSpanProcessor(processor.spanProcessor),
+		)
+		processor.traces = newTraces(processor.tracerProvider.Tracer(instrumentationName), processor.stateTTL)
+	}
+
+	if processor.logProcessor != nil {
+		processor.logs, err = newLogs(processor.logProcessor, res)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to create logs: %v", ErrOTelFailed, err)
+		}
+	}
+
+	if processor.metricReader != nil {
+		processor.meterProvider = sdkmetric.NewMeterProvider(
+			sdkmetric.WithResource(res),
+			sdkmetric.WithReader(processor.metricReader),
+		)
+
+		processor.metrics, err = newMetrics(processor.meterProvider.Meter(instrumentationName))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to create metrics: %v", ErrOTelFailed, err)
+		}
+	}
+
+	return processor, nil
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	// Audit events are decoded leniently too, to get their
+	// common fields, such as the actor and the repository
+	var payload cirrus.BuildOrTask
+
+	if err := cirrus.Decode(body, &payload, cirrus.DecodingModeLenient); err != nil {
+		return fmt.Errorf("%w: %v", ErrOTelFailed, err)
+	}
+
+	eventTime := cirrus.EventTime(ctx.Request().Header, logger, payload.Timestamp, payload.Task.StatusTimestamp)
+
+	if processor.traces != nil && (presentedEventType == "build" || presentedEventType == "task") {
+		processor.traces.process(ctx.Request().Context(), presentedEventType, eventTime, &payload)
+	}
+
+	if processor.logs != nil {
+		if err := processor.logs.emit(ctx.Request().Context(), presentedEventType, eventTime,
+			body, &payload); err != nil {
+			return fmt.Errorf("%w: %v", ErrOTelFailed, err)
+		}
+	}
+
+	if processor.metrics != nil {
+		processor.metrics.record(ctx.Request().Context(), presentedEventType, &payload)
+	}
+
+	return nil
+}
+
+// Shutdown flushes the remaining telemetry and stops the exporters.
+func (processor *Processor) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	if processor.tracerProvider != nil {
+		errs = append(errs, processor.tracerProvider.Shutdown(ctx))
+	}
+
+	if processor.logProcessor != nil {
+		errs = append(errs, processor.logProcessor.Shutdown(ctx))
+	}
+
+	if processor.meterProvider != nil {
+		errs = append(errs, processor.meterProvider.Shutdown(ctx))
+	}
+
+	return errors.Join(errs...)
+}
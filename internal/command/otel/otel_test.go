@@ -0,0 +1,268 @@
+package otel_test
+
+import (
+	"context"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/otel"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"testing"
+	"time"
+)
+
+// Timestamp of the task's creation in the testdata/task.json
+var taskCreation = time.UnixMilli(1722408865412)
+
+func send(t *testing.T, processor *otel.Processor, eventType string, body []byte, timestamp time.Time) {
+	testutil.MustDeliver(t, processor.ProcessWebhookEvent, eventType, body, testutil.WithTimestamp(timestamp))
+}
+
+func withStatus(kind string, status string, extra map[string]any) func(payload map[string]any) {
+	return func(payload map[string]any) {
+		object := payload[kind].(map[string]any)
+		object["status"] = status
+
+		for key, value := range extra {
+			object[key] = value
+		}
+	}
+}
+
+func TestTraces(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+
+	processor, err := otel.NewProcessor("cirrus-ci",
+		otel.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter)))
+	require.NoError(t, err)
+
+	buildCreated := taskCreation.Add(-10 * time.Second)
+	taskExecuting := taskCreation.Add(5 * time.Second)
+	taskCompleted := taskCreation.Add(65 * time.Second)
+	buildCompleted := taskCreation.Add(70 * time.Second)
+
+	send(t, processor, "build", testutil.Testdata(t, "build.json", withStatus("build", "CREATED", nil)), buildCreated)
+	send(t, processor, "task", testutil.Testdata(t, "task.json", withStatus("task", "EXECUTING", map[string]any{
+		"statusTimestamp": taskExecuting.UnixMilli(),
+	})), taskExecuting)
+	require.Empty(t, exporter.GetSpans())
+
+	send(t, processor, "task", testutil.Testdata(t, "task.json", withStatus("task", "FAILED", map[string]any{
+		"statusTimestamp": taskCompleted.UnixMilli(),
+	})), taskCompleted)
+	send(t, processor, "build", testutil.Testdata(t, "build.json", withStatus("build", "FAILED", nil)), buildCompleted)
+
+	// Audit events are not traced
+	send(t, processor, "audit_event", testutil.Testdata(t, "audit_event.json", func(map[string]any) {}), buildCompleted)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	task, build := spans[0], spans[1]
+
+	require.Equal(t, "edigaryev/awesome-system-calls", build.Name)
+	require.False(t, build.Parent.IsValid())
+	require.Equal(t, otel.BuildTraceID(5082236150611968), build.SpanContext.TraceID())
+	require.Equal(t, buildCreated.UnixMilli(), build.StartTime.UnixMilli())
+	require.Equal(t, buildCompleted.UnixMilli(), build.EndTime.UnixMilli())
+	require.Equal(t, codes.Error, build.Status.Code)
+	require.Contains(t, build.Attributes, attribute.String("cirrus.build.status", "FAILED"))
+	require.Contains(t, build.Attributes, attribute.String("cirrus.build.branch", "main"))
+
+	require.Equal(t, "Lint (cargo fmt)", task.Name)
+	require.Equal(t, build.SpanContext.TraceID(), task.SpanContext.TraceID())
+	require.Equal(t, build.SpanContext.SpanID(), task.Parent.SpanID())
+	require.Equal(t, taskCreation.UnixMilli(), task.StartTime.UnixMilli())
+	require.Equal(t, taskCompleted.UnixMilli(), task.EndTime.UnixMilli())
+	require.Equal(t, codes.Error, task.Status.Code)
+	require.Contains(t, task.Attributes, attribute.Int64("cirrus.task.id", 6017965227769856))
+	require.Contains(t, task.Attributes, attribute.String("cirrus.task.instance_type", "CommunityContainer"))
+	require.Len(t, task.Events, 1)
+	require.Equal(t, "executing", task.Events[0].Name)
+	require.Equal(t, taskExecuting.UnixMilli(), task.Events[0].Time.UnixMilli())
+}
+
+func TestTracesBuildStartFromTask(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+
+	processor, err := otel.NewProcessor("cirrus-ci",
+		otel.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter)))
+	require.NoError(t, err)
+
+	// We've missed the build's creation, but the task knows when it was created
+	taskCompleted := taskCreation.Add(time.Minute)
+
+	send(t, processor, "task", testutil.Testdata(t, "task.json", withStatus("task", "COMPLETED", nil)), taskCompleted)
+	send(t, processor, "build", testutil.Testdata(t, "build.json", func(payload map[string]any) {
+		payload["old_status"] = "EXECUTING"
+		withStatus("build", "COMPLETED", nil)(payload)
+	}), taskCompleted)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	build := spans[1]
+	require.Equal(t, taskCreation.UnixMilli(), build.StartTime.UnixMilli())
+	require.Equal(t, codes.Ok, build.Status.Code)
+}
+
+func TestLogsAndMetrics(t *testing.T) {
+	receiver := newReceiver(t)
+	ctx := context.Background()
+
+	spanExporter, err := otel.NewSpanExporter(ctx, otel.ProtocolHTTP, receiver.URL)
+	require.NoError(t, err)
+	logExporter, err := otel.NewLogExporter(ctx, otel.ProtocolHTTP, receiver.URL)
+	require.NoError(t, err)
+	metricExporter, err := otel.NewMetricExporter(ctx, otel.ProtocolHTTP, receiver.URL)
+	require.NoError(t, err)
+
+	processor, err := otel.NewProcessor("cirrus-ci",
+		otel.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(spanExporter)),
+		otel.WithLogProcessor(sdklog.NewBatchProcessor(logExporter)),
+		otel.WithMetricReader(sdkmetric.NewPeriodicReader(metricExporter)),
+	)
+	require.NoError(t, err)
+
+	failedTask := testutil.Testdata(t, "task.json", func(payload map[string]any) {
+		payload["action"] = "updated"
+		payload["old_status"] = "EXECUTING"
+		withStatus("task", "FAILED", map[string]any{
+			"statusTimestamp": taskCreation.Add(time.Minute).UnixMilli(),
+		})(payload)
+	})
+
+	send(t, processor, "build", testutil.Testdata(t, "build.json", withStatus("build", "CREATED", nil)), taskCreation)
+	send(t, processor, "task", failedTask, taskCreation.Add(time.Minute))
+	send(t, processor, "audit_event", testutil.Testdata(t, "audit_event.json", func(map[string]any) {}), taskCreation)
+
+	// Updates of the other fields shouldn't count the same status twice
+	send(t, processor, "task", testutil.Testdata(t, "task.json", func(payload map[string]any) {
+		payload["action"] = "updated"
+		payload["old_status"] = "FAILED"
+		withStatus("task", "FAILED", map[string]any{"notifications": []any{}})(payload)
+	}), taskCreation.Add(2*time.Minute))
+
+	require.NoError(t, processor.Shutdown(ctx))
+
+	// Traces
+	var spans []*tracepb.Span
+
+	for _, request := range receiver.traces {
+		for _, resourceSpans := range request.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				spans = append(spans, scopeSpans.Spans...)
+			}
+		}
+	}
+
+	require.Len(t, spans, 1)
+	require.Equal(t, "Lint (cargo fmt)", spans[0].Name)
+
+	// Logs
+	type logRecord struct {
+		resource map[string]string
+		record   *logspb.LogRecord
+	}
+
+	var logRecords []logRecord
+
+	for _, request := range receiver.logs {
+		for _, resourceLogs := range request.ResourceLogs {
+			for _, scopeLogs := range resourceLogs.ScopeLogs {
+				for _, record := range scopeLogs.LogRecords {
+					logRecords = append(logRecords, logRecord{
+						resource: stringAttributes(resourceLogs.Resource.Attributes),
+						record:   record,
+					})
+				}
+			}
+		}
+	}
+
+	require.Len(t, logRecords, 4)
+
+	var taskRecord, auditRecord *logRecord
+
+	for i := range logRecords {
+		switch stringAttributes(logRecords[i].record.Attributes)["cirrus.event_type"] {
+		case "task":
+			if taskRecord == nil {
+				taskRecord = &logRecords[i]
+			}
+		case "audit_event":
+			auditRecord = &logRecords[i]
+		}
+	}
+
+	require.NotNil(t, taskRecord)
+	require.Equal(t, "cirrus-ci", taskRecord.resource["service.name"])
+	require.Equal(t, "edigaryev", taskRecord.resource["cirrus.repository.owner"])
+	require.Equal(t, "awesome-system-calls", taskRecord.resource["cirrus.repository.name"])
+	require.NotContains(t, stringAttributes(taskRecord.record.Attributes), "cirrus.repository.owner")
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, taskRecord.record.SeverityNumber)
+	require.Equal(t, string(failedTask), taskRecord.record.Body.GetStringValue())
+	require.EqualValues(t, taskCreation.Add(time.Minute).UnixNano(), taskRecord.record.TimeUnixNano)
+	require.Equal(t, "FAILED", stringAttributes(taskRecord.record.Attributes)["cirrus.task.status"])
+
+	require.NotNil(t, auditRecord)
+	require.NotContains(t, auditRecord.resource, "cirrus.repository.owner")
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, auditRecord.record.SeverityNumber)
+	require.Equal(t, "edigaryev", stringAttributes(auditRecord.record.Attributes)["cirrus.actor.username"])
+
+	// Metrics
+	metrics := map[string]*metricspb.Metric{}
+
+	for _, request := range receiver.metrics {
+		for _, resourceMetrics := range request.ResourceMetrics {
+			for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+				for _, metric := range scopeMetrics.Metrics {
+					metrics[metric.Name] = metric
+				}
+			}
+		}
+	}
+
+	var events int64
+
+	for _, dataPoint := range metrics["cirrus.webhook.events"].GetSum().DataPoints {
+		events += dataPoint.GetAsInt()
+	}
+
+	require.EqualValues(t, 4, events)
+
+	buildStatusUpdates := metrics["cirrus.build.status_updates"].GetSum().DataPoints
+	require.Len(t, buildStatusUpdates, 1)
+	require.EqualValues(t, 1, buildStatusUpdates[0].GetAsInt())
+	require.Equal(t, "CREATED", stringAttributes(buildStatusUpdates[0].Attributes)["cirrus.build.status"])
+
+	taskStatusUpdates := metrics["cirrus.task.status_updates"].GetSum().DataPoints
+	require.Len(t, taskStatusUpdates, 1)
+	require.EqualValues(t, 1, taskStatusUpdates[0].GetAsInt())
+	require.Equal(t, "FAILED", stringAttributes(taskStatusUpdates[0].Attributes)["cirrus.task.status"])
+
+	taskDuration := metrics["cirrus.task.duration"].GetHistogram().DataPoints
+	require.Len(t, taskDuration, 1)
+	require.EqualValues(t, 1, taskDuration[0].Count)
+	require.EqualValues(t, 1, taskDuration[0].GetSum())
+	require.Equal(t, "FAILED", stringAttributes(taskDuration[0].Attributes)["cirrus.task.status"])
+	require.NotContains(t, stringAttributes(taskDuration[0].Attributes), "cirrus.task.name")
+}
+
+func stringAttributes(keyValues []*commonpb.KeyValue) map[string]string {
+	result := map[string]string{}
+
+	for _, keyValue := range keyValues {
+		result[keyValue.Key] = keyValue.Value.GetStringValue()
+	}
+
+	return result
+}
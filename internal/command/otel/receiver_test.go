@@ -0,0 +1,83 @@
+package otel_test
+
+import (
+	"github.com/stretchr/testify/require"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// receiver is a minimal OTLP/HTTP receiver that accumulates
+// the exported telemetry in the protobuf encoding.
+type receiver struct {
+	URL string
+
+	traces  []*collectortrace.ExportTraceServiceRequest
+	logs    []*collectorlogs.ExportLogsServiceRequest
+	metrics []*collectormetrics.ExportMetricsServiceRequest
+	mtx     sync.Mutex
+}
+
+func newReceiver(t *testing.T) *receiver {
+	receiver := &receiver{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/traces", func(writer http.ResponseWriter, request *http.Request) {
+		var exportRequest collectortrace.ExportTraceServiceRequest
+
+		receiver.handle(t, writer, request, &exportRequest, &collectortrace.ExportTraceServiceResponse{}, func() {
+			receiver.traces = append(receiver.traces, &exportRequest)
+		})
+	})
+	mux.HandleFunc("POST /v1/logs", func(writer http.ResponseWriter, request *http.Request) {
+		var exportRequest collectorlogs.ExportLogsServiceRequest
+
+		receiver.handle(t, writer, request, &exportRequest, &collectorlogs.ExportLogsServiceResponse{}, func() {
+			receiver.logs = append(receiver.logs, &exportRequest)
+		})
+	})
+	mux.HandleFunc("POST /v1/metrics", func(writer http.ResponseWriter, request *http.Request) {
+		var exportRequest collectormetrics.ExportMetricsServiceRequest
+
+		receiver.handle(t, writer, request, &exportRequest, &collectormetrics.ExportMetricsServiceResponse{}, func() {
+			receiver.metrics = append(receiver.metrics, &exportRequest)
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	receiver.URL = server.URL
+
+	return receiver
+}
+
+func (receiver *receiver) handle(
+	t *testing.T,
+	writer http.ResponseWriter,
+	request *http.Request,
+	exportRequest proto.Message,
+	exportResponse proto.Message,
+	store func(),
+) {
+	receiver.mtx.Lock()
+	defer receiver.mtx.Unlock()
+
+	body, err := io.ReadAll(request.Body)
+	require.NoError(t, err)
+	require.NoError(t, proto.Unmarshal(body, exportRequest))
+
+	store()
+
+	responseBody, err := proto.Marshal(exportResponse)
+	require.NoError(t, err)
+
+	writer.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = writer.Write(responseBody)
+}
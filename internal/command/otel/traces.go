@@ -0,0 +1,201 @@
+package otel
+
+import (
+	"context"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"time"
+)
+
+type buildState struct {
+	start    time.Time
+	lastSeen time.Time
+	tasks    map[int64]*taskState
+}
+
+type taskState struct {
+	executing time.Time
+}
+
+// traces reconstructs the Cirrus CI builds as traces: the build is
+// the root span and each task is its child span.
+//
+// Since the spans are only emitted once they end, the in-memory state
+// only needs to remember when the still running builds and tasks
+// have started, the IDs of the spans are derived from the build
+// and task IDs, see idGenerator.
+type traces struct {
+	tracer   trace.Tracer
+	stateTTL time.Duration
+
+	builds map[int64]*buildState
+	mtx    sync.Mutex
+}
+
+func newTraces(tracer trace.Tracer, stateTTL time.Duration) *traces {
+	return &traces{
+		tracer:   tracer,
+		stateTTL: stateTTL,
+		builds:   map[int64]*buildState{},
+	}
+}
+
+func (traces *traces) process(
+	ctx context.Context,
+	presentedEventType string,
+	eventTime time.Time,
+	payload *cirrus.BuildOrTask,
+) {
+	if payload.Build.ID == nil {
+		return
+	}
+
+	traces.mtx.Lock()
+	defer traces.mtx.Unlock()
+
+	traces.evict()
+
+	buildID := *payload.Build.ID
+
+	build, ok := traces.builds[buildID]
+	if !ok {
+		build = &buildState{
+			start: eventTime,
+			tasks: map[int64]*taskState{},
+		}
+		traces.builds[buildID] = build
+	}
+	build.lastSeen = time.Now()
+
+	switch presentedEventType {
+	case "build":
+		if !cirrus.IsFinalBuildStatus(payload.Build.Status) || !payload.IsNewStatus(payload.Build.Status) {
+			return
+		}
+
+		traces.endBuild(ctx, build, eventTime, payload)
+		delete(traces.builds, buildID)
+	case "task":
+		if payload.Task.ID == nil {
+			return
+		}
+
+		taskID := *payload.Task.ID
+
+		task, ok := build.tasks[taskID]
+		if !ok {
+			task = &taskState{}
+			build.tasks[taskID] = task
+		}
+
+		if payload.Task.Status != nil && *payload.Task.Status == "EXECUTING" && task.executing.IsZero() {
+			task.executing = eventTime
+		}
+
+		if !cirrus.IsFinalTaskStatus(payload.Task.Status) || !payload.IsNewStatus(payload.Task.Status) {
+			return
+		}
+
+		start := traces.endTask(ctx, task, eventTime, payload)
+		delete(build.tasks, taskID)
+
+		// The task might have been created before we've seen any events for this build
+		if start.Before(build.start) {
+			build.start = start
+		}
+	}
+}
+
+func (traces *traces) endBuild(
+	ctx context.Context,
+	build *buildState,
+	eventTime time.Time,
+	payload *cirrus.BuildOrTask,
+) {
+	buildID := *payload.Build.ID
+
+	name := "build"
+	if fullName := payload.RepositoryFullName(); fullName != "" {
+		name = fullName
+	}
+
+	_, span := traces.tracer.Start(withIDs(ctx, BuildTraceID(buildID), buildSpanID(buildID)), name,
+		trace.WithNewRoot(),
+		trace.WithTimestamp(build.start),
+		trace.WithAttributes(buildAttributes(payload)...),
+	)
+
+	setStatus(span, *payload.Build.Status)
+
+	span.End(trace.WithTimestamp(eventTime))
+}
+
+func (traces *traces) endTask(
+	ctx context.Context,
+	task *taskState,
+	eventTime time.Time,
+	payload *cirrus.BuildOrTask,
+) time.Time {
+	buildID := *payload.Build.ID
+
+	start := task.executing
+	if payload.Task.CreationTimestamp != nil {
+		start = time.UnixMilli(*payload.Task.CreationTimestamp)
+	}
+	if start.IsZero() {
+		start = eventTime
+	}
+
+	end := eventTime
+	if payload.Task.StatusTimestamp != nil {
+		end = time.UnixMilli(*payload.Task.StatusTimestamp)
+	}
+
+	// Parent the task's span to the build's span, which will be started later
+	parentCtx := trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    BuildTraceID(buildID),
+		SpanID:     buildSpanID(buildID),
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	name := "task"
+	if payload.Task.Name != nil {
+		name = *payload.Task.Name
+	}
+
+	_, span := traces.tracer.Start(withIDs(parentCtx, BuildTraceID(buildID), taskSpanID(*payload.Task.ID)), name,
+		trace.WithTimestamp(start),
+		trace.WithAttributes(taskAttributes(payload)...),
+	)
+
+	if !task.executing.IsZero() {
+		span.AddEvent("executing", trace.WithTimestamp(task.executing))
+	}
+
+	setStatus(span, *payload.Task.Status)
+
+	span.End(trace.WithTimestamp(end))
+
+	return start
+}
+
+// evict forgets about the builds that we haven't heard of in a while,
+// for example, because we've missed their final event.
+func (traces *traces) evict() {
+	for buildID, build := range traces.builds {
+		if time.Since(build.lastSeen) > traces.stateTTL {
+			delete(traces.builds, buildID)
+		}
+	}
+}
+
+func setStatus(span trace.Span, status string) {
+	switch status {
+	case "COMPLETED":
+		span.SetStatus(codes.Ok, "")
+	case "FAILED", "ERRORED":
+		span.SetStatus(codes.Error, status)
+	}
+}
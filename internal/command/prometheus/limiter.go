@@ -0,0 +1,39 @@
+package prometheus
+
+// OtherValue replaces the label values seen after the label's cardinality limit was reached.
+const OtherValue = "__other__"
+
+// limiter bounds the number of distinct values of a label, so that a burst
+// of new repositories or branches doesn't blow up the number of time series.
+//
+// The values are admitted on a first-come, first-served basis,
+// a non-positive limit disables the limiting.
+type limiter struct {
+	limit  int
+	values map[string]struct{}
+}
+
+func newLimiter(limit int) *limiter {
+	return &limiter{
+		limit:  limit,
+		values: map[string]struct{}{},
+	}
+}
+
+func (limiter *limiter) Value(value string) string {
+	if limiter.limit <= 0 {
+		return value
+	}
+
+	if _, ok := limiter.values[value]; ok {
+		return value
+	}
+
+	if len(limiter.values) >= limiter.limit {
+		return OtherValue
+	}
+
+	limiter.values[value] = struct{}{}
+
+	return value
+}
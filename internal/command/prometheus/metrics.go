@@ -0,0 +1,224 @@
+package prometheus
+
+import (
+	"cmp"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	prometheuspkg "github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// Bucket boundaries (in seconds) that fit the typical CI task durations
+var durationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200, 14400}
+
+// Limits configure how many distinct values each of the labels can have.
+type Limits struct {
+	Repositories          int
+	BranchesPerRepository int
+	InstanceTypes         int
+}
+
+type executingTask struct {
+	repository   string
+	instanceType string
+	since        time.Time
+}
+
+type branchKey struct {
+	repository string
+	branch     string
+}
+
+type metrics struct {
+	taskStatusUpdates *prometheuspkg.CounterVec
+	taskDuration      *prometheuspkg.HistogramVec
+	tasksExecuting    *prometheuspkg.GaugeVec
+	buildsFinished    *prometheuspkg.CounterVec
+	buildSuccessRatio *prometheuspkg.GaugeVec
+
+	limits        Limits
+	repositories  *limiter
+	branches      map[string]*limiter
+	instanceTypes *limiter
+
+	// executing tracks the currently executing tasks to be able
+	// to decrement the gauge once they reach any other status
+	executing    map[int64]executingTask
+	executingTTL time.Duration
+
+	// recentBuilds holds whether each of the recently
+	// finished builds has succeeded, oldest first
+	recentBuilds       map[branchKey][]bool
+	successRatioWindow int
+
+	mtx sync.Mutex
+}
+
+func newMetrics(
+	registerer prometheuspkg.Registerer,
+	limits Limits,
+	successRatioWindow int,
+	executingTTL time.Duration,
+) (*metrics, error) {
+	metrics := &metrics{
+		taskStatusUpdates: prometheuspkg.NewCounterVec(prometheuspkg.CounterOpts{
+			Name: "cirrus_task_status_updates_total",
+			Help: "Number of times the tasks got a new status.",
+		}, []string{"repository", "status", "instance_type"}),
+		taskDuration: prometheuspkg.NewHistogramVec(prometheuspkg.HistogramOpts{
+			Name:    "cirrus_task_duration_seconds",
+			Help:    "Duration of the finished tasks.",
+			Buckets: durationBuckets,
+		}, []string{"repository", "status", "instance_type"}),
+		tasksExecuting: prometheuspkg.NewGaugeVec(prometheuspkg.GaugeOpts{
+			Name: "cirrus_tasks_executing",
+			Help: "Number of the currently executing tasks.",
+		}, []string{"repository", "instance_type"}),
+		buildsFinished: prometheuspkg.NewCounterVec(prometheuspkg.CounterOpts{
+			Name: "cirrus_builds_finished_total",
+			Help: "Number of the finished builds.",
+		}, []string{"repository", "branch", "status"}),
+		buildSuccessRatio: prometheuspkg.NewGaugeVec(prometheuspkg.GaugeOpts{
+			Name: "cirrus_build_success_ratio",
+			Help: "Ratio of the completed builds among the recently completed, failed and errored builds.",
+		}, []string{"repository", "branch"}),
+
+		limits:        limits,
+		repositories:  newLimiter(limits.Repositories),
+		branches:      map[string]*limiter{},
+		instanceTypes: newLimiter(limits.InstanceTypes),
+
+		executing:    map[int64]executingTask{},
+		executingTTL: executingTTL,
+
+		recentBuilds:       map[branchKey][]bool{},
+		successRatioWindow: successRatioWindow,
+	}
+
+	for _, collector := range []prometheuspkg.Collector{
+		metrics.taskStatusUpdates,
+		metrics.taskDuration,
+		metrics.tasksExecuting,
+		metrics.buildsFinished,
+		metrics.buildSuccessRatio,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+func (metrics *metrics) record(presentedEventType string, payload *cirrus.BuildOrTask) {
+	metrics.mtx.Lock()
+	defer metrics.mtx.Unlock()
+
+	metrics.evict()
+
+	repository := metrics.repositories.Value(cmp.Or(payload.RepositoryFullName(), "unknown"))
+
+	switch presentedEventType {
+	case "build":
+		metrics.recordBuild(repository, payload)
+	case "task":
+		metrics.recordTask(repository, payload)
+	}
+}
+
+func (metrics *metrics) recordBuild(repository string, payload *cirrus.BuildOrTask) {
+	if !cirrus.IsFinalBuildStatus(payload.Build.Status) || !payload.IsNewStatus(payload.Build.Status) {
+		return
+	}
+
+	branches, ok := metrics.branches[repository]
+	if !ok {
+		branches = newLimiter(metrics.limits.BranchesPerRepository)
+		metrics.branches[repository] = branches
+	}
+
+	branch := branches.Value(cmp.Or(cirrus.ValueOr(payload.Build.Branch, ""), "unknown"))
+	status := *payload.Build.Status
+
+	metrics.buildsFinished.WithLabelValues(repository, branch, status).Inc()
+
+	// Aborted builds are usually cancelled by a human or superseded
+	// by a newer build, so they say nothing about the success
+	if status == "ABORTED" {
+		return
+	}
+
+	key := branchKey{repository: repository, branch: branch}
+
+	recentBuilds := append(metrics.recentBuilds[key], status == "COMPLETED")
+	if len(recentBuilds) > metrics.successRatioWindow {
+		recentBuilds = recentBuilds[len(recentBuilds)-metrics.successRatioWindow:]
+	}
+	metrics.recentBuilds[key] = recentBuilds
+
+	var succeeded int
+
+	for _, success := range recentBuilds {
+		if success {
+			succeeded++
+		}
+	}
+
+	metrics.buildSuccessRatio.WithLabelValues(repository, branch).
+		Set(float64(succeeded) / float64(len(recentBuilds)))
+}
+
+func (metrics *metrics) recordTask(repository string, payload *cirrus.BuildOrTask) {
+	if payload.Task.ID == nil || payload.Task.Status == nil {
+		return
+	}
+
+	instanceType := metrics.instanceTypes.Value(cmp.Or(cirrus.ValueOr(payload.Task.InstanceType, ""), "unknown"))
+	status := *payload.Task.Status
+
+	// Track the executing tasks regardless of whether the status is new,
+	// since it's idempotent and helps to recover from the missed events
+	taskID := *payload.Task.ID
+	_, wasExecuting := metrics.executing[taskID]
+
+	switch {
+	case status == "EXECUTING" && !wasExecuting:
+		metrics.executing[taskID] = executingTask{
+			repository:   repository,
+			instanceType: instanceType,
+			since:        time.Now(),
+		}
+		metrics.tasksExecuting.WithLabelValues(repository, instanceType).Inc()
+	case status != "EXECUTING" && wasExecuting:
+		metrics.stopExecuting(taskID)
+	}
+
+	if !payload.IsNewStatus(payload.Task.Status) {
+		return
+	}
+
+	metrics.taskStatusUpdates.WithLabelValues(repository, status, instanceType).Inc()
+
+	if cirrus.IsFinalTaskStatus(payload.Task.Status) && payload.Task.DurationInSeconds != nil {
+		metrics.taskDuration.WithLabelValues(repository, status, instanceType).
+			Observe(float64(*payload.Task.DurationInSeconds))
+	}
+}
+
+func (metrics *metrics) stopExecuting(taskID int64) {
+	task := metrics.executing[taskID]
+
+	metrics.tasksExecuting.WithLabelValues(task.repository, task.instanceType).Dec()
+
+	delete(metrics.executing, taskID)
+}
+
+// evict forgets about the tasks that are executing for too long,
+// most likely because we've missed their final event.
+func (metrics *metrics) evict() {
+	for taskID, task := range metrics.executing {
+		if time.Since(task.since) > metrics.executingTTL {
+			metrics.stopExecuting(taskID)
+		}
+	}
+}
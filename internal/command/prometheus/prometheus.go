@@ -0,0 +1,124 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/labstack/echo/v4"
+	prometheuspkg "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+var metricsPath string
+var maxRepositories int
+var maxBranches int
+var maxInstanceTypes int
+var successRatioWindow int
+var executingTTL time.Duration
+
+var (
+	ErrPrometheusFailed = errors.New("failed to record Cirrus CI events as Prometheus metrics")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prometheus",
+		Short: "Expose the metrics derived from Cirrus CI webhook events for Prometheus to scrape",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&metricsPath, "metrics-path", "/metrics",
+		"HTTP path on which the metrics will be exposed")
+	cmd.PersistentFlags().IntVar(&maxRepositories, "max-repositories", 100,
+		"maximum number of the distinct \"repository\" label values, the repositories "+
+			"seen after reaching this limit are reported as \""+OtherValue+"\" (0 means no limit)")
+	cmd.PersistentFlags().IntVar(&maxBranches, "max-branches", 20,
+		"maximum number of the distinct \"branch\" label values per repository, the branches "+
+			"seen after reaching this limit are reported as \""+OtherValue+"\" (0 means no limit)")
+	cmd.PersistentFlags().IntVar(&maxInstanceTypes, "max-instance-types", 20,
+		"maximum number of the distinct \"instance_type\" label values, the instance types "+
+			"seen after reaching this limit are reported as \""+OtherValue+"\" (0 means no limit)")
+	cmd.PersistentFlags().IntVar(&successRatioWindow, "success-ratio-window", 20,
+		"number of the most recent builds per branch to calculate the build success ratio over")
+	cmd.PersistentFlags().DurationVar(&executingTTL, "executing-ttl", 24*time.Hour,
+		"stop counting the tasks as executing after this long, "+
+			"for example, because their final event was missed")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	if successRatioWindow < 1 {
+		return fmt.Errorf("%w: \"--success-ratio-window\" should be at least 1", ErrPrometheusFailed)
+	}
+
+	processor, err := NewProcessor(Limits{
+		Repositories:          maxRepositories,
+		BranchesPerRepository: maxBranches,
+		InstanceTypes:         maxInstanceTypes,
+	}, successRatioWindow, executingTTL)
+	if err != nil {
+		return err
+	}
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).
+		Handle(metricsPath, processor.Handler()).
+		Run(cmd.Context())
+}
+
+type Processor struct {
+	registry *prometheuspkg.Registry
+	metrics  *metrics
+}
+
+// NewProcessor creates a processor that keeps the metrics in its own registry,
+// separately from the metrics of the webhooks server itself.
+func NewProcessor(limits Limits, successRatioWindow int, executingTTL time.Duration) (*Processor, error) {
+	registry := prometheuspkg.NewRegistry()
+
+	metrics, err := newMetrics(registry, limits, successRatioWindow, executingTTL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to register metrics: %v", ErrPrometheusFailed, err)
+	}
+
+	return &Processor{
+		registry: registry,
+		metrics:  metrics,
+	}, nil
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	_ echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	if presentedEventType != "build" && presentedEventType != "task" {
+		logger.Debugf("ignoring %q event, only \"build\" and \"task\" events are recorded as metrics",
+			presentedEventType)
+
+		return nil
+	}
+
+	var payload cirrus.BuildOrTask
+
+	if err := cirrus.Decode(body, &payload, cirrus.DecodingModeLenient); err != nil {
+		return fmt.Errorf("%w: %v", ErrPrometheusFailed, err)
+	}
+
+	processor.metrics.record(presentedEventType, &payload)
+
+	return nil
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (processor *Processor) Handler() http.Handler {
+	return promhttp.HandlerFor(processor.registry, promhttp.HandlerOpts{})
+}
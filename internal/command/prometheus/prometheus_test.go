@@ -0,0 +1,119 @@
+package prometheus_test
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/prometheus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func send(t *testing.T, processor *prometheus.Processor, eventType string, name string, mutate func(payload map[string]any)) {
+	testutil.MustDeliver(t, processor.ProcessWebhookEvent, eventType, testutil.Testdata(t, name, mutate))
+}
+
+func update(kind string, oldStatus string, status string) func(payload map[string]any) {
+	return func(payload map[string]any) {
+		payload["action"] = "updated"
+		payload["old_status"] = oldStatus
+		payload[kind].(map[string]any)["status"] = status
+	}
+}
+
+func scrape(t *testing.T, processor *prometheus.Processor) string {
+	recorder := httptest.NewRecorder()
+
+	processor.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+
+	return string(body)
+}
+
+func TestTasks(t *testing.T) {
+	processor, err := prometheus.NewProcessor(prometheus.Limits{}, 20, time.Hour)
+	require.NoError(t, err)
+
+	// Task is created and starts executing
+	send(t, processor, "task", "task.json", func(map[string]any) {})
+
+	metrics := scrape(t, processor)
+	require.Contains(t, metrics, `cirrus_tasks_executing{instance_type="CommunityContainer",`+
+		`repository="edigaryev/awesome-system-calls"} 1`)
+	require.Contains(t, metrics, `cirrus_task_status_updates_total{instance_type="CommunityContainer",`+
+		`repository="edigaryev/awesome-system-calls",status="EXECUTING"} 1`)
+
+	// Task fails, and the same event is then re-delivered
+	send(t, processor, "task", "task.json", update("task", "EXECUTING", "FAILED"))
+	send(t, processor, "task", "task.json", update("task", "FAILED", "FAILED"))
+
+	metrics = scrape(t, processor)
+	require.Contains(t, metrics, `cirrus_tasks_executing{instance_type="CommunityContainer",`+
+		`repository="edigaryev/awesome-system-calls"} 0`)
+	require.Contains(t, metrics, `cirrus_task_status_updates_total{instance_type="CommunityContainer",`+
+		`repository="edigaryev/awesome-system-calls",status="FAILED"} 1`)
+	require.Contains(t, metrics, `cirrus_task_duration_seconds_bucket{instance_type="CommunityContainer",`+
+		`repository="edigaryev/awesome-system-calls",status="FAILED",le="1"} 1`)
+	require.Contains(t, metrics, `cirrus_task_duration_seconds_count{instance_type="CommunityContainer",`+
+		`repository="edigaryev/awesome-system-calls",status="FAILED"} 1`)
+}
+
+func TestBuildSuccessRatio(t *testing.T) {
+	processor, err := prometheus.NewProcessor(prometheus.Limits{}, 2, time.Hour)
+	require.NoError(t, err)
+
+	send(t, processor, "build", "build.json", update("build", "EXECUTING", "FAILED"))
+	send(t, processor, "build", "build.json", update("build", "EXECUTING", "COMPLETED"))
+
+	metrics := scrape(t, processor)
+	require.Contains(t, metrics, `cirrus_build_success_ratio{branch="main",`+
+		`repository="edigaryev/awesome-system-calls"} 0.5`)
+
+	// Aborted builds don't affect the ratio
+	send(t, processor, "build", "build.json", update("build", "EXECUTING", "ABORTED"))
+
+	metrics = scrape(t, processor)
+	require.Contains(t, metrics, `cirrus_build_success_ratio{branch="main",`+
+		`repository="edigaryev/awesome-system-calls"} 0.5`)
+	require.Contains(t, metrics, `cirrus_builds_finished_total{branch="main",`+
+		`repository="edigaryev/awesome-system-calls",status="ABORTED"} 1`)
+
+	// Only the most recent builds are considered
+	send(t, processor, "build", "build.json", update("build", "EXECUTING", "COMPLETED"))
+
+	metrics = scrape(t, processor)
+	require.Contains(t, metrics, `cirrus_build_success_ratio{branch="main",`+
+		`repository="edigaryev/awesome-system-calls"} 1`)
+}
+
+func TestCardinalityLimits(t *testing.T) {
+	processor, err := prometheus.NewProcessor(prometheus.Limits{
+		Repositories:          1,
+		BranchesPerRepository: 1,
+	}, 20, time.Hour)
+	require.NoError(t, err)
+
+	send(t, processor, "build", "build.json", update("build", "EXECUTING", "COMPLETED"))
+	send(t, processor, "build", "build.json", func(payload map[string]any) {
+		update("build", "EXECUTING", "COMPLETED")(payload)
+		payload["build"].(map[string]any)["branch"] = "feature"
+	})
+	send(t, processor, "build", "build.json", func(payload map[string]any) {
+		update("build", "EXECUTING", "COMPLETED")(payload)
+		payload["repository"].(map[string]any)["name"] = "another-repository"
+	})
+
+	metrics := scrape(t, processor)
+	require.Contains(t, metrics, `cirrus_builds_finished_total{branch="main",`+
+		`repository="edigaryev/awesome-system-calls",status="COMPLETED"} 1`)
+	require.Contains(t, metrics, `cirrus_builds_finished_total{branch="__other__",`+
+		`repository="edigaryev/awesome-system-calls",status="COMPLETED"} 1`)
+	require.Contains(t, metrics, `cirrus_builds_finished_total{branch="main",`+
+		`repository="__other__",status="COMPLETED"} 1`)
+	require.NotContains(t, metrics, "another-repository")
+}
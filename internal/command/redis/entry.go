@@ -0,0 +1,93 @@
+package redis
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stream returns the name of the stream to which the webhook
+// events of the given type are added, e.g. "cirrus:task".
+func Stream(prefix string, presentedEventType string) string {
+	return prefix + ":" + presentedEventType
+}
+
+// NewValues returns the field-value pairs of the stream entry
+// for the webhook event, suitable for the XADD command.
+//
+// Besides the webhook event's body as is, the entry contains
+// the fields that the consumers are likely to filter on,
+// so that they don't need to parse the body first, as well
+// as the "X-Cirrus-*" HTTP headers prefixed with "header:".
+func NewValues(header http.Header, presentedEventType string, body []byte) ([]interface{}, error) {
+	var payload cirrus.BuildOrTask
+
+	if err := cirrus.Decode(body, &payload, cirrus.DecodingModeLenient); err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{
+		"event_type", presentedEventType,
+		"body", string(body),
+	}
+
+	appendString := func(field string, value *string) {
+		if value != nil {
+			values = append(values, field, *value)
+		}
+	}
+
+	appendInt := func(field string, value *int64) {
+		if value != nil {
+			values = append(values, field, strconv.FormatInt(*value, 10))
+		}
+	}
+
+	appendString("action", payload.Action)
+	appendString("type", payload.Type)
+	appendInt("timestamp", payload.Timestamp)
+
+	if fullName := payload.RepositoryFullName(); fullName != "" {
+		values = append(values, "repository", fullName)
+	}
+	appendInt("repository_id", payload.Repository.ID)
+
+	appendInt("build_id", payload.Build.ID)
+	appendString("build_status", payload.Build.Status)
+	appendString("branch", payload.Build.Branch)
+
+	appendInt("task_id", payload.Task.ID)
+	appendString("task_name", payload.Task.Name)
+	appendString("task_status", payload.Task.Status)
+
+	appendString("old_status", payload.OldStatus)
+
+	if presentedEventType == "audit_event" {
+		var auditEvent cirrus.AuditEvent
+
+		if err := cirrus.Decode(body, &auditEvent, cirrus.DecodingModeLenient); err != nil {
+			return nil, err
+		}
+
+		appendString("audit_event_id", auditEvent.ID)
+	}
+
+	// Carry the Cirrus CI headers, sorted for a stable field order
+	var keys []string
+
+	for key := range header {
+		if strings.HasPrefix(key, "X-Cirrus-") {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		values = append(values, "header:"+key, header.Get(key))
+	}
+
+	return values, nil
+}
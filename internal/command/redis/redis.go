@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/labstack/echo/v4"
+	redispkg "github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var redisURL string
+var streamPrefix string
+var maxLen int64
+var maxLenExact bool
+
+var (
+	ErrRedisFailed = errors.New("failed to add Cirrus CI events to Redis streams")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "redis",
+		Short: "Add Cirrus CI webhook events to Redis streams",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&redisURL, "url", "",
+		"Redis URL to connect to (defaults to the REDIS_URL environment variable, "+
+			"or redis://127.0.0.1:6379/0 if it's not set)")
+	cmd.PersistentFlags().StringVar(&streamPrefix, "stream-prefix", "cirrus",
+		"prefix of the streams to add the webhook events to, the resulting streams "+
+			"are in the \"<prefix>:<event type>\" format")
+	cmd.PersistentFlags().Int64Var(&maxLen, "max-len", 0,
+		"if specified, trim the streams to approximately this number of entries")
+	cmd.PersistentFlags().BoolVar(&maxLenExact, "max-len-exact", false,
+		"trim the streams to exactly --max-len entries, which is less efficient than "+
+			"the default approximate trimming")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	redisURL = server.SecretFromEnv(redisURL, "REDIS_URL")
+
+	if redisURL == "" {
+		redisURL = "redis://127.0.0.1:6379/0"
+	}
+
+	if maxLen < 0 {
+		return fmt.Errorf("%w: \"--max-len\" cannot be negative", ErrRedisFailed)
+	}
+
+	options, err := redispkg.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse Redis URL: %v", ErrRedisFailed, err)
+	}
+
+	processor := NewProcessor(redispkg.NewClient(options), streamPrefix, maxLen, !maxLenExact)
+	defer func() {
+		_ = processor.Close()
+	}()
+
+	if err := processor.Ping(cmd.Context()); err != nil {
+		zap.S().Warnf("failed to ping Redis, will retry when adding the events: %v", err)
+	}
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+type Processor struct {
+	client       *redispkg.Client
+	streamPrefix string
+	maxLen       int64
+	approximate  bool
+}
+
+// NewProcessor creates a processor that adds each webhook event to the
+// "<prefix>:<event type>" stream. When maxLen is positive, the streams
+// are trimmed to (approximately, if requested) that number of entries.
+func NewProcessor(client *redispkg.Client, streamPrefix string, maxLen int64, approximate bool) *Processor {
+	return &Processor{
+		client:       client,
+		streamPrefix: streamPrefix,
+		maxLen:       maxLen,
+		approximate:  approximate,
+	}
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	_ *zap.SugaredLogger,
+) error {
+	values, err := NewValues(ctx.Request().Header, presentedEventType, body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRedisFailed, err)
+	}
+
+	args := &redispkg.XAddArgs{
+		Stream: Stream(processor.streamPrefix, presentedEventType),
+		Values: values,
+	}
+
+	if processor.maxLen > 0 {
+		args.MaxLen = processor.maxLen
+		args.Approx = processor.approximate
+	}
+
+	if err := processor.client.XAdd(ctx.Request().Context(), args).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrRedisFailed, err)
+	}
+
+	return nil
+}
+
+func (processor *Processor) Close() error {
+	return processor.client.Close()
+}
+
+// Ping checks the connectivity with Redis.
+func (processor *Processor) Ping(ctx context.Context) error {
+	return processor.client.Ping(ctx).Err()
+}
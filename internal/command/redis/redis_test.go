@@ -0,0 +1,82 @@
+package redis_test
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/redis"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	redispkg "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newProcessor(t *testing.T, maxLen int64) (*redis.Processor, *redispkg.Client) {
+	miniRedis := miniredis.RunT(t)
+
+	client := redispkg.NewClient(&redispkg.Options{Addr: miniRedis.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return redis.NewProcessor(client, "cirrus", maxLen, false), client
+}
+
+func TestStreams(t *testing.T) {
+	processor, client := newProcessor(t, 0)
+	ctx := context.Background()
+
+	taskBody := testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "task", "task.json")
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "audit_event", "audit_event.json")
+
+	tasks, err := client.XRange(ctx, "cirrus:task", "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	require.Equal(t, map[string]interface{}{
+		"event_type":                "task",
+		"body":                      string(taskBody),
+		"action":                    "created",
+		"repository":                "edigaryev/awesome-system-calls",
+		"repository_id":             "5129885287448576",
+		"build_id":                  "5082236150611968",
+		"build_status":              "EXECUTING",
+		"branch":                    "main",
+		"task_id":                   "6017965227769856",
+		"task_name":                 "Lint (cargo fmt)",
+		"task_status":               "EXECUTING",
+		"header:X-Cirrus-Event":     "task",
+		"header:X-Cirrus-Timestamp": "1722408869403",
+	}, tasks[0].Values)
+
+	auditEvents, err := client.XRange(ctx, "cirrus:audit_event", "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, auditEvents, 1)
+	require.Equal(t, "bb2bde61-24e6-475c-a8a7-3f03bedcbd61", auditEvents[0].Values["audit_event_id"])
+	require.Equal(t, "graphql.mutation", auditEvents[0].Values["type"])
+	require.NotContains(t, auditEvents[0].Values, "repository")
+
+	// Consumer groups work on top of the per-event type streams
+	require.NoError(t, client.XGroupCreate(ctx, "cirrus:task", "tools", "0").Err())
+
+	streams, err := client.XReadGroup(ctx, &redispkg.XReadGroupArgs{
+		Group:    "tools",
+		Consumer: "tool-1",
+		Streams:  []string{"cirrus:task", ">"},
+		Count:    10,
+	}).Result()
+	require.NoError(t, err)
+	require.Len(t, streams, 1)
+	require.Len(t, streams[0].Messages, 1)
+	require.Equal(t, tasks[0].ID, streams[0].Messages[0].ID)
+}
+
+func TestMaxLen(t *testing.T) {
+	processor, client := newProcessor(t, 2)
+
+	for range 5 {
+		testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "build", "build.json")
+	}
+
+	length, err := client.XLen(context.Background(), "cirrus:build").Result()
+	require.NoError(t, err)
+	require.EqualValues(t, 2, length)
+}
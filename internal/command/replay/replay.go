@@ -0,0 +1,153 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/archive"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxLineSize is large enough to fit the biggest webhook event along with its headers.
+const maxLineSize = 16 * 1024 * 1024
+
+var targetURL string
+
+var (
+	ErrReplayFailed = errors.New("failed to replay the archived Cirrus CI events")
+)
+
+// skippedHeaders are managed by the HTTP client itself and
+// describe the original request rather than the webhook event.
+//
+//nolint:gochecknoglobals
+var skippedHeaders = []string{"Content-Length", "Transfer-Encoding", "Connection", "Accept-Encoding"}
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay [flags] FILE...",
+		Short: "Re-deliver the archived Cirrus CI webhook events to a running processor",
+		Long: "Re-deliver the Cirrus CI webhook events archived by the s3 processor or written " +
+			"using the --file flag to a running processor, in order, stopping at the first " +
+			"webhook event that was not accepted.\n\n" +
+			"The files ending with .gz are decompressed on the fly.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: run,
+	}
+
+	cmd.PersistentFlags().StringVar(&targetURL, "url", "http://127.0.0.1:8080/",
+		"URL of the running processor to re-deliver the webhook events to")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	client := &http.Client{
+		Timeout: time.Minute,
+	}
+
+	for _, path := range args {
+		numReplayed, err := replayFile(cmd.Context(), client, path)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrReplayFailed, path, err)
+		}
+
+		zap.S().Infof("replayed %d webhook events from %s", numReplayed, path)
+	}
+
+	return nil
+}
+
+func replayFile(ctx context.Context, client *http.Client, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return 0, err
+		}
+		defer gzipReader.Close()
+
+		reader = gzipReader
+	}
+
+	return Replay(ctx, client, targetURL, reader)
+}
+
+// Replay POSTs the webhook events read from the archive to the URL, with
+// the same headers and body they were received with, so that the signatures
+// still match. It returns the number of the webhook events re-delivered.
+func Replay(ctx context.Context, client *http.Client, url string, reader io.Reader) (int, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, maxLineSize)
+
+	numReplayed := 0
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var record archive.Record
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return numReplayed, fmt.Errorf("line %d: failed to parse the record: %v", lineNumber, err)
+		}
+
+		if err := deliver(ctx, client, url, &record); err != nil {
+			return numReplayed, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		numReplayed++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return numReplayed, err
+	}
+
+	return numReplayed, nil
+}
+
+func deliver(ctx context.Context, client *http.Client, url string, record *archive.Record) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(record.Body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header = record.Headers.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+
+	for _, key := range skippedHeaders {
+		req.Header.Del(key)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("processor unexpectedly responded with HTTP %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package replay_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/archive"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/replay"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type receivedRequest struct {
+	Header http.Header
+	Body   string
+}
+
+func archiveOf(t *testing.T, bodies ...string) io.Reader {
+	var buf bytes.Buffer
+
+	for _, body := range bodies {
+		header := http.Header{}
+		header.Set("X-Cirrus-Event", "task")
+		header.Set("X-Cirrus-Signature", "abcdef")
+		header.Set("Content-Length", "1")
+
+		line, err := archive.NewRecord(header, "task", []byte(body), time.Now()).MarshalLine()
+		require.NoError(t, err)
+
+		buf.Write(line)
+	}
+
+	return &buf
+}
+
+func TestReplay(t *testing.T) {
+	var requests []receivedRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, err := io.ReadAll(request.Body)
+		require.NoError(t, err)
+
+		requests = append(requests, receivedRequest{Header: request.Header, Body: string(body)})
+
+		if string(body) == "{\"fail\": true}" {
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	numReplayed, err := replay.Replay(context.Background(), http.DefaultClient, server.URL,
+		archiveOf(t, "{\n  \"action\": \"created\"\n}", "{}"))
+	require.NoError(t, err)
+	require.Equal(t, 2, numReplayed)
+
+	require.Len(t, requests, 2)
+	require.Equal(t, "task", requests[0].Header.Get("X-Cirrus-Event"))
+	require.Equal(t, "abcdef", requests[0].Header.Get("X-Cirrus-Signature"))
+	require.Equal(t, "{\n  \"action\": \"created\"\n}", requests[0].Body)
+
+	// Replay stops at the first webhook event that was not accepted
+	numReplayed, err = replay.Replay(context.Background(), http.DefaultClient, server.URL,
+		archiveOf(t, "{\"fail\": true}", "{}"))
+	require.Error(t, err)
+	require.Equal(t, 0, numReplayed)
+	require.Len(t, requests, 3)
+}
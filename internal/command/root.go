@@ -1,8 +1,24 @@
 package command
 
 import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/clickhouse"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/datadog"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/elasticsearch"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/file"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/forward"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/getdx"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/kafka"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/loki"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/msteams"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/nats"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/otel"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/prometheus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/redis"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/replay"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/s3"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/slack"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/splunk"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/sql"
 	"github.com/cirruslabs/cirrus-webhooks-server/internal/logginglevel"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap/zapcore"
@@ -27,8 +43,24 @@ func NewRootCmd() *cobra.Command {
 	cmd.PersistentFlags().BoolVar(&debug, "debug", false, "enable debug logging")
 
 	cmd.AddCommand(
+		clickhouse.NewCommand(),
 		datadog.NewCommand(),
+		elasticsearch.NewCommand(),
+		file.NewCommand(),
+		forward.NewCommand(),
 		getdx.NewCommand(),
+		kafka.NewCommand(),
+		loki.NewCommand(),
+		msteams.NewCommand(),
+		nats.NewCommand(),
+		otel.NewCommand(),
+		prometheus.NewCommand(),
+		redis.NewCommand(),
+		replay.NewCommand(),
+		s3.NewCommand(),
+		slack.NewCommand(),
+		splunk.NewCommand(),
+		sql.NewCommand(),
 	)
 
 	return cmd
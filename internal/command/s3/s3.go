@@ -0,0 +1,286 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/archive"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/batch"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+var endpoint string
+var region string
+var bucket string
+var prefix string
+var accessKeyID string
+var secretAccessKey string
+var pathStyle bool
+var maxSize int
+var flushInterval time.Duration
+
+var (
+	ErrS3Failed = errors.New("failed to archive Cirrus CI events to S3")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "s3",
+		Short: "Archive raw Cirrus CI webhook events to S3-compatible object storage",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&endpoint, "endpoint", "https://s3.amazonaws.com",
+		"S3-compatible object storage endpoint URL (for example, http://minio:9000)")
+	cmd.PersistentFlags().StringVar(&region, "region", os.Getenv("AWS_REGION"),
+		"bucket's region (defaults to the AWS_REGION environment variable)")
+	cmd.PersistentFlags().StringVar(&bucket, "bucket", "",
+		"bucket to archive the webhook events to")
+	cmd.PersistentFlags().StringVar(&prefix, "prefix", "cirrus-webhooks",
+		"prefix of the archived objects' keys")
+	cmd.PersistentFlags().StringVar(&accessKeyID, "access-key-id", "",
+		"access key ID (defaults to the AWS_ACCESS_KEY_ID environment variable, when not set, "+
+			"the credentials are taken from the AWS credentials file or the instance metadata)")
+	cmd.PersistentFlags().StringVar(&secretAccessKey, "secret-access-key", "",
+		"secret access key (defaults to the AWS_SECRET_ACCESS_KEY environment variable)")
+	cmd.PersistentFlags().BoolVar(&pathStyle, "path-style", false,
+		"use the path-style requests (http://endpoint/bucket/key), which most self-hosted "+
+			"S3-compatible object storages (like MinIO) require")
+	cmd.PersistentFlags().IntVar(&maxSize, "max-size", 8*1024*1024,
+		"maximum size of the webhook events (before compression) to accumulate before uploading them")
+	cmd.PersistentFlags().DurationVar(&flushInterval, "flush-interval", 5*time.Second,
+		"maximum time to wait for more webhook events before uploading them, "+
+			"note that the webhook events are only acknowledged to Cirrus CI once uploaded")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	accessKeyID = server.SecretFromEnv(accessKeyID, "AWS_ACCESS_KEY_ID")
+	secretAccessKey = server.SecretFromEnv(secretAccessKey, "AWS_SECRET_ACCESS_KEY")
+
+	if bucket == "" {
+		return fmt.Errorf("%w: \"--bucket\" is required", ErrS3Failed)
+	}
+
+	if maxSize < 1 {
+		return fmt.Errorf("%w: \"--max-size\" should be at least 1", ErrS3Failed)
+	}
+
+	client, err := NewClient(endpoint, region, accessKeyID, secretAccessKey, pathStyle)
+	if err != nil {
+		return err
+	}
+
+	processor := NewProcessor(client, bucket, prefix, maxSize, flushInterval)
+	defer processor.Close()
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+// NewClient creates an S3 client for the endpoint URL, using the
+// static credentials, if specified, or the AWS credentials chain.
+func NewClient(
+	rawEndpoint string,
+	region string,
+	accessKeyID string,
+	secretAccessKey string,
+	pathStyle bool,
+) (*minio.Client, error) {
+	endpointURL, err := url.Parse(rawEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse endpoint URL: %v", ErrS3Failed, err)
+	}
+
+	if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+		return nil, fmt.Errorf("%w: endpoint URL should have either http:// or https:// scheme",
+			ErrS3Failed)
+	}
+
+	var creds *credentials.Credentials
+
+	if accessKeyID != "" {
+		creds = credentials.NewStaticV4(accessKeyID, secretAccessKey, "")
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		})
+	}
+
+	bucketLookup := minio.BucketLookupAuto
+	if pathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpointURL.Host, &minio.Options{
+		Creds:        creds,
+		Secure:       endpointURL.Scheme == "https",
+		Region:       region,
+		BucketLookup: bucketLookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrS3Failed, err)
+	}
+
+	return client, nil
+}
+
+type item struct {
+	record *archive.Record
+	line   []byte
+}
+
+type Processor struct {
+	client *minio.Client
+	bucket string
+	prefix string
+
+	batcher *batch.Batcher[*item]
+}
+
+func NewProcessor(
+	client *minio.Client,
+	bucket string,
+	prefix string,
+	maxSize int,
+	flushInterval time.Duration,
+) *Processor {
+	processor := &Processor{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+	}
+
+	processor.batcher = batch.New(maxSize, flushInterval, time.Minute, processor.upload,
+		batch.WithWeight(func(item *item) int {
+			return len(item.line)
+		}))
+
+	return processor
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	_ *zap.SugaredLogger,
+) error {
+	record := archive.NewRecord(ctx.Request().Header, presentedEventType, body, time.Now())
+
+	line, err := record.MarshalLine()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrS3Failed, err)
+	}
+
+	if err := processor.batcher.Submit(ctx.Request().Context(), &item{record: record, line: line}); err != nil {
+		return fmt.Errorf("%w: %v", ErrS3Failed, err)
+	}
+
+	return nil
+}
+
+// Close uploads the pending webhook events and stops the processor.
+func (processor *Processor) Close() {
+	processor.batcher.Close()
+}
+
+type partition struct {
+	date      string
+	eventType string
+}
+
+// upload uploads the webhook events as a single object per partition.
+func (processor *Processor) upload(ctx context.Context, items []*item) []error {
+	errs := make([]error, len(items))
+
+	var partitions []partition
+
+	partitionItems := map[partition][]int{}
+
+	for i, item := range items {
+		partition := partition{
+			date:      item.record.ReceivedAt.Format(time.DateOnly),
+			eventType: item.record.EventType,
+		}
+
+		if _, ok := partitionItems[partition]; !ok {
+			partitions = append(partitions, partition)
+		}
+
+		partitionItems[partition] = append(partitionItems[partition], i)
+	}
+
+	for _, partition := range partitions {
+		indices := partitionItems[partition]
+
+		lines := make([][]byte, 0, len(indices))
+
+		for _, i := range indices {
+			lines = append(lines, items[i].line)
+		}
+
+		err := processor.uploadPartition(ctx, partition, items[indices[0]].record.ReceivedAt, lines)
+
+		for _, i := range indices {
+			errs[i] = err
+		}
+	}
+
+	return errs
+}
+
+func (processor *Processor) uploadPartition(
+	ctx context.Context,
+	partition partition,
+	firstReceivedAt time.Time,
+	lines [][]byte,
+) error {
+	var buf bytes.Buffer
+
+	gzipWriter := gzip.NewWriter(&buf)
+
+	for _, line := range lines {
+		if _, err := gzipWriter.Write(line); err != nil {
+			return err
+		}
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+
+	// The keys are unique, so the archived objects are never overwritten
+	key := path.Join(
+		processor.prefix,
+		"date="+partition.date,
+		"event_type="+url.PathEscape(partition.eventType),
+		firstReceivedAt.Format("20060102T150405.000Z")+"-"+uuid.NewString()+".jsonl.gz",
+	)
+
+	_, err := processor.client.PutObject(ctx, processor.bucket, key, &buf, int64(buf.Len()),
+		minio.PutObjectOptions{
+			ContentType: "application/gzip",
+		})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", key, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package s3_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/archive"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/s3"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeS3 struct {
+	objects map[string][]byte
+	mtx     sync.Mutex
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, string) {
+	fake := &fakeS3{
+		objects: map[string][]byte{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /archive/{key...}", func(writer http.ResponseWriter, request *http.Request) {
+		fake.mtx.Lock()
+		defer fake.mtx.Unlock()
+
+		require.Contains(t, request.Header.Get("Authorization"), "Credential=access/")
+
+		object, err := io.ReadAll(request.Body)
+		require.NoError(t, err)
+
+		// The client uses the streaming signature over plain HTTP
+		if request.Header.Get("X-Amz-Content-Sha256") == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+			object = decodeAWSChunked(t, object)
+		}
+
+		fake.objects[request.PathValue("key")] = object
+
+		writer.Header().Set("ETag", `"etag"`)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return fake, server.URL
+}
+
+// decodeAWSChunked decodes the "<hex size>;chunk-signature=<signature>\r\n<data>\r\n"
+// chunks, without verifying their signatures.
+func decodeAWSChunked(t *testing.T, body []byte) []byte {
+	var result []byte
+
+	for {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		require.True(t, ok)
+
+		rawSize, _, _ := bytes.Cut(header, []byte(";"))
+
+		size, err := strconv.ParseInt(string(rawSize), 16, 64)
+		require.NoError(t, err)
+
+		if size == 0 {
+			return result
+		}
+
+		result = append(result, rest[:size]...)
+		body = rest[size+2:]
+	}
+}
+
+func readObject(t *testing.T, object []byte) []archive.Record {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(object))
+	require.NoError(t, err)
+
+	var records []archive.Record
+
+	scanner := bufio.NewScanner(gzipReader)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		var record archive.Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+
+		records = append(records, record)
+	}
+
+	require.NoError(t, scanner.Err())
+
+	return records
+}
+
+func TestArchive(t *testing.T) {
+	fake, endpoint := newFakeS3(t)
+
+	client, err := s3.NewClient(endpoint, "us-east-1", "access", "secret", true)
+	require.NoError(t, err)
+
+	// The maximum size is large enough for the events to be only uploaded on the flush interval
+	processor := s3.NewProcessor(client, "archive", "cirrus", 1024*1024, 500*time.Millisecond)
+	defer processor.Close()
+
+	var wg sync.WaitGroup
+
+	bodies := map[string][]byte{}
+	var bodiesMtx sync.Mutex
+
+	for _, eventType := range []string{"task", "task", "build", "audit_event"} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			body := testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, eventType, eventType+".json",
+				testutil.WithHeader("X-Cirrus-Signature", "abcdef"))
+
+			bodiesMtx.Lock()
+			bodies[eventType] = body
+			bodiesMtx.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	// The webhook events are uploaded as a single object per event type
+	require.Len(t, fake.objects, 3)
+
+	keyRegexp := regexp.MustCompile(`^cirrus/date=\d{4}-\d{2}-\d{2}/event_type=([a-z_]+)/\d{8}T\d{6}\.\d{3}Z-[0-9a-f-]+\.jsonl\.gz$`)
+
+	for key, object := range fake.objects {
+		matches := keyRegexp.FindStringSubmatch(key)
+		require.NotNil(t, matches, key)
+
+		eventType := matches[1]
+
+		records := readObject(t, object)
+
+		if eventType == "task" {
+			require.Len(t, records, 2)
+		} else {
+			require.Len(t, records, 1)
+		}
+
+		for _, record := range records {
+			require.Equal(t, eventType, record.EventType)
+			require.Equal(t, "abcdef", record.Headers.Get("X-Cirrus-Signature"))
+			require.Equal(t, string(bodies[eventType]), record.Body)
+			require.WithinDuration(t, time.Now(), record.ReceivedAt, time.Minute)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package slack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrBuildMessagesFailed = errors.New("failed to persist Slack build messages")
+
+// buildMessageRetention is how long we keep track of the build's message
+// after its last update, we don't expect builds to be re-run after that.
+const buildMessageRetention = 7 * 24 * time.Hour
+
+// saveInterval limits how often the state is written to the file,
+// unless a new message was posted, which is persisted immediately
+// to avoid posting a duplicate message for the build after a restart.
+const saveInterval = 5 * time.Second
+
+type TaskState struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+
+	// StatusTimestamp is the task's "statusTimestamp" in milliseconds
+	// since the epoch, used to ignore the out-of-order events
+	StatusTimestamp int64 `json:"statusTimestamp,omitempty"`
+}
+
+// BuildState is what we know about the build so far, which
+// is used to render the build's message from scratch.
+type BuildState struct {
+	ID          int64  `json:"id"`
+	Status      string `json:"status"`
+	Repository  string `json:"repository"`
+	Branch      string `json:"branch"`
+	PullRequest int64  `json:"pullRequest,omitempty"`
+	Author      string `json:"author"`
+	ChangeTitle string `json:"changeTitle,omitempty"`
+
+	// StatusTimestamp is the time of the event that changed the Status
+	// in milliseconds since the epoch, used to ignore the out-of-order events
+	StatusTimestamp int64 `json:"statusTimestamp,omitempty"`
+
+	// Tasks are kept in the order they were first seen in
+	Tasks []TaskState `json:"tasks"`
+
+	// Message is nil until the build's message is posted for the first time
+	Message *PostedMessage `json:"message,omitempty"`
+
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Task returns the task's state, if the task was seen before.
+func (buildState *BuildState) Task(id int64) (TaskState, bool) {
+	for _, task := range buildState.Tasks {
+		if task.ID == id {
+			return task, true
+		}
+	}
+
+	return TaskState{}, false
+}
+
+// SetTask updates the task's state or appends it if seen for the first time.
+func (buildState *BuildState) SetTask(task TaskState) {
+	for i := range buildState.Tasks {
+		if buildState.Tasks[i].ID == task.ID {
+			buildState.Tasks[i] = task
+
+			return
+		}
+	}
+
+	buildState.Tasks = append(buildState.Tasks, task)
+}
+
+func (buildState *BuildState) clone() *BuildState {
+	result := *buildState
+	result.Tasks = append([]TaskState{}, buildState.Tasks...)
+
+	return &result
+}
+
+// BuildMessages maps the Cirrus CI builds to their Slack messages,
+// optionally persisting this mapping to a file to survive restarts.
+type BuildMessages struct {
+	path   string
+	builds map[int64]*BuildState
+
+	// buildLocks serialize the updates of the same build, including
+	// the Slack API calls, to avoid posting duplicate messages when
+	// the events for the same build arrive concurrently
+	buildLocks map[int64]*sync.Mutex
+
+	// mtx protects the builds and buildLocks maps and the states in them
+	mtx sync.Mutex
+
+	dirty   bool
+	savedAt time.Time
+	saveMtx sync.Mutex
+}
+
+// NewBuildMessages loads the build messages from the path,
+// an empty path disables the persistence.
+func NewBuildMessages(path string) (*BuildMessages, error) {
+	buildMessages := &BuildMessages{
+		path:       path,
+		builds:     map[int64]*BuildState{},
+		buildLocks: map[int64]*sync.Mutex{},
+	}
+
+	if path == "" {
+		return buildMessages, nil
+	}
+
+	stateJSON, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return buildMessages, nil
+		}
+
+		return nil, fmt.Errorf("%w: failed to read %q: %v", ErrBuildMessagesFailed, path, err)
+	}
+
+	if err := json.Unmarshal(stateJSON, &buildMessages.builds); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %q: %v", ErrBuildMessagesFailed, path, err)
+	}
+
+	return buildMessages, nil
+}
+
+// Update calls the update callback with the build's state (a new one if the
+// build was not seen before), and if it returns true, calls the publish callback
+// with a copy of the updated state, keeping the message it has posted, if any.
+//
+// Updates of the same build are serialized, but only the update callback
+// is called with the lock protecting the states of all builds held.
+func (buildMessages *BuildMessages) Update(
+	buildID int64,
+	update func(*BuildState) bool,
+	publish func(*BuildState) error,
+) error {
+	buildLock := buildMessages.buildLock(buildID)
+	buildLock.Lock()
+	defer buildLock.Unlock()
+
+	buildMessages.mtx.Lock()
+
+	buildState, ok := buildMessages.builds[buildID]
+	if !ok {
+		buildState = &BuildState{ID: buildID}
+		buildMessages.builds[buildID] = buildState
+	}
+
+	if !update(buildState) {
+		buildMessages.mtx.Unlock()
+
+		return nil
+	}
+
+	buildState.UpdatedAt = time.Now()
+	buildMessages.dirty = true
+
+	snapshot := buildState.clone()
+
+	buildMessages.mtx.Unlock()
+
+	publishErr := publish(snapshot)
+
+	buildMessages.mtx.Lock()
+	posted := buildState.Message == nil && snapshot.Message != nil
+	buildState.Message = snapshot.Message
+	buildMessages.mtx.Unlock()
+
+	if err := buildMessages.save(posted); err != nil {
+		return err
+	}
+
+	return publishErr
+}
+
+func (buildMessages *BuildMessages) buildLock(buildID int64) *sync.Mutex {
+	buildMessages.mtx.Lock()
+	defer buildMessages.mtx.Unlock()
+
+	buildLock, ok := buildMessages.buildLocks[buildID]
+	if !ok {
+		buildLock = &sync.Mutex{}
+		buildMessages.buildLocks[buildID] = buildLock
+	}
+
+	return buildLock
+}
+
+// Close persists the state if it was not persisted yet.
+func (buildMessages *BuildMessages) Close() error {
+	return buildMessages.save(true)
+}
+
+func (buildMessages *BuildMessages) save(force bool) error {
+	if buildMessages.path == "" {
+		return nil
+	}
+
+	// Serialize the saves, so that an older state never overwrites a newer one
+	buildMessages.saveMtx.Lock()
+	defer buildMessages.saveMtx.Unlock()
+
+	buildMessages.mtx.Lock()
+
+	if !buildMessages.dirty || (!force && time.Since(buildMessages.savedAt) < saveInterval) {
+		buildMessages.mtx.Unlock()
+
+		return nil
+	}
+
+	for id, buildState := range buildMessages.builds {
+		if time.Since(buildState.UpdatedAt) > buildMessageRetention {
+			delete(buildMessages.builds, id)
+			delete(buildMessages.buildLocks, id)
+		}
+	}
+
+	stateJSON, err := json.Marshal(buildMessages.builds)
+
+	buildMessages.dirty = false
+	buildMessages.savedAt = time.Now()
+
+	buildMessages.mtx.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("%w: failed to marshal the state as JSON: %v", ErrBuildMessagesFailed, err)
+	}
+
+	if err := writeFileAtomically(buildMessages.path, stateJSON); err != nil {
+		// Retry on the next update
+		buildMessages.mtx.Lock()
+		buildMessages.dirty = true
+		buildMessages.mtx.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	// Write to a temporary file first and then rename it
+	// to avoid ending up with a partially written file
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("%w: failed to create a temporary file: %v", ErrBuildMessagesFailed, err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+
+		return fmt.Errorf("%w: failed to write to a temporary file: %v", ErrBuildMessagesFailed, err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("%w: failed to close a temporary file: %v", ErrBuildMessagesFailed, err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("%w: failed to rename a temporary file: %v", ErrBuildMessagesFailed, err)
+	}
+
+	return nil
+}
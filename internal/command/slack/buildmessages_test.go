@@ -0,0 +1,124 @@
+package slack_test
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/slack"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildUpdates(t *testing.T) {
+	fakeSlack := newFakeSlack(t)
+
+	router, err := slack.NewRouter(nil, "#ci")
+	require.NoError(t, err)
+
+	stateFile := filepath.Join(t.TempDir(), "slack-build-messages.json")
+
+	newProcessor := func() *slack.Processor {
+		buildMessages, err := slack.NewBuildMessages(stateFile)
+		require.NoError(t, err)
+
+		return &slack.Processor{
+			Client:        slack.NewClient(fakeSlack.URL+"/api", "xoxb-test"),
+			Router:        router,
+			Statuses:      mapset.NewSet[string](),
+			BuildMessages: buildMessages,
+		}
+	}
+
+	processor := newProcessor()
+
+	// The first event posts a new message
+	processTestdata(t, processor, "task", "task.json", nil)
+
+	requests := fakeSlack.Requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, "/api/chat.postMessage", requests[0].Path)
+	require.Equal(t, "#ci", requests[0].Body["channel"])
+	require.Contains(t, requests[0].Body["text"], "Build *5082236150611968* for *main*")
+
+	// Subsequent events update the same message
+	processTestdata(t, processor, "task", "task.json", failTask)
+
+	requests = fakeSlack.Requests()
+	require.Len(t, requests, 2)
+	require.Equal(t, "/api/chat.update", requests[1].Path)
+	require.Equal(t, "C123", requests[1].Body["channel"])
+	require.Equal(t, "1722408869.000100", requests[1].Body["ts"])
+	require.Contains(t, requests[1].Body["blocks"].([]any)[2].(map[string]any)["text"].(map[string]any)["text"],
+		":x: <https://cirrus-ci.com/task/6017965227769856|Lint (cargo fmt)>")
+
+	// Out-of-order events are ignored
+	processTestdata(t, processor, "task", "task.json", func(payload map[string]any) {
+		payload["task"].(map[string]any)["statusTimestamp"] = 1722408844000
+	})
+	require.Len(t, fakeSlack.Requests(), 2)
+
+	// Messages are updated in place even after a restart
+	require.NoError(t, processor.BuildMessages.Close())
+	processor = newProcessor()
+
+	processTestdata(t, processor, "task", "task.json", func(payload map[string]any) {
+		payload["task"].(map[string]any)["id"] = 42
+		payload["task"].(map[string]any)["name"] = "Test"
+	})
+
+	requests = fakeSlack.Requests()
+	require.Len(t, requests, 3)
+	require.Equal(t, "/api/chat.update", requests[2].Path)
+	require.Equal(t, "1722408869.000100", requests[2].Body["ts"])
+
+	checklist := requests[2].Body["blocks"].([]any)[2].(map[string]any)["text"].(map[string]any)["text"]
+	require.Equal(t, ":x: <https://cirrus-ci.com/task/6017965227769856|Lint (cargo fmt)>\n"+
+		":hourglass_flowing_sand: <https://cirrus-ci.com/task/42|Test>", checklist)
+}
+
+func TestBuildUpdatesFailureDoesNotSuppressMessages(t *testing.T) {
+	fakeSlack := newFakeSlack(t)
+
+	router, err := slack.NewRouter(nil, "#ci")
+	require.NoError(t, err)
+
+	buildMessages, err := slack.NewBuildMessages("")
+	require.NoError(t, err)
+
+	processor := &slack.Processor{
+		Client:        slack.NewClient(fakeSlack.URL+"/api", "xoxb-test"),
+		Router:        router,
+		Statuses:      mapset.NewSet("FAILED"),
+		BuildMessages: buildMessages,
+	}
+
+	processTestdata(t, processor, "task", "task.json", nil)
+	require.Len(t, fakeSlack.Requests(), 1)
+
+	// The build's message can't be updated, but the failure is still posted
+	fakeSlack.FailUpdates()
+
+	processTestdata(t, processor, "task", "task.json", failTask)
+
+	requests := fakeSlack.Requests()
+	require.Len(t, requests, 3)
+	require.Equal(t, "/api/chat.postMessage", requests[1].Path)
+	require.Contains(t, requests[1].Body["text"], "is failed")
+	require.Equal(t, "/api/chat.update", requests[2].Path)
+}
+
+func TestBuildMessageChecklistIsTruncated(t *testing.T) {
+	buildState := &slack.BuildState{ID: 1}
+
+	for i := range 200 {
+		buildState.SetTask(slack.TaskState{
+			ID:     int64(i),
+			Name:   strings.Repeat("x", 50),
+			Status: "COMPLETED",
+		})
+	}
+
+	checklist := slack.NewBuildMessage(buildState).Blocks[1].Text.Text
+	require.LessOrEqual(t, len(checklist), 3000)
+	require.Regexp(t, `\n…and \d+ more task\(s\)$`, checklist)
+}
@@ -0,0 +1,171 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var ErrSlackFailed = errors.New("failed to post a message to Slack")
+
+// Client posts messages either to the Slack's incoming webhooks[1]
+// or using the Slack's Web API chat.postMessage method[2].
+//
+// [1]: https://api.slack.com/messaging/webhooks
+// [2]: https://api.slack.com/methods/chat.postMessage
+type Client struct {
+	apiURL     string
+	botToken   string
+	httpClient *http.Client
+}
+
+type postMessageResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+func NewClient(apiURL string, botToken string) *Client {
+	return &Client{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		botToken:   botToken,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// Post posts the message to the target, which is either an
+// incoming webhook URL or a channel name or ID.
+func (client *Client) Post(ctx context.Context, target string, message *Message) error {
+	if IsWebhookURL(target) {
+		return client.PostWebhook(ctx, target, message)
+	}
+
+	_, err := client.PostMessage(ctx, target, message)
+
+	return err
+}
+
+func (client *Client) PostWebhook(ctx context.Context, webhookURL string, message *Message) error {
+	resp, err := client.doJSON(ctx, webhookURL, "", message)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+
+		return fmt.Errorf("%w: incoming webhook unexpectedly responded with HTTP %d: %s",
+			ErrSlackFailed, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// PostedMessage identifies a message posted using the Slack's Web API.
+type PostedMessage struct {
+	// Channel is the ID of the channel the message was posted to.
+	Channel string `json:"channel"`
+
+	// TS is the message's timestamp, which is also its ID within the channel.
+	TS string `json:"ts"`
+}
+
+// PostMessage posts the message to the channel, the returned message's channel ID and timestamp
+// can be used to refer to this message in the subsequent API calls, such as UpdateMessage.
+func (client *Client) PostMessage(ctx context.Context, channel string, message *Message) (*PostedMessage, error) {
+	return client.callChatMethod(ctx, "chat.postMessage", channel, "", message)
+}
+
+// UpdateMessage updates the previously posted message using the chat.update[1] API method.
+//
+// [1]: https://api.slack.com/methods/chat.update
+func (client *Client) UpdateMessage(ctx context.Context, posted *PostedMessage, message *Message) error {
+	_, err := client.callChatMethod(ctx, "chat.update", posted.Channel, posted.TS, message)
+
+	return err
+}
+
+func (client *Client) callChatMethod(
+	ctx context.Context,
+	method string,
+	channel string,
+	ts string,
+	message *Message,
+) (*PostedMessage, error) {
+	if client.botToken == "" {
+		return nil, fmt.Errorf("%w: cannot post to the channel %q without a bot token",
+			ErrSlackFailed, channel)
+	}
+
+	request := struct {
+		Channel string `json:"channel"`
+		TS      string `json:"ts,omitempty"`
+		*Message
+	}{
+		Channel: channel,
+		TS:      ts,
+		Message: message,
+	}
+
+	resp, err := client.doJSON(ctx, client.apiURL+"/"+method, client.botToken, &request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s unexpectedly responded with HTTP %d",
+			ErrSlackFailed, method, resp.StatusCode)
+	}
+
+	var response postMessageResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode %s response: %v", ErrSlackFailed, method, err)
+	}
+
+	if !response.OK {
+		return nil, fmt.Errorf("%w: %s failed: %s", ErrSlackFailed, method, response.Error)
+	}
+
+	return &PostedMessage{
+		Channel: response.Channel,
+		TS:      response.TS,
+	}, nil
+}
+
+func (client *Client) doJSON(ctx context.Context, url string, botToken string, v any) (*http.Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to marshal the request as JSON: %v", ErrSlackFailed, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create request: %v", ErrSlackFailed, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	if botToken != "" {
+		req.Header.Set("Authorization", "Bearer "+botToken)
+	}
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to make request: %v", ErrSlackFailed, err)
+	}
+
+	return resp, nil
+}
+
+func IsWebhookURL(target string) bool {
+	return strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "http://")
+}
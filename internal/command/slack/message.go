@@ -0,0 +1,231 @@
+package slack
+
+import (
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"strings"
+)
+
+// maxSectionTextLength is the maximum length of the section block's text[1].
+//
+// [1]: https://api.slack.com/reference/block-kit/blocks#section
+const maxSectionTextLength = 3000
+
+const omittedTasksNote = "\n…and %d more task(s)"
+
+// Message is a Slack message composed of the Block Kit[1] blocks.
+//
+// [1]: https://api.slack.com/block-kit
+type Message struct {
+	Text   string  `json:"text"`
+	Blocks []Block `json:"blocks,omitempty"`
+}
+
+type Block struct {
+	Type     string `json:"type"`
+	Text     *Text  `json:"text,omitempty"`
+	Fields   []Text `json:"fields,omitempty"`
+	Elements []any  `json:"elements,omitempty"` // Text for "context" blocks, Element for "actions" blocks
+}
+
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type Element struct {
+	Type string `json:"type"`
+	Text *Text  `json:"text,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+func StatusEmoji(status string) string {
+	switch status {
+	case "COMPLETED":
+		return ":white_check_mark:"
+	case "FAILED":
+		return ":x:"
+	case "ERRORED":
+		return ":warning:"
+	case "ABORTED":
+		return ":no_entry_sign:"
+	case "EXECUTING":
+		return ":hourglass_flowing_sand:"
+	case "SKIPPED":
+		return ":fast_forward:"
+	default:
+		return ":grey_question:"
+	}
+}
+
+// NewMessage creates a message describing the build or task status change.
+func NewMessage(presentedEventType string, payload *cirrus.BuildOrTask) *Message {
+	var subject, status, link string
+
+	if presentedEventType == "task" {
+		subject = fmt.Sprintf("Task *%s*", escape(cirrus.ValueOr(payload.Task.Name, "unknown")))
+		status = cirrus.ValueOr(payload.Task.Status, "UNKNOWN")
+		link = fmt.Sprintf("https://cirrus-ci.com/task/%d", cirrus.ValueOr(payload.Task.ID, 0))
+	} else {
+		subject = fmt.Sprintf("Build *%d*", cirrus.ValueOr(payload.Build.ID, 0))
+		status = cirrus.ValueOr(payload.Build.Status, "UNKNOWN")
+		link = fmt.Sprintf("https://cirrus-ci.com/build/%d", cirrus.ValueOr(payload.Build.ID, 0))
+	}
+
+	repository := payload.RepositoryFullName()
+
+	summary := fmt.Sprintf("%s %s in *%s* is %s", StatusEmoji(status), subject,
+		escape(repository), strings.ToLower(status))
+
+	fields := []Text{
+		{Type: "mrkdwn", Text: fmt.Sprintf("*Repository*\n%s", escape(repository))},
+		{Type: "mrkdwn", Text: fmt.Sprintf("*Branch*\n%s", escape(cirrus.ValueOr(payload.Build.Branch, "unknown")))},
+	}
+
+	if pullRequest := payload.Build.PullRequest; pullRequest != nil {
+		fields = append(fields, Text{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("*Pull Request*\n<https://github.com/%s/pull/%d|#%d>",
+				repository, *pullRequest, *pullRequest),
+		})
+	}
+
+	fields = append(fields, Text{
+		Type: "mrkdwn",
+		Text: fmt.Sprintf("*Author*\n%s", escape(cirrus.ValueOr(payload.Build.User.Username, "api"))),
+	})
+
+	if title := payload.Build.ChangeMessageTitle; title != nil {
+		fields = append(fields, Text{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("*Commit*\n%s", escape(*title)),
+		})
+	}
+
+	return &Message{
+		Text: fmt.Sprintf("%s: %s", summary, link),
+		Blocks: []Block{
+			{
+				Type: "section",
+				Text: &Text{Type: "mrkdwn", Text: summary},
+			},
+			{
+				Type:   "section",
+				Fields: fields,
+			},
+			{
+				Type: "actions",
+				Elements: []any{
+					Element{
+						Type: "button",
+						Text: &Text{Type: "plain_text", Text: "View in Cirrus CI"},
+						URL:  link,
+					},
+				},
+			},
+		},
+	}
+}
+
+// escape escapes the control characters as described in the Slack's documentation[1].
+//
+// [1]: https://api.slack.com/reference/surfaces/formatting#escaping
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// NewBuildMessage creates a message describing the build
+// and the statuses of all of its tasks seen so far.
+func NewBuildMessage(buildState *BuildState) *Message {
+	link := fmt.Sprintf("https://cirrus-ci.com/build/%d", buildState.ID)
+
+	status := buildState.Status
+	if status == "" {
+		status = "UNKNOWN"
+	}
+
+	summary := fmt.Sprintf("%s Build *%d* for *%s* in *%s* is %s", StatusEmoji(status), buildState.ID,
+		escape(buildState.Branch), escape(buildState.Repository), strings.ToLower(status))
+
+	var context []string
+
+	if buildState.PullRequest != 0 {
+		context = append(context, fmt.Sprintf("<https://github.com/%s/pull/%d|#%d>",
+			buildState.Repository, buildState.PullRequest, buildState.PullRequest))
+	}
+
+	if buildState.Author != "" {
+		context = append(context, fmt.Sprintf("by %s", escape(buildState.Author)))
+	}
+
+	if buildState.ChangeTitle != "" {
+		context = append(context, escape(buildState.ChangeTitle))
+	}
+
+	blocks := []Block{
+		{
+			Type: "section",
+			Text: &Text{Type: "mrkdwn", Text: summary},
+		},
+	}
+
+	if len(context) != 0 {
+		blocks = append(blocks, Block{
+			Type: "context",
+			Elements: []any{
+				Text{Type: "mrkdwn", Text: strings.Join(context, " · ")},
+			},
+		})
+	}
+
+	if len(buildState.Tasks) != 0 {
+		blocks = append(blocks, Block{
+			Type: "section",
+			Text: &Text{Type: "mrkdwn", Text: checklist(buildState.Tasks)},
+		})
+	}
+
+	blocks = append(blocks, Block{
+		Type: "actions",
+		Elements: []any{
+			Element{
+				Type: "button",
+				Text: &Text{Type: "plain_text", Text: "View in Cirrus CI"},
+				URL:  link,
+			},
+		},
+	})
+
+	return &Message{
+		Text:   fmt.Sprintf("%s: %s", summary, link),
+		Blocks: blocks,
+	}
+}
+
+// checklist renders the tasks and their statuses, omitting the tasks that
+// don't fit into the Slack's limit for the section block's text length.
+func checklist(tasks []TaskState) string {
+	var result strings.Builder
+
+	// Leave some room for the omitted tasks note
+	maxLength := maxSectionTextLength - len(fmt.Sprintf(omittedTasksNote, len(tasks)))
+
+	for i, task := range tasks {
+		line := fmt.Sprintf("%s <https://cirrus-ci.com/task/%d|%s>",
+			StatusEmoji(task.Status), task.ID, escape(task.Name))
+
+		if i != 0 {
+			line = "\n" + line
+		}
+
+		if result.Len()+len(line) > maxLength {
+			fmt.Fprintf(&result, omittedTasksNote, len(tasks)-i)
+
+			break
+		}
+
+		result.WriteString(line)
+	}
+
+	return result.String()
+}
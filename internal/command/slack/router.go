@@ -0,0 +1,131 @@
+package slack
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidRoute = errors.New("invalid route")
+
+type route struct {
+	repositoryPattern *regexp.Regexp
+	branchPattern     *regexp.Regexp
+	target            string
+}
+
+// Router picks the target (a channel or an incoming webhook URL) for the event
+// based on its repository and branch, the first matching route wins.
+type Router struct {
+	routes        []route
+	defaultTarget string
+}
+
+// NewRouter parses the routes in the "<repository>[@<branch>]=<target>" format,
+// where the repository ("owner/name") and the branch are glob patterns
+// as understood by the path.Match, except that "*" also matches "/",
+// since the branch names often contain it, for example, "cirruslabs/*@main=#ci".
+func NewRouter(rawRoutes []string, defaultTarget string) (*Router, error) {
+	router := &Router{
+		defaultTarget: defaultTarget,
+	}
+
+	for _, rawRoute := range rawRoutes {
+		match, target, found := strings.Cut(rawRoute, "=")
+		if !found || match == "" || target == "" {
+			return nil, fmt.Errorf("%w: %q should be in the \"<repository>[@<branch>]=<target>\" format",
+				ErrInvalidRoute, rawRoute)
+		}
+
+		repositoryPattern, branchPattern, found := strings.Cut(match, "@")
+		if !found {
+			branchPattern = "*"
+		}
+
+		repositoryRegexp, err := compileGlob(repositoryPattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q contains a malformed pattern %q: %v",
+				ErrInvalidRoute, rawRoute, repositoryPattern, err)
+		}
+
+		branchRegexp, err := compileGlob(branchPattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q contains a malformed pattern %q: %v",
+				ErrInvalidRoute, rawRoute, branchPattern, err)
+		}
+
+		router.routes = append(router.routes, route{
+			repositoryPattern: repositoryRegexp,
+			branchPattern:     branchRegexp,
+			target:            target,
+		})
+	}
+
+	return router, nil
+}
+
+// Route returns the target for the event or an empty string if there's none.
+func (router *Router) Route(repository string, branch string) string {
+	for _, route := range router.routes {
+		if route.repositoryPattern.MatchString(repository) && route.branchPattern.MatchString(branch) {
+			return route.target
+		}
+	}
+
+	return router.defaultTarget
+}
+
+// compileGlob compiles the glob pattern in the path.Match syntax into a regular
+// expression matching the whole string, with "*" and "?" also matching "/".
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var result strings.Builder
+
+	result.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			result.WriteString(".*")
+		case '?':
+			result.WriteString(".")
+		case '\\':
+			i++
+
+			if i == len(pattern) {
+				return nil, errors.New("trailing backslash")
+			}
+
+			result.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				return nil, errors.New("unterminated character class")
+			}
+
+			class := pattern[i+1 : i+1+end]
+
+			if negated, ok := strings.CutPrefix(class, "^"); ok {
+				class = negated
+				result.WriteString("[^")
+			} else {
+				result.WriteString("[")
+			}
+
+			if class == "" {
+				return nil, errors.New("empty character class")
+			}
+
+			result.WriteString(class)
+			result.WriteString("]")
+
+			i += 1 + end
+		default:
+			result.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	result.WriteString("$")
+
+	return regexp.Compile(result.String())
+}
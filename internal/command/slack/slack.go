@@ -0,0 +1,283 @@
+package slack
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/decoding"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"strconv"
+)
+
+var webhookURL string
+var botToken string
+var channel string
+var apiURL string
+var routes []string
+var statuses []string
+var buildUpdates bool
+var buildUpdatesStateFile string
+
+var (
+	ErrSlackProcessorFailed = errors.New("failed to post Cirrus CI events to Slack")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "slack",
+		Short: "Post Cirrus CI build and task failures to Slack",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd, "build", "task")
+	decoding.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&webhookURL, "webhook-url", "",
+		"Slack incoming webhook URL to post the messages to when no route matches")
+	cmd.PersistentFlags().StringVar(&botToken, "bot-token", "",
+		"Slack bot token to post the messages using the chat.postMessage API method "+
+			"(defaults to the SLACK_BOT_TOKEN environment variable)")
+	cmd.PersistentFlags().StringVar(&channel, "channel", "",
+		"Slack channel to post the messages to using the chat.postMessage API method when no route matches")
+	cmd.PersistentFlags().StringVar(&apiURL, "api-url", "https://slack.com/api",
+		"Slack Web API base URL")
+	cmd.PersistentFlags().StringArrayVar(&routes, "route", []string{},
+		"route the messages for the matching repository and branch to a specific channel or incoming webhook URL, "+
+			"can be specified multiple times, the first matching route wins "+
+			"(for example, --route=cirruslabs/*@main=#ci-alerts)")
+	cmd.PersistentFlags().StringSliceVar(&statuses, "statuses", []string{"FAILED", "ERRORED"},
+		"comma-separated list of the build and task statuses to post the messages for")
+	cmd.PersistentFlags().BoolVar(&buildUpdates, "build-updates", false,
+		"in addition to posting the messages for --statuses, maintain a single message per build "+
+			"that is updated in place as the build's tasks change their statuses (requires --bot-token)")
+	cmd.PersistentFlags().StringVar(&buildUpdatesStateFile, "build-updates-state-file", "slack-build-messages.json",
+		"file to persist the mapping of the builds to their messages to, so that the messages "+
+			"are updated in place even after a restart (an empty value disables the persistence)")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	botToken = server.SecretFromEnv(botToken, "SLACK_BOT_TOKEN")
+
+	if webhookURL != "" && channel != "" {
+		return fmt.Errorf("%w: --webhook-url and --channel are mutually exclusive",
+			ErrSlackProcessorFailed)
+	}
+
+	defaultTarget := webhookURL
+	if defaultTarget == "" {
+		defaultTarget = channel
+	}
+
+	if defaultTarget == "" && len(routes) == 0 {
+		return fmt.Errorf("%w: no destination configured, please specify either "+
+			"--webhook-url, --channel or --route", ErrSlackProcessorFailed)
+	}
+
+	router, err := NewRouter(routes, defaultTarget)
+	if err != nil {
+		return err
+	}
+
+	processor := &Processor{
+		Client:   NewClient(apiURL, botToken),
+		Router:   router,
+		Statuses: mapset.NewSet[string](statuses...),
+	}
+
+	if buildUpdates {
+		if botToken == "" {
+			return fmt.Errorf("%w: --build-updates requires --bot-token", ErrSlackProcessorFailed)
+		}
+
+		processor.BuildMessages, err = NewBuildMessages(buildUpdatesStateFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := processor.BuildMessages.Close(); err != nil {
+				zap.S().Warnf("%v", err)
+			}
+		}()
+	}
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+type Processor struct {
+	Client   *Client
+	Router   *Router
+	Statuses mapset.Set[string]
+
+	// BuildMessages enables the per-build messages updated in place when non-nil
+	BuildMessages *BuildMessages
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	// Decode the event
+	var payload cirrus.BuildOrTask
+
+	if err := cirrus.Decode(body, &payload, decoding.Mode()); err != nil {
+		return fmt.Errorf("failed to parse the webhook event of type %q as JSON: %w",
+			presentedEventType, err)
+	}
+
+	// Post the message for the statuses we're interested in first,
+	// so that it's never suppressed by the build's message update
+	if err := processor.postMessage(ctx, presentedEventType, &payload, logger); err != nil {
+		return err
+	}
+
+	// Failing to update the build's message is not worth a re-delivery
+	// of the event, since the build's message is rendered from scratch
+	// and will be brought up-to-date by the build's next event
+	if processor.BuildMessages != nil {
+		if err := processor.updateBuildMessage(ctx, presentedEventType, &payload, logger); err != nil {
+			logger.Warnf("%v: %v", ErrSlackProcessorFailed, err)
+		}
+	}
+
+	return nil
+}
+
+func (processor *Processor) postMessage(
+	ctx echo.Context,
+	presentedEventType string,
+	payload *cirrus.BuildOrTask,
+	logger *zap.SugaredLogger,
+) error {
+	// Only post the statuses we're interested in
+	var status *string
+
+	switch presentedEventType {
+	case "task":
+		status = payload.Task.Status
+	case "build":
+		status = payload.Build.Status
+	default:
+		return nil
+	}
+
+	if !payload.IsNewStatus(status) || !processor.Statuses.Contains(*status) {
+		logger.Debugf("skipping event of type %q because its status is not new or not interesting",
+			presentedEventType)
+
+		return nil
+	}
+
+	target := processor.Router.Route(payload.RepositoryFullName(), cirrus.ValueOr(payload.Build.Branch, ""))
+	if target == "" {
+		logger.Debugf("skipping event of type %q because no route matched", presentedEventType)
+
+		return nil
+	}
+
+	if err := processor.Client.Post(ctx.Request().Context(), target,
+		NewMessage(presentedEventType, payload)); err != nil {
+		return fmt.Errorf("%w: %v", ErrSlackProcessorFailed, err)
+	}
+
+	return nil
+}
+
+func (processor *Processor) updateBuildMessage(
+	ctx echo.Context,
+	presentedEventType string,
+	payload *cirrus.BuildOrTask,
+	logger *zap.SugaredLogger,
+) error {
+	if payload.Build.ID == nil {
+		return nil
+	}
+
+	target := processor.Router.Route(payload.RepositoryFullName(), cirrus.ValueOr(payload.Build.Branch, ""))
+	if target == "" || IsWebhookURL(target) {
+		logger.Debugf("not updating the message for build %d because it's not routed to a channel",
+			*payload.Build.ID)
+
+		return nil
+	}
+
+	// Task events carry the task's status timestamp, which is used to
+	// ignore the out-of-order events, and the build events carry nothing
+	// similar, so fall back to the time the event was sent at
+	var eventTimestamp int64
+
+	if presentedEventType == "task" {
+		eventTimestamp = cirrus.ValueOr(payload.Task.StatusTimestamp, 0)
+	} else if rawTimestamp := ctx.Request().Header.Get("X-Cirrus-Timestamp"); rawTimestamp != "" {
+		eventTimestamp, _ = strconv.ParseInt(rawTimestamp, 10, 64)
+	}
+
+	update := func(buildState *BuildState) bool {
+		buildStatusIsStale := eventTimestamp != 0 && eventTimestamp < buildState.StatusTimestamp
+
+		switch presentedEventType {
+		case "task":
+			if payload.Task.ID == nil {
+				return false
+			}
+
+			if task, ok := buildState.Task(*payload.Task.ID); ok && eventTimestamp < task.StatusTimestamp {
+				logger.Debugf("ignoring an out-of-order event for task %d", *payload.Task.ID)
+
+				return false
+			}
+
+			buildState.SetTask(TaskState{
+				ID:              *payload.Task.ID,
+				Name:            cirrus.ValueOr(payload.Task.Name, "unknown"),
+				Status:          cirrus.ValueOr(payload.Task.Status, "UNKNOWN"),
+				StatusTimestamp: eventTimestamp,
+			})
+		case "build":
+			if buildStatusIsStale {
+				logger.Debugf("ignoring an out-of-order event for build %d", *payload.Build.ID)
+
+				return false
+			}
+		}
+
+		if value := payload.Build.Status; value != nil && !buildStatusIsStale {
+			buildState.Status = *value
+			buildState.StatusTimestamp = max(buildState.StatusTimestamp, eventTimestamp)
+		}
+
+		buildState.Repository = payload.RepositoryFullName()
+		buildState.Branch = cirrus.ValueOr(payload.Build.Branch, buildState.Branch)
+		buildState.PullRequest = cirrus.ValueOr(payload.Build.PullRequest, buildState.PullRequest)
+		buildState.Author = cirrus.ValueOr(payload.Build.User.Username, buildState.Author)
+		buildState.ChangeTitle = cirrus.ValueOr(payload.Build.ChangeMessageTitle, buildState.ChangeTitle)
+
+		return true
+	}
+
+	publish := func(buildState *BuildState) error {
+		message := NewBuildMessage(buildState)
+
+		if buildState.Message == nil {
+			postedMessage, err := processor.Client.PostMessage(ctx.Request().Context(), target, message)
+			if err != nil {
+				return err
+			}
+
+			buildState.Message = postedMessage
+
+			return nil
+		}
+
+		return processor.Client.UpdateMessage(ctx.Request().Context(), buildState.Message, message)
+	}
+
+	return processor.BuildMessages.Update(*payload.Build.ID, update, publish)
+}
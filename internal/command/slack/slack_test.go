@@ -0,0 +1,216 @@
+package slack_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/slack"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeSlackRequest struct {
+	Path          string
+	Authorization string
+	Body          map[string]any
+}
+
+type fakeSlack struct {
+	*httptest.Server
+
+	mtx         sync.Mutex
+	requests    []fakeSlackRequest
+	failUpdates bool
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	fakeSlack := &fakeSlack{}
+
+	fakeSlack.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+
+		fakeSlack.mtx.Lock()
+		fakeSlack.requests = append(fakeSlack.requests, fakeSlackRequest{
+			Path:          request.URL.Path,
+			Authorization: request.Header.Get("Authorization"),
+			Body:          body,
+		})
+		failUpdates := fakeSlack.failUpdates
+		fakeSlack.mtx.Unlock()
+
+		switch {
+		case request.URL.Path == "/api/chat.update" && failUpdates:
+			_, _ = writer.Write([]byte(`{"ok": false, "error": "invalid_blocks"}`))
+		case strings.HasPrefix(request.URL.Path, "/api/chat."):
+			if request.Header.Get("Authorization") != "Bearer xoxb-test" {
+				_, _ = writer.Write([]byte(`{"ok": false, "error": "invalid_auth"}`))
+
+				return
+			}
+
+			_, _ = writer.Write([]byte(`{"ok": true, "channel": "C123", "ts": "1722408869.000100"}`))
+		case strings.HasPrefix(request.URL.Path, "/webhook/"):
+			_, _ = writer.Write([]byte("ok"))
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(fakeSlack.Close)
+
+	return fakeSlack
+}
+
+func (fakeSlack *fakeSlack) FailUpdates() {
+	fakeSlack.mtx.Lock()
+	defer fakeSlack.mtx.Unlock()
+
+	fakeSlack.failUpdates = true
+}
+
+func (fakeSlack *fakeSlack) Requests() []fakeSlackRequest {
+	fakeSlack.mtx.Lock()
+	defer fakeSlack.mtx.Unlock()
+
+	return append([]fakeSlackRequest{}, fakeSlack.requests...)
+}
+
+func processTestdata(t *testing.T, processor *slack.Processor, eventType string, name string, mutate func(map[string]any)) {
+	var mutators []func(map[string]any)
+
+	if mutate != nil {
+		mutators = append(mutators, mutate)
+	}
+
+	testutil.MustDeliver(t, processor.ProcessWebhookEvent, eventType, testutil.Testdata(t, name, mutators...))
+}
+
+func failTask(payload map[string]any) {
+	payload["task"].(map[string]any)["status"] = "FAILED"
+}
+
+func TestPostsFailedTaskUsingAPI(t *testing.T) {
+	fakeSlack := newFakeSlack(t)
+
+	router, err := slack.NewRouter([]string{"edigaryev/*@main=#ci-alerts"}, "#default")
+	require.NoError(t, err)
+
+	processor := &slack.Processor{
+		Client:   slack.NewClient(fakeSlack.URL+"/api", "xoxb-test"),
+		Router:   router,
+		Statuses: mapset.NewSet("FAILED", "ERRORED"),
+	}
+
+	// Executing task should be skipped
+	processTestdata(t, processor, "task", "task.json", nil)
+	require.Empty(t, fakeSlack.Requests())
+
+	// Failed task should be posted
+	processTestdata(t, processor, "task", "task.json", failTask)
+
+	requests := fakeSlack.Requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, "/api/chat.postMessage", requests[0].Path)
+	require.Equal(t, "Bearer xoxb-test", requests[0].Authorization)
+	require.Equal(t, "#ci-alerts", requests[0].Body["channel"])
+	require.Contains(t, requests[0].Body["text"], "Task *Lint (cargo fmt)* in *edigaryev/awesome-system-calls* is failed")
+	require.Contains(t, requests[0].Body["text"], "https://cirrus-ci.com/task/6017965227769856")
+
+	blocksJSON, err := json.Marshal(requests[0].Body["blocks"])
+	require.NoError(t, err)
+	require.Contains(t, string(blocksJSON), "*Author*\\nedigaryev")
+	require.Contains(t, string(blocksJSON), "*Branch*\\nmain")
+}
+
+func TestPostsFailedTaskUsingWebhook(t *testing.T) {
+	fakeSlack := newFakeSlack(t)
+
+	router, err := slack.NewRouter([]string{"other/*=#other"}, fakeSlack.URL+"/webhook/T000/B000/XXX")
+	require.NoError(t, err)
+
+	processor := &slack.Processor{
+		Client:   slack.NewClient(fakeSlack.URL+"/api", ""),
+		Router:   router,
+		Statuses: mapset.NewSet("FAILED", "ERRORED"),
+	}
+
+	processTestdata(t, processor, "task", "task.json", failTask)
+
+	requests := fakeSlack.Requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, "/webhook/T000/B000/XXX", requests[0].Path)
+	require.Empty(t, requests[0].Authorization)
+	require.NotContains(t, requests[0].Body, "channel")
+}
+
+func TestPostsRepeatedFailedUpdateOnce(t *testing.T) {
+	fakeSlack := newFakeSlack(t)
+
+	router, err := slack.NewRouter(nil, "#default")
+	require.NoError(t, err)
+
+	processor := &slack.Processor{
+		Client:   slack.NewClient(fakeSlack.URL+"/api", "xoxb-test"),
+		Router:   router,
+		Statuses: mapset.NewSet("FAILED", "ERRORED"),
+	}
+
+	failedUpdate := func(payload map[string]any) {
+		failTask(payload)
+		payload["action"] = "updated"
+		payload["old_status"] = "FAILED"
+	}
+
+	// The first delivery reports the status change, the repeated
+	// one is for a task that has already failed
+	processTestdata(t, processor, "task", "task.json", func(payload map[string]any) {
+		failedUpdate(payload)
+		payload["old_status"] = "EXECUTING"
+	})
+	processTestdata(t, processor, "task", "task.json", failedUpdate)
+
+	require.Len(t, fakeSlack.Requests(), 1)
+}
+
+func TestPostFailsOnSlackError(t *testing.T) {
+	fakeSlack := newFakeSlack(t)
+
+	client := slack.NewClient(fakeSlack.URL+"/api", "xoxb-wrong")
+
+	_, err := client.PostMessage(context.Background(), "#ci-alerts", &slack.Message{Text: "test"})
+	require.ErrorIs(t, err, slack.ErrSlackFailed)
+	require.ErrorContains(t, err, "invalid_auth")
+}
+
+func TestRouter(t *testing.T) {
+	router, err := slack.NewRouter([]string{
+		"cirruslabs/cirrus-cli@release/*=#cli-releases",
+		"cirruslabs/*=#cirruslabs",
+	}, "#default")
+	require.NoError(t, err)
+
+	require.Equal(t, "#cli-releases", router.Route("cirruslabs/cirrus-cli", "release/v1"))
+	require.Equal(t, "#cirruslabs", router.Route("cirruslabs/cirrus-cli", "main"))
+	require.Equal(t, "#default", router.Route("edigaryev/awesome-system-calls", "main"))
+
+	// Branch names containing a slash are matched by "*" too
+	require.Equal(t, "#cli-releases", router.Route("cirruslabs/cirrus-cli", "release/v1/hotfix"))
+	require.Equal(t, "#cirruslabs", router.Route("cirruslabs/cirrus-cli", "feature/x"))
+
+	router, err = slack.NewRouter([]string{"cirruslabs/*@feature/*=#features"}, "#default")
+	require.NoError(t, err)
+	require.Equal(t, "#features", router.Route("cirruslabs/cirrus-cli", "feature/x/y"))
+	require.Equal(t, "#default", router.Route("cirruslabs/cirrus-cli", "main"))
+	require.Equal(t, "#default", router.Route("cirruslabs/cirrus-cli", "x/feature/y"))
+
+	_, err = slack.NewRouter([]string{"cirruslabs/*"}, "")
+	require.ErrorIs(t, err, slack.ErrInvalidRoute)
+
+	_, err = slack.NewRouter([]string{"cirruslabs/[=#channel"}, "")
+	require.ErrorIs(t, err, slack.ErrInvalidRoute)
+}
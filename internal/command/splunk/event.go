@@ -0,0 +1,76 @@
+package splunk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// Event is the HTTP Event Collector's event in the JSON format[1].
+//
+// [1]: https://docs.splunk.com/Documentation/Splunk/latest/Data/FormateventsforHTTPEventCollector
+type Event struct {
+	Time       json.Number       `json:"time"`
+	Host       string            `json:"host,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Sourcetype string            `json:"sourcetype,omitempty"`
+	Index      string            `json:"index,omitempty"`
+	Event      json.RawMessage   `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// NewEvent creates an HTTP Event Collector event for the webhook event.
+//
+// The event's body is the webhook event's body as is, while its time is
+// the audit event's timestamp or the task's status timestamp, which stay
+// the same across the re-deliveries, falling back to the "X-Cirrus-Timestamp"
+// header for the events without these timestamps, such as the build events.
+// An empty sourcetype results in "cirrus:<event type>".
+func NewEvent(
+	header http.Header,
+	presentedEventType string,
+	body []byte,
+	host string,
+	source string,
+	sourcetype string,
+	index string,
+	logger *zap.SugaredLogger,
+) (*Event, error) {
+	if !json.Valid(body) {
+		return nil, errors.New("webhook event's body is not a valid JSON")
+	}
+
+	var payload cirrus.AuditEvent
+
+	if err := cirrus.Decode(body, &payload, cirrus.DecodingModeLenient); err != nil {
+		return nil, err
+	}
+
+	if sourcetype == "" {
+		sourcetype = "cirrus:" + presentedEventType
+	}
+
+	return &Event{
+		Time:       formatTime(cirrus.EventTime(header, logger, payload.Timestamp, payload.Task.StatusTimestamp)),
+		Host:       host,
+		Source:     source,
+		Sourcetype: sourcetype,
+		Index:      index,
+		Event:      body,
+		Fields: map[string]string{
+			"event_type": presentedEventType,
+		},
+	}, nil
+}
+
+// formatTime formats the time as the HTTP Event Collector expects it,
+// that is, seconds since the epoch with the millisecond precision.
+func formatTime(t time.Time) json.Number {
+	milliseconds := t.UnixMilli()
+
+	return json.Number(fmt.Sprintf("%d.%03d", milliseconds/1000, milliseconds%1000))
+}
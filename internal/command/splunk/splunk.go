@@ -0,0 +1,444 @@
+package splunk
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/batch"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var splunkURL string
+var token string
+var index string
+var source string
+var sourcetype string
+var host string
+var buildsAndTasks bool
+var batchSize int
+var flushInterval time.Duration
+var ack bool
+var ackPollInterval time.Duration
+var ackTimeout time.Duration
+var tlsInsecureSkipVerify bool
+
+var (
+	ErrSplunkFailed = errors.New("failed to send Cirrus CI events to Splunk")
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "splunk",
+		Short: "Send Cirrus CI webhook events to Splunk HTTP Event Collector",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&splunkURL, "url", "",
+		"Splunk HTTP Event Collector URL (for example, https://splunk:8088)")
+	cmd.PersistentFlags().StringVar(&token, "token", "",
+		"HTTP Event Collector token (defaults to the SPLUNK_HEC_TOKEN environment variable)")
+	cmd.PersistentFlags().StringVar(&index, "index", "",
+		"index to send the events to (defaults to the token's default index)")
+	cmd.PersistentFlags().StringVar(&source, "source", "cirrus-webhooks-server",
+		"source of the events")
+	cmd.PersistentFlags().StringVar(&sourcetype, "sourcetype", "",
+		"sourcetype of the events (defaults to \"cirrus:<event type>\", for example, \"cirrus:audit_event\")")
+	cmd.PersistentFlags().StringVar(&host, "host", "",
+		"host of the events (defaults to the token's default host)")
+	cmd.PersistentFlags().BoolVar(&buildsAndTasks, "builds-and-tasks", false,
+		"in addition to the audit events, send the build and task events")
+	cmd.PersistentFlags().IntVar(&batchSize, "batch-size", 100,
+		"maximum number of the webhook events to send using a single request")
+	cmd.PersistentFlags().DurationVar(&flushInterval, "flush-interval", time.Second,
+		"maximum time to wait for more webhook events before sending the request")
+	cmd.PersistentFlags().BoolVar(&ack, "ack", false,
+		"only acknowledge the webhook events to Cirrus CI once the HTTP Event Collector "+
+			"acknowledges that they were indexed (requires indexer acknowledgment "+
+			"to be enabled for the token)")
+	cmd.PersistentFlags().DurationVar(&ackPollInterval, "ack-poll-interval", time.Second,
+		"how often to poll the HTTP Event Collector for the indexer acknowledgment")
+	cmd.PersistentFlags().DurationVar(&ackTimeout, "ack-timeout", time.Minute,
+		"maximum time to wait for the indexer acknowledgment")
+	cmd.PersistentFlags().BoolVar(&tlsInsecureSkipVerify, "tls-insecure-skip-verify", false,
+		"do not verify the HTTP Event Collector's certificate")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	token = server.SecretFromEnv(token, "SPLUNK_HEC_TOKEN")
+
+	if splunkURL == "" {
+		return fmt.Errorf("%w: \"--url\" is required", ErrSplunkFailed)
+	}
+
+	if token == "" {
+		return fmt.Errorf("%w: \"--token\" is required", ErrSplunkFailed)
+	}
+
+	if batchSize < 1 {
+		return fmt.Errorf("%w: \"--batch-size\" should be at least 1", ErrSplunkFailed)
+	}
+
+	opts := []Option{
+		WithIndex(index),
+		WithSource(source),
+		WithSourcetype(sourcetype),
+		WithHost(host),
+	}
+
+	if buildsAndTasks {
+		opts = append(opts, WithBuildsAndTasks())
+	}
+
+	if ack {
+		opts = append(opts, WithAck(ackPollInterval, ackTimeout))
+	}
+
+	if tlsInsecureSkipVerify {
+		opts = append(opts, WithTLSInsecureSkipVerify())
+	}
+
+	processor, err := NewProcessor(splunkURL, token, batchSize, flushInterval, opts...)
+	if err != nil {
+		return err
+	}
+	defer processor.Close()
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+type Option func(*Processor)
+
+// WithIndex sends the events to the given index instead of the token's default index.
+func WithIndex(index string) Option {
+	return func(processor *Processor) {
+		processor.index = index
+	}
+}
+
+func WithSource(source string) Option {
+	return func(processor *Processor) {
+		processor.source = source
+	}
+}
+
+// WithSourcetype overrides the default "cirrus:<event type>" sourcetype.
+func WithSourcetype(sourcetype string) Option {
+	return func(processor *Processor) {
+		processor.sourcetype = sourcetype
+	}
+}
+
+func WithHost(host string) Option {
+	return func(processor *Processor) {
+		processor.host = host
+	}
+}
+
+// WithBuildsAndTasks sends the build and task events
+// in addition to the audit events.
+func WithBuildsAndTasks() Option {
+	return func(processor *Processor) {
+		processor.buildsAndTasks = true
+	}
+}
+
+// WithAck sends the events using a dedicated channel and waits for
+// the indexer acknowledgment of each request, polling for it every
+// pollInterval for at most timeout.
+func WithAck(pollInterval time.Duration, timeout time.Duration) Option {
+	return func(processor *Processor) {
+		processor.channel = uuid.NewString()
+		processor.ackPollInterval = pollInterval
+		processor.ackTimeout = timeout
+	}
+}
+
+func WithTLSInsecureSkipVerify() Option {
+	return func(processor *Processor) {
+		processor.httpClient.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				//nolint:gosec // explicitly requested by the user
+				InsecureSkipVerify: true,
+			},
+		}
+	}
+}
+
+type Processor struct {
+	eventURL string
+	ackURL   string
+	token    string
+
+	index          string
+	source         string
+	sourcetype     string
+	host           string
+	buildsAndTasks bool
+
+	channel         string
+	ackPollInterval time.Duration
+	ackTimeout      time.Duration
+
+	httpClient *http.Client
+
+	batcher *batch.Batcher[*item]
+}
+
+// item is an event submitted to the batcher along with the acknowledgment
+// ID of the request it was sent with, which is only set with WithAck.
+type item struct {
+	event *Event
+	ackID int64
+}
+
+func NewProcessor(
+	rawURL string,
+	token string,
+	batchSize int,
+	flushInterval time.Duration,
+	opts ...Option,
+) (*Processor, error) {
+	baseURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse URL: %v", ErrSplunkFailed, err)
+	}
+
+	processor := &Processor{
+		eventURL: baseURL.JoinPath("services", "collector", "event").String(),
+		ackURL:   baseURL.JoinPath("services", "collector", "ack").String(),
+		token:    token,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(processor)
+	}
+
+	// Send the events of the concurrent webhook events using a single request
+	processor.batcher = batch.New(batchSize, flushInterval, 30*time.Second, processor.send)
+
+	return processor, nil
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	switch presentedEventType {
+	case "audit_event":
+		// always sent
+	case "build", "task":
+		if !processor.buildsAndTasks {
+			logger.Debugf("skipping event %q because \"--builds-and-tasks\" is not enabled",
+				presentedEventType)
+
+			return nil
+		}
+	default:
+		logger.Debugf("skipping event %q because it's not supported", presentedEventType)
+
+		return nil
+	}
+
+	event, err := NewEvent(ctx.Request().Header, presentedEventType, body,
+		processor.host, processor.source, processor.sourcetype, processor.index, logger)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSplunkFailed, err)
+	}
+
+	item := &item{event: event}
+
+	if err := processor.batcher.Submit(ctx.Request().Context(), item); err != nil {
+		return fmt.Errorf("%w: %v", ErrSplunkFailed, err)
+	}
+
+	if processor.channel == "" {
+		return nil
+	}
+
+	// Wait for the indexer acknowledgment in the webhook event's own goroutine
+	// instead of the batcher's, so that the batcher keeps sending the events
+	// of the other webhook events in the meantime
+	if err := processor.waitForAck(ctx.Request().Context(), item.ackID); err != nil {
+		return fmt.Errorf("%w: %v", ErrSplunkFailed, err)
+	}
+
+	return nil
+}
+
+// Close sends the pending events and stops the processor.
+func (processor *Processor) Close() {
+	processor.batcher.Close()
+}
+
+type eventResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+type ackRequest struct {
+	Acks []int64 `json:"acks"`
+}
+
+type ackResponse struct {
+	Acks map[string]bool `json:"acks"`
+}
+
+// send sends the events using a single request, which the HTTP Event
+// Collector either accepts or rejects as a whole, and records the request's
+// acknowledgment ID on each of the items without waiting for it.
+func (processor *Processor) send(ctx context.Context, items []*item) []error {
+	errs := make([]error, len(items))
+
+	ackID, err := processor.sendEvents(ctx, items)
+
+	for i, item := range items {
+		if err != nil {
+			errs[i] = err
+
+			continue
+		}
+
+		item.ackID = ackID
+	}
+
+	return errs
+}
+
+func (processor *Processor) sendEvents(ctx context.Context, items []*item) (int64, error) {
+	// HTTP Event Collector expects the batched events to be simply concatenated
+	var buf bytes.Buffer
+
+	for _, item := range items {
+		eventJSON, err := json.Marshal(item.event)
+		if err != nil {
+			return 0, err
+		}
+
+		buf.Write(eventJSON)
+	}
+
+	resp, err := processor.do(ctx, processor.eventURL, &buf)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("event request failed with HTTP %d: %s", resp.StatusCode, responseBody)
+	}
+
+	if processor.channel == "" {
+		return 0, nil
+	}
+
+	var eventResponse eventResponse
+
+	if err := json.Unmarshal(responseBody, &eventResponse); err != nil {
+		return 0, fmt.Errorf("failed to parse event response: %v", err)
+	}
+
+	if eventResponse.AckID == nil {
+		return 0, errors.New("event response contains no acknowledgment ID, " +
+			"is the indexer acknowledgment enabled for the token?")
+	}
+
+	return *eventResponse.AckID, nil
+}
+
+// waitForAck polls the HTTP Event Collector until the request
+// with the given acknowledgment ID is indexed.
+func (processor *Processor) waitForAck(ctx context.Context, ackID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, processor.ackTimeout)
+	defer cancel()
+
+	ackRequestJSON, err := json.Marshal(ackRequest{Acks: []int64{ackID}})
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(processor.ackPollInterval)
+	defer ticker.Stop()
+
+	for {
+		acked, err := processor.pollAck(ctx, ackID, ackRequestJSON)
+		if err != nil {
+			return err
+		}
+
+		if acked {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the indexer acknowledgment %d", ackID)
+		}
+	}
+}
+
+func (processor *Processor) pollAck(ctx context.Context, ackID int64, ackRequestJSON []byte) (bool, error) {
+	resp, err := processor.do(ctx, processor.ackURL, bytes.NewReader(ackRequestJSON))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+
+		return false, fmt.Errorf("ack request failed with HTTP %d: %s", resp.StatusCode, responseBody)
+	}
+
+	var ackResponse ackResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&ackResponse); err != nil {
+		return false, fmt.Errorf("failed to parse ack response: %v", err)
+	}
+
+	return ackResponse.Acks[strconv.FormatInt(ackID, 10)], nil
+}
+
+func (processor *Processor) do(ctx context.Context, requestURL string, body io.Reader) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Splunk "+processor.token)
+
+	if processor.channel != "" {
+		request.Header.Set("X-Splunk-Request-Channel", processor.channel)
+	}
+
+	return processor.httpClient.Do(request)
+}
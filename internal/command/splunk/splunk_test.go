@@ -0,0 +1,220 @@
+package splunk_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/splunk"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeHEC struct {
+	URL string
+
+	requests [][]splunk.Event
+	channels []string
+	ackPolls map[int64]int
+	// neverAcked are the acknowledgment IDs that are never acknowledged
+	neverAcked map[int64]bool
+	mtx        sync.Mutex
+}
+
+func newFakeHEC(t *testing.T) *fakeHEC {
+	fakeHEC := &fakeHEC{
+		ackPolls:   map[int64]int{},
+		neverAcked: map[int64]bool{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /services/collector/event", func(writer http.ResponseWriter, request *http.Request) {
+		require.Equal(t, "Splunk token", request.Header.Get("Authorization"))
+
+		decoder := json.NewDecoder(request.Body)
+
+		var events []splunk.Event
+
+		for {
+			var event splunk.Event
+
+			if err := decoder.Decode(&event); err != nil {
+				require.True(t, errors.Is(err, io.EOF))
+
+				break
+			}
+
+			events = append(events, event)
+		}
+
+		// Each request's acknowledgment ID is its sequence number
+		fakeHEC.mtx.Lock()
+		fakeHEC.requests = append(fakeHEC.requests, events)
+		fakeHEC.channels = append(fakeHEC.channels, request.Header.Get("X-Splunk-Request-Channel"))
+		ackID := len(fakeHEC.requests)
+		fakeHEC.mtx.Unlock()
+
+		require.NoError(t, json.NewEncoder(writer).Encode(map[string]any{
+			"text":  "Success",
+			"code":  0,
+			"ackId": ackID,
+		}))
+	})
+	mux.HandleFunc("POST /services/collector/ack", func(writer http.ResponseWriter, request *http.Request) {
+		require.Equal(t, "Splunk token", request.Header.Get("Authorization"))
+		require.NotEmpty(t, request.Header.Get("X-Splunk-Request-Channel"))
+
+		var ackRequest struct {
+			Acks []int64 `json:"acks"`
+		}
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&ackRequest))
+
+		// Requests are only acknowledged on the second poll
+		acks := map[string]bool{}
+
+		fakeHEC.mtx.Lock()
+		for _, ackID := range ackRequest.Acks {
+			fakeHEC.ackPolls[ackID]++
+			acks[strconv.FormatInt(ackID, 10)] = fakeHEC.ackPolls[ackID] > 1 && !fakeHEC.neverAcked[ackID]
+		}
+		fakeHEC.mtx.Unlock()
+
+		require.NoError(t, json.NewEncoder(writer).Encode(map[string]any{
+			"acks": acks,
+		}))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	fakeHEC.URL = server.URL
+
+	return fakeHEC
+}
+
+func TestSend(t *testing.T) {
+	fakeHEC := newFakeHEC(t)
+
+	processor, err := splunk.NewProcessor(fakeHEC.URL, "token", 100, 10*time.Millisecond,
+		splunk.WithIndex("cirrus"), splunk.WithSource("cws"), splunk.WithHost("ci"))
+	require.NoError(t, err)
+	defer processor.Close()
+
+	body := testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "audit_event", "audit_event.json")
+
+	// Build and task events are not sent by default
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "build", "build.json")
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "task", "task.json")
+
+	require.Len(t, fakeHEC.requests, 1)
+	require.Len(t, fakeHEC.requests[0], 1)
+	require.Empty(t, fakeHEC.channels[0])
+
+	event := fakeHEC.requests[0][0]
+	// Audit event's own timestamp is preferred over the "X-Cirrus-Timestamp" header
+	require.Equal(t, json.Number("1722518406.287"), event.Time)
+	require.Equal(t, "ci", event.Host)
+	require.Equal(t, "cws", event.Source)
+	require.Equal(t, "cirrus:audit_event", event.Sourcetype)
+	require.Equal(t, "cirrus", event.Index)
+	require.JSONEq(t, string(body), string(event.Event))
+	require.Equal(t, map[string]string{"event_type": "audit_event"}, event.Fields)
+}
+
+func TestBatch(t *testing.T) {
+	fakeHEC := newFakeHEC(t)
+
+	// The flush interval is long enough for the events to be only sent once there's 3 of them
+	processor, err := splunk.NewProcessor(fakeHEC.URL, "token", 3, time.Hour,
+		splunk.WithBuildsAndTasks())
+	require.NoError(t, err)
+	defer processor.Close()
+
+	var wg sync.WaitGroup
+
+	for eventType, name := range map[string]string{
+		"audit_event": "audit_event.json",
+		"build":       "build.json",
+		"task":        "task.json",
+	} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, eventType, name)
+		}()
+	}
+
+	wg.Wait()
+
+	require.Len(t, fakeHEC.requests, 1)
+
+	var sourcetypes []string
+
+	for _, event := range fakeHEC.requests[0] {
+		sourcetypes = append(sourcetypes, event.Sourcetype)
+	}
+
+	require.ElementsMatch(t, []string{"cirrus:audit_event", "cirrus:build", "cirrus:task"}, sourcetypes)
+}
+
+func TestAck(t *testing.T) {
+	fakeHEC := newFakeHEC(t)
+
+	processor, err := splunk.NewProcessor(fakeHEC.URL, "token", 100, 10*time.Millisecond,
+		splunk.WithAck(10*time.Millisecond, time.Minute))
+	require.NoError(t, err)
+	defer processor.Close()
+
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "audit_event", "audit_event.json")
+
+	// The webhook event is only acknowledged once the fake HEC
+	// acknowledges the request on the second poll
+	require.Len(t, fakeHEC.requests, 1)
+	require.NotEmpty(t, fakeHEC.channels[0])
+	require.Equal(t, map[int64]int{1: 2}, fakeHEC.ackPolls)
+}
+
+func TestAckDoesNotBlockOtherRequests(t *testing.T) {
+	fakeHEC := newFakeHEC(t)
+	fakeHEC.neverAcked[1] = true
+
+	processor, err := splunk.NewProcessor(fakeHEC.URL, "token", 100, 10*time.Millisecond,
+		splunk.WithAck(10*time.Millisecond, time.Second))
+	require.NoError(t, err)
+	defer processor.Close()
+
+	body := testutil.Testdata(t, "audit_event.json")
+
+	firstErr := make(chan error, 1)
+
+	go func() {
+		firstErr <- testutil.Deliver(processor.ProcessWebhookEvent, "audit_event", body)
+	}()
+
+	require.Eventually(t, func() bool {
+		fakeHEC.mtx.Lock()
+		defer fakeHEC.mtx.Unlock()
+
+		return len(fakeHEC.requests) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The second webhook event is sent and acknowledged while
+	// the first one is still waiting for its acknowledgment
+	testutil.MustDeliver(t, processor.ProcessWebhookEvent, "audit_event", body)
+
+	select {
+	case err := <-firstErr:
+		require.FailNow(t, "first webhook event has finished too early", err)
+	default:
+	}
+
+	require.ErrorIs(t, <-firstErr, splunk.ErrSplunkFailed)
+	require.Len(t, fakeHEC.requests, 2)
+}
@@ -0,0 +1,91 @@
+package sql
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/sqlstore"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var dsn string
+var migrate bool
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sql",
+		Short: "Store Cirrus CI webhook events in an SQLite or PostgreSQL database",
+		RunE:  run,
+	}
+
+	server.AppendFlags(cmd)
+
+	cmd.PersistentFlags().StringVar(&dsn, "dsn", "",
+		"PostgreSQL URL (postgres://...) or a path to the SQLite database file to store "+
+			"the webhook events in (defaults to the DATABASE_URL environment variable, "+
+			"or cirrus-webhooks.db if it's not set)")
+	cmd.PersistentFlags().BoolVar(&migrate, "migrate", true,
+		"apply the pending schema migrations on startup")
+
+	return cmd
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	dsn = server.SecretFromEnv(dsn, "DATABASE_URL")
+
+	if dsn == "" {
+		dsn = "cirrus-webhooks.db"
+	}
+
+	store, err := sqlstore.Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	if migrate {
+		numApplied, err := store.Migrate(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		zap.S().Infof("applied %d schema migrations", numApplied)
+	}
+
+	processor := NewProcessor(store)
+
+	return server.New(processor.ProcessWebhookEvent, zap.S()).Run(cmd.Context())
+}
+
+type Processor struct {
+	store *sqlstore.Store
+}
+
+func NewProcessor(store *sqlstore.Store) *Processor {
+	return &Processor{
+		store: store,
+	}
+}
+
+func (processor *Processor) ProcessWebhookEvent(
+	ctx echo.Context,
+	presentedEventType string,
+	body []byte,
+	logger *zap.SugaredLogger,
+) error {
+	switch presentedEventType {
+	case "build", "task", "audit_event":
+		// supported
+	default:
+		logger.Debugf("skipping event %q because it's not supported", presentedEventType)
+
+		return nil
+	}
+
+	// The error is already wrapped with sqlstore.ErrStoreFailed
+	return processor.store.Save(ctx.Request().Context(), presentedEventType, body,
+		cirrus.EventTime(ctx.Request().Header, logger))
+}
@@ -0,0 +1,32 @@
+package sql_test
+
+import (
+	"context"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/command/sql"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/sqlstore"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/testutil"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessWebhookEvent(t *testing.T) {
+	store, err := sqlstore.Open(filepath.Join(t.TempDir(), "cirrus.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = store.Migrate(context.Background())
+	require.NoError(t, err)
+
+	processor := sql.NewProcessor(store)
+
+	testutil.DeliverTestdata(t, processor.ProcessWebhookEvent, "task", "task.json")
+
+	var status string
+	var updatedTimestamp int64
+
+	require.NoError(t, store.DB().QueryRow("SELECT status, updated_timestamp FROM tasks WHERE id = $1",
+		6017965227769856).Scan(&status, &updatedTimestamp))
+	require.Equal(t, "EXECUTING", status)
+	require.EqualValues(t, 1722408869403, updatedTimestamp)
+}
@@ -16,50 +16,56 @@ type APISender struct {
 	apiClient *datadog.APIClient
 	logsAPI   *datadogV2.LogsApi
 
-	apiKey  string
-	apiSite string
+	apiKey      string
+	apiSite     string
+	serviceTags ServiceTags
 }
 
-func NewAPISender(apiKey string, apiSite string) (*APISender, error) {
+func NewAPISender(apiKey string, apiSite string, serviceTags ServiceTags) (*APISender, error) {
 	apiClient := datadog.NewAPIClient(datadog.NewConfiguration())
 
 	return &APISender{
 		apiClient: apiClient,
 		logsAPI:   datadogV2.NewLogsApi(apiClient),
 
-		apiKey:  apiKey,
-		apiSite: apiSite,
+		apiKey:      apiKey,
+		apiSite:     apiSite,
+		serviceTags: serviceTags,
 	}, nil
 }
 
 func (sender *APISender) SendEvent(ctx context.Context, event *Event) error {
-	ctx = context.WithValue(
-		ctx,
-		datadog.ContextAPIKeys,
-		map[string]datadog.APIKey{
-			"apiKeyAuth": {
-				Key: sender.apiKey,
-			},
-		},
-	)
+	ctx = sender.authenticatedContext(ctx)
 
-	ctx = context.WithValue(ctx,
-		datadog.ContextServerVariables,
-		map[string]string{
-			"site": sender.apiSite,
-		})
+	tags := append(append([]string{}, event.Tags...), sender.serviceTags.GlobalTags()...)
 
 	logItem := datadogV2.HTTPLogItem{
 		Ddsource: datadog.PtrString("Cirrus Webhooks Server"),
-		Ddtags:   datadog.PtrString(strings.Join(event.Tags, ",")),
+		Ddtags:   datadog.PtrString(strings.Join(tags, ",")),
 		Message:  event.Text,
 	}
 
+	if service := sender.serviceTags.Service; service != "" {
+		logItem.Service = datadog.PtrString(service)
+	}
+
+	if hostname := sender.serviceTags.Hostname; hostname != "" {
+		logItem.Hostname = datadog.PtrString(hostname)
+	}
+
+	logItem.AdditionalProperties = map[string]interface{}{}
+
+	for key, value := range event.Attributes {
+		logItem.AdditionalProperties[key] = value
+	}
+
 	if !event.Timestamp.IsZero() {
-		logItem.AdditionalProperties = map[string]string{
-			// https://docs.datadoghq.com/service_management/events/pipelines_and_processors/date_remapper/
-			"timestamp": event.Timestamp.Format(time.RFC3339),
-		}
+		// https://docs.datadoghq.com/service_management/events/pipelines_and_processors/date_remapper/
+		logItem.AdditionalProperties["timestamp"] = event.Timestamp.Format(time.RFC3339)
+	}
+
+	if !event.OriginalTimestamp.IsZero() {
+		logItem.AdditionalProperties["original_timestamp"] = event.OriginalTimestamp.Format(time.RFC3339)
 	}
 
 	_, _, err := sender.logsAPI.SubmitLog(ctx, []datadogV2.HTTPLogItem{logItem})
@@ -69,3 +75,23 @@ func (sender *APISender) SendEvent(ctx context.Context, event *Event) error {
 
 	return nil
 }
+
+func (sender *APISender) authenticatedContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(
+		ctx,
+		datadog.ContextAPIKeys,
+		map[string]datadog.APIKey{
+			"apiKeyAuth": {
+				Key: sender.apiKey,
+			},
+		},
+	)
+
+	ctx = context.WithValue(ctx,
+		datadog.ContextServerVariables,
+		map[string]string{
+			"site": sender.apiSite,
+		})
+
+	return ctx
+}
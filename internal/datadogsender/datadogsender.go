@@ -10,6 +10,14 @@ type Event struct {
 	Text      string
 	Timestamp time.Time
 	Tags      []string
+
+	// Attributes are structured attributes of the event, which
+	// can be arbitrarily nested. Only supported by the API sender.
+	Attributes map[string]interface{}
+
+	// OriginalTimestamp is set when the Timestamp was replaced,
+	// for example, because the event was too old for Datadog to accept it.
+	OriginalTimestamp time.Time
 }
 
 type Sender interface {
@@ -5,35 +5,83 @@ import (
 	"errors"
 	"fmt"
 	"github.com/DataDog/datadog-go/v5/statsd"
+	"os"
+	"slices"
+	"time"
 )
 
 var ErrDogstatsdSenderFailed = errors.New("DogStatsD sender failed to send the event")
 
 type DogstatsdSender struct {
-	client *statsd.Client
+	client   *statsd.Client
+	hostname string
 }
 
-func NewDogstatsdSender(addr string) (*DogstatsdSender, error) {
-	client, err := statsd.New(addr)
+// dogstatsdEnvTags maps the environment variables that the DogStatsD
+// client turns into the global tags on its own to these tags' keys.
+//
+//nolint:gochecknoglobals
+var dogstatsdEnvTags = map[string]string{
+	"DD_ENV":     "env",
+	"DD_SERVICE": "service",
+	"DD_VERSION": "version",
+}
+
+func NewDogstatsdSender(addr string, serviceTags ServiceTags) (*DogstatsdSender, error) {
+	client, err := statsd.New(addr, statsd.WithTags(withoutEnvTags(serviceTags.GlobalTags())))
 	if err != nil {
 		return nil, fmt.Errorf("%w: failed to initialize DogStatsD client: %v",
 			ErrDogstatsdSenderFailed, err)
 	}
 
 	return &DogstatsdSender{
-		client: client,
+		client:   client,
+		hostname: serviceTags.Hostname,
 	}, nil
 }
 
 func (sender *DogstatsdSender) SendEvent(ctx context.Context, event *Event) error {
+	tags := event.Tags
+
+	// DogStatsD events don't support attributes, so use a tag instead
+	if !event.OriginalTimestamp.IsZero() {
+		tags = append(slices.Clip(tags), fmt.Sprintf("original_timestamp:%s",
+			event.OriginalTimestamp.Format(time.RFC3339)))
+	}
+
 	if err := sender.client.Event(&statsd.Event{
 		Title:     event.Title,
 		Text:      event.Text,
 		Timestamp: event.Timestamp,
-		Tags:      event.Tags,
+		Tags:      tags,
+		Hostname:  sender.hostname,
 	}); err != nil {
 		return fmt.Errorf("%w: %v", ErrDogstatsdSenderFailed, err)
 	}
 
 	return nil
 }
+
+// withoutEnvTags omits the tags that the DogStatsD client picks up from the
+// DD_ENV, DD_SERVICE and DD_VERSION environment variables on its own, which
+// would be otherwise sent twice, since the service tags default to the same
+// environment variables.
+func withoutEnvTags(tags []string) []string {
+	envTags := map[string]struct{}{}
+
+	for envName, tagKey := range dogstatsdEnvTags {
+		if value := os.Getenv(envName); value != "" {
+			envTags[fmt.Sprintf("%s:%s", tagKey, value)] = struct{}{}
+		}
+	}
+
+	var result []string
+
+	for _, tag := range tags {
+		if _, ok := envTags[tag]; !ok {
+			result = append(result, tag)
+		}
+	}
+
+	return result
+}
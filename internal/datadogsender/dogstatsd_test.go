@@ -0,0 +1,75 @@
+package datadogsender_test
+
+import (
+	"context"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
+	"github.com/stretchr/testify/require"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDogstatsdServiceTagsAreNotDuplicated(t *testing.T) {
+	t.Setenv("DD_ENV", "prod")
+	t.Setenv("DD_SERVICE", "cws")
+	t.Setenv("DD_VERSION", "")
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sender, err := datadogsender.NewDogstatsdSender(conn.LocalAddr().String(), datadogsender.ServiceTags{
+		Service: "cws",
+		Env:     "prod",
+		Version: "1.0.0",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, sender.SendEvent(context.Background(), &datadogsender.Event{
+		Title: "Webhook event",
+		Text:  "Build created",
+	}))
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	buf := make([]byte, 65536)
+
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	datagram := string(buf[:n])
+	require.Equal(t, 1, strings.Count(datagram, "env:prod"))
+	require.Equal(t, 1, strings.Count(datagram, "service:cws"))
+	require.Equal(t, 1, strings.Count(datagram, "version:1.0.0"))
+}
+
+func TestDogstatsdOriginalTimestamp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sender, err := datadogsender.NewDogstatsdSender(conn.LocalAddr().String(), datadogsender.ServiceTags{})
+	require.NoError(t, err)
+
+	tags := []string{"action:created"}
+
+	require.NoError(t, sender.SendEvent(context.Background(), &datadogsender.Event{
+		Title:             "Webhook event",
+		Text:              "Build created",
+		Timestamp:         time.Date(2024, 8, 2, 0, 0, 0, 0, time.UTC),
+		Tags:              tags,
+		OriginalTimestamp: time.Date(2024, 7, 31, 6, 54, 29, 0, time.UTC),
+	}))
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	buf := make([]byte, 65536)
+
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	datagram := string(buf[:n])
+	require.Contains(t, datagram, "#action:created,original_timestamp:2024-07-31T06:54:29Z")
+	require.Equal(t, []string{"action:created"}, tags)
+}
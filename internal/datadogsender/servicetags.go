@@ -0,0 +1,43 @@
+package datadogsender
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ServiceTags holds the Datadog's unified service tagging[1] values and
+// the hostname that are attached to every event submitted by a sender.
+//
+// [1]: https://docs.datadoghq.com/getting_started/tagging/unified_service_tagging/
+type ServiceTags struct {
+	Service  string
+	Env      string
+	Version  string
+	Hostname string
+	Tags     []string
+}
+
+// ParseTags parses the tags in the DD_TAGS format,
+// where tags are separated by commas and/or spaces.
+func ParseTags(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// GlobalTags returns the tags that should be attached to every event.
+func (serviceTags ServiceTags) GlobalTags() []string {
+	var result []string
+
+	if serviceTags.Env != "" {
+		result = append(result, fmt.Sprintf("env:%s", serviceTags.Env))
+	}
+	if serviceTags.Service != "" {
+		result = append(result, fmt.Sprintf("service:%s", serviceTags.Service))
+	}
+	if serviceTags.Version != "" {
+		result = append(result, fmt.Sprintf("version:%s", serviceTags.Version))
+	}
+
+	return append(result, serviceTags.Tags...)
+}
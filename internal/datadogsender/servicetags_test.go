@@ -0,0 +1,22 @@
+package datadogsender_test
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/datadogsender"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	require.Equal(t, []string{"team:ci", "region:eu", "tier:1"},
+		datadogsender.ParseTags("team:ci,region:eu tier:1"))
+	require.Empty(t, datadogsender.ParseTags(""))
+}
+
+func TestGlobalTags(t *testing.T) {
+	require.Equal(t, []string{"env:prod", "service:cws", "version:1.2.3", "team:ci"}, datadogsender.ServiceTags{
+		Service: "cws",
+		Env:     "prod",
+		Version: "1.2.3",
+		Tags:    []string{"team:ci"},
+	}.GlobalTags())
+}
@@ -0,0 +1,234 @@
+// Package filesink appends the webhook events to a local JSONL file
+// in the archive format, rotating the file by size and/or daily.
+package filesink
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/archive"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrFileSinkFailed = errors.New("failed to write Cirrus CI event to the file")
+
+type Writer struct {
+	path        string
+	maxSize     int64
+	rotateDaily bool
+	compress    bool
+	logger      *zap.SugaredLogger
+
+	file      *os.File
+	size      int64
+	startedAt time.Time
+	closed    bool
+
+	compressions sync.WaitGroup
+	mtx          sync.Mutex
+}
+
+// New opens the file for appending, creating it if necessary.
+//
+// The file is rotated once writing the next record would make
+// it larger than maxSize (unless it's zero) and, if rotateDaily
+// is set, once the next record was received on another day (UTC).
+// The rotated files are optionally compressed in the background.
+func New(path string, maxSize int64, rotateDaily bool, compress bool, logger *zap.SugaredLogger) (*Writer, error) {
+	writer := &Writer{
+		path:        path,
+		maxSize:     maxSize,
+		rotateDaily: rotateDaily,
+		compress:    compress,
+		logger:      logger,
+	}
+
+	if err := writer.open(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFileSinkFailed, err)
+	}
+
+	return writer, nil
+}
+
+func (writer *Writer) open() error {
+	file, err := os.OpenFile(writer.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	writer.file = file
+	writer.size = info.Size()
+	writer.startedAt = time.Time{}
+
+	// Continue appending to the existing file as if it was started
+	// when it was last modified, since we don't know any better
+	if writer.size != 0 {
+		writer.startedAt = info.ModTime()
+	}
+
+	return nil
+}
+
+func (writer *Writer) Write(record *archive.Record) error {
+	line, err := record.MarshalLine()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFileSinkFailed, err)
+	}
+
+	writer.mtx.Lock()
+	defer writer.mtx.Unlock()
+
+	if writer.closed {
+		return fmt.Errorf("%w: file is closed", ErrFileSinkFailed)
+	}
+
+	// Re-open the file if the previous rotation failed half-way
+	if writer.file == nil {
+		if err := writer.open(); err != nil {
+			return fmt.Errorf("%w: %v", ErrFileSinkFailed, err)
+		}
+	}
+
+	if writer.shouldRotate(record.ReceivedAt, int64(len(line))) {
+		if err := writer.rotate(); err != nil {
+			return fmt.Errorf("%w: failed to rotate: %v", ErrFileSinkFailed, err)
+		}
+	}
+
+	n, err := writer.file.Write(line)
+	writer.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFileSinkFailed, err)
+	}
+
+	if writer.startedAt.IsZero() {
+		writer.startedAt = record.ReceivedAt
+	}
+
+	return nil
+}
+
+func (writer *Writer) shouldRotate(receivedAt time.Time, lineSize int64) bool {
+	// Never rotate an empty file, even if a single record exceeds the maximum size
+	if writer.size == 0 {
+		return false
+	}
+
+	if writer.maxSize != 0 && writer.size+lineSize > writer.maxSize {
+		return true
+	}
+
+	return writer.rotateDaily &&
+		writer.startedAt.UTC().Format(time.DateOnly) != receivedAt.UTC().Format(time.DateOnly)
+}
+
+// rotate renames the current file to "<name>-<time it was started at><extension>"
+// and opens a new file in its place.
+func (writer *Writer) rotate() error {
+	if err := writer.file.Close(); err != nil {
+		return err
+	}
+
+	writer.file = nil
+
+	extension := filepath.Ext(writer.path)
+	base := strings.TrimSuffix(writer.path, extension) + "-" +
+		writer.startedAt.UTC().Format("20060102T150405.000Z")
+
+	// Don't overwrite the previously rotated file if two files were started in a millisecond
+	rotatedPath := base + extension
+
+	for i := 1; fileExists(rotatedPath) || fileExists(rotatedPath+".gz"); i++ {
+		rotatedPath = fmt.Sprintf("%s-%d%s", base, i, extension)
+	}
+
+	if err := os.Rename(writer.path, rotatedPath); err != nil {
+		return err
+	}
+
+	if writer.compress {
+		writer.compressions.Add(1)
+
+		go func() {
+			defer writer.compressions.Done()
+
+			if err := compressFile(rotatedPath); err != nil {
+				writer.logger.Warnf("failed to compress rotated file %s: %v", rotatedPath, err)
+			}
+		}()
+	}
+
+	return writer.open()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+
+	return err == nil
+}
+
+// compressFile compresses the file into "<path>.gz" and removes it.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	gzipWriter := gzip.NewWriter(dst)
+
+	if _, err := io.Copy(gzipWriter, src); err != nil {
+		_ = dst.Close()
+
+		return err
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		_ = dst.Close()
+
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// Close closes the file and waits for the rotated files to be compressed.
+func (writer *Writer) Close() error {
+	writer.mtx.Lock()
+	defer writer.mtx.Unlock()
+
+	writer.closed = true
+
+	var err error
+
+	if writer.file != nil {
+		err = writer.file.Close()
+		writer.file = nil
+	}
+
+	writer.compressions.Wait()
+
+	return err
+}
@@ -0,0 +1,141 @@
+package filesink_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/archive"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/filesink"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newRecord(body string, receivedAt time.Time) *archive.Record {
+	header := http.Header{}
+	header.Set("X-Cirrus-Event", "build")
+
+	return archive.NewRecord(header, "build", []byte(body), receivedAt)
+}
+
+func readRecords(t *testing.T, path string) []archive.Record {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var reader io.Reader = file
+
+	if filepath.Ext(path) == ".gz" {
+		gzipReader, err := gzip.NewReader(file)
+		require.NoError(t, err)
+
+		reader = gzipReader
+	}
+
+	var records []archive.Record
+
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		var record archive.Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+
+		records = append(records, record)
+	}
+
+	require.NoError(t, scanner.Err())
+
+	return records
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var names []string
+
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+
+	receivedAt := time.Date(2024, 7, 31, 6, 54, 29, 403_000_000, time.UTC)
+
+	line, err := newRecord(`{"n":1}`, receivedAt).MarshalLine()
+	require.NoError(t, err)
+
+	// Fit two records per file
+	writer, err := filesink.New(path, int64(2*len(line)), false, true, zap.S())
+	require.NoError(t, err)
+
+	for _, body := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`, `{"n":4}`, `{"n":5}`} {
+		require.NoError(t, writer.Write(newRecord(body, receivedAt)))
+	}
+
+	require.NoError(t, writer.Close())
+
+	require.Equal(t, []string{
+		"events-20240731T065429.403Z-1.jsonl.gz",
+		"events-20240731T065429.403Z.jsonl.gz",
+		"events.jsonl",
+	}, listFiles(t, dir))
+
+	rotatedRecords := readRecords(t, filepath.Join(dir, "events-20240731T065429.403Z.jsonl.gz"))
+	require.Len(t, rotatedRecords, 2)
+	require.Equal(t, `{"n":1}`, rotatedRecords[0].Body)
+	require.Equal(t, `{"n":2}`, rotatedRecords[1].Body)
+
+	rotatedRecords = readRecords(t, filepath.Join(dir, "events-20240731T065429.403Z-1.jsonl.gz"))
+	require.Len(t, rotatedRecords, 2)
+	require.Equal(t, `{"n":3}`, rotatedRecords[0].Body)
+
+	records := readRecords(t, path)
+	require.Len(t, records, 1)
+	require.Equal(t, `{"n":5}`, records[0].Body)
+	require.Equal(t, "build", records[0].Headers.Get("X-Cirrus-Event"))
+	require.True(t, receivedAt.Equal(records[0].ReceivedAt))
+
+	// Appending to an existing file continues where we left off
+	writer, err = filesink.New(path, int64(2*len(line)), false, false, zap.S())
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(newRecord(`{"n":6}`, receivedAt)))
+	require.NoError(t, writer.Close())
+
+	require.Len(t, readRecords(t, path), 2)
+}
+
+func TestRotateDaily(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+
+	firstDay := time.Date(2024, 7, 31, 23, 59, 0, 0, time.UTC)
+	secondDay := time.Date(2024, 8, 1, 0, 1, 0, 0, time.UTC)
+
+	writer, err := filesink.New(path, 0, true, false, zap.S())
+	require.NoError(t, err)
+
+	require.NoError(t, writer.Write(newRecord(`{"n":1}`, firstDay)))
+	require.NoError(t, writer.Write(newRecord(`{"n":2}`, firstDay)))
+	require.NoError(t, writer.Write(newRecord(`{"n":3}`, secondDay)))
+	require.NoError(t, writer.Close())
+
+	require.Equal(t, []string{"events-20240731T235900.000Z.jsonl", "events.jsonl"}, listFiles(t, dir))
+	require.Len(t, readRecords(t, filepath.Join(dir, "events-20240731T235900.000Z.jsonl")), 2)
+	require.Len(t, readRecords(t, path), 1)
+
+	require.ErrorIs(t, writer.Write(newRecord(`{"n":4}`, secondDay)), filesink.ErrFileSinkFailed)
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+)
+
+// hiddenVars are the variables published by the expvar package itself
+// that shouldn't be exposed, since the command-line arguments might
+// contain secrets like the API keys and passwords.
+var hiddenVars = map[string]struct{}{
+	"cmdline": {},
+}
+
+// expvarHandler is similar to expvar.Handler(), but omits the hiddenVars.
+func expvarHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		fmt.Fprintf(writer, "{\n")
+
+		first := true
+
+		expvar.Do(func(kv expvar.KeyValue) {
+			if _, ok := hiddenVars[kv.Key]; ok {
+				return
+			}
+
+			if !first {
+				fmt.Fprintf(writer, ",\n")
+			}
+
+			first = false
+
+			fmt.Fprintf(writer, "%q: %s", kv.Key, kv.Value)
+		})
+
+		fmt.Fprintf(writer, "\n}\n")
+	})
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpvarHandlerHidesCommandLine(t *testing.T) {
+	expvar.NewInt("server_test_counter").Add(42)
+
+	recorder := httptest.NewRecorder()
+	expvarHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var vars map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &vars))
+
+	require.NotContains(t, vars, "cmdline")
+	require.Contains(t, vars, "memstats")
+	require.JSONEq(t, "42", string(vars["server_test_counter"]))
+}
@@ -1,11 +1,19 @@
 package server
 
-import "github.com/spf13/cobra"
+import (
+	"github.com/spf13/cobra"
+	"os"
+)
 
 var httpAddr string
 var httpPath string
 var eventTypes []string
 var secretToken string
+var metricsAddr string
+var filePath string
+var fileMaxSize int64
+var fileRotateDaily bool
+var fileGzip bool
 
 func AppendFlags(cmd *cobra.Command, specificEventTypes ...string) {
 	cmd.Flags().StringVar(&httpAddr, "http-addr", ":8080",
@@ -14,6 +22,19 @@ func AppendFlags(cmd *cobra.Command, specificEventTypes ...string) {
 		"HTTP path on which the webhook events will be expected")
 	cmd.Flags().StringVar(&secretToken, "secret-token", "",
 		"if specified, this value will be used as a HMAC SHA-256 secret to verify the webhook events")
+	cmd.Flags().StringVar(&metricsAddr, "metrics-addr", "127.0.0.1:8081",
+		"address on which the server's own counters will be exposed at /debug/vars "+
+			"(specify an empty value to disable)")
+	cmd.Flags().StringVar(&filePath, "file", "",
+		"if specified, additionally append each verified webhook event (its HTTP headers, body "+
+			"and the time it was received) as a JSON line to this file before processing it, "+
+			"regardless of the --event-types")
+	cmd.Flags().Int64Var(&fileMaxSize, "file-max-size", 0,
+		"rotate the --file once it would exceed this size in bytes (0 disables the size-based rotation)")
+	cmd.Flags().BoolVar(&fileRotateDaily, "file-rotate-daily", false,
+		"rotate the --file once a webhook event is received on another day (UTC)")
+	cmd.Flags().BoolVar(&fileGzip, "file-gzip", false,
+		"compress the rotated --file files using gzip")
 
 	if len(specificEventTypes) != 0 {
 		eventTypes = specificEventTypes
@@ -23,3 +44,16 @@ func AppendFlags(cmd *cobra.Command, specificEventTypes ...string) {
 				"(for example, --event-types=audit_event or --event-types=build,task")
 	}
 }
+
+// SecretFromEnv returns the flag's value, falling back to the environment variable.
+//
+// The processors read their secrets, such as passwords and tokens, this way when
+// running instead of using the environment variables as the flags' default values,
+// which would expose the secrets in the "--help" output.
+func SecretFromEnv(flagValue string, envName string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+
+	return os.Getenv(envName)
+}
@@ -0,0 +1,14 @@
+package server
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSecretFromEnv(t *testing.T) {
+	t.Setenv("SERVER_TEST_SECRET", "from-env")
+
+	require.Equal(t, "from-flag", SecretFromEnv("from-flag", "SERVER_TEST_SECRET"))
+	require.Equal(t, "from-env", SecretFromEnv("", "SERVER_TEST_SECRET"))
+	require.Empty(t, SecretFromEnv("", "SERVER_TEST_SECRET_UNSET"))
+}
@@ -8,6 +8,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/brpaz/echozap"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/archive"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/filesink"
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
@@ -19,11 +21,20 @@ import (
 
 var ErrSignatureVerificationFailed = errors.New("event signature verification failed")
 
+// Callback processes a verified webhook event.
+//
+// The server only responds to Cirrus CI with a success once the callback returns
+// without an error, and Cirrus CI re-delivers the webhook event otherwise. Thus,
+// the callbacks delivering the webhook events elsewhere should only return once
+// the delivery is confirmed (for example, acknowledged by a broker or inserted
+// into a database), otherwise a failed delivery would lose the webhook event.
 type Callback func(ctx echo.Context, presentedEventType string, body []byte, logger *zap.SugaredLogger) error
 
 type Server struct {
 	eventTypesSet mapset.Set[string]
 	callback      Callback
+	handlers      map[string]http.Handler
+	fileSink      *filesink.Writer
 	logger        *zap.SugaredLogger
 }
 
@@ -31,11 +42,35 @@ func New(callback Callback, logger *zap.SugaredLogger) *Server {
 	return &Server{
 		eventTypesSet: mapset.NewSet[string](eventTypes...),
 		callback:      callback,
+		handlers:      map[string]http.Handler{},
 		logger:        logger,
 	}
 }
 
+// Handle registers an additional handler for the GET requests on the path,
+// for example, to expose the metrics collected by the processor.
+func (server *Server) Handle(path string, handler http.Handler) *Server {
+	server.handlers[path] = handler
+
+	return server
+}
+
 func (server *Server) Run(ctx context.Context) error {
+	// Record the webhook events to the file, if requested
+	if filePath != "" {
+		fileSink, err := filesink.New(filePath, fileMaxSize, fileRotateDaily, fileGzip, server.logger)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := fileSink.Close(); err != nil {
+				server.logger.Warnf("failed to close %s: %v", filePath, err)
+			}
+		}()
+
+		server.fileSink = fileSink
+	}
+
 	// Configure HTTP server
 	e := echo.New()
 
@@ -43,24 +78,53 @@ func (server *Server) Run(ctx context.Context) error {
 
 	e.POST(httpPath, server.handler)
 
+	for path, handler := range server.handlers {
+		e.GET(path, echo.WrapHandler(handler))
+	}
+
 	httpServer := &http.Server{
 		Addr:              httpAddr,
 		Handler:           e,
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	server.logger.Infof("starting HTTP server on %s", httpAddr)
+	httpServers := []*http.Server{httpServer}
+
+	// Expose the server's own counters on a separate listener,
+	// so that they're not reachable through the webhook's address
+	if metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /debug/vars", expvarHandler())
+
+		httpServers = append(httpServers, &http.Server{
+			Addr:              metricsAddr,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: 10 * time.Second,
+		})
+	}
+
+	httpServerErrCh := make(chan error, len(httpServers))
+
+	for _, httpServer := range httpServers {
+		server.logger.Infof("starting HTTP server on %s", httpServer.Addr)
 
-	httpServerErrCh := make(chan error, 1)
+		go func() {
+			httpServerErrCh <- httpServer.ListenAndServe()
+		}()
+	}
 
-	go func() {
-		httpServerErrCh <- httpServer.ListenAndServe()
+	defer func() {
+		for _, httpServer := range httpServers {
+			_ = httpServer.Close()
+		}
 	}()
 
 	select {
 	case <-ctx.Done():
-		if err := httpServer.Close(); err != nil {
-			return err
+		for _, httpServer := range httpServers {
+			if err := httpServer.Close(); err != nil {
+				return err
+			}
 		}
 
 		return ctx.Err()
@@ -70,16 +134,8 @@ func (server *Server) Run(ctx context.Context) error {
 }
 
 func (server *Server) handler(ctx echo.Context) error {
-	// Make sure that this is an event we've been looking for
 	presentedEventType := ctx.Request().Header.Get("X-Cirrus-Event")
 
-	if server.eventTypesSet.Cardinality() != 0 && !server.eventTypesSet.Contains(presentedEventType) {
-		server.logger.Debugf("skipping event of type %q because we only process events of types %s",
-			presentedEventType, strings.Join(server.eventTypesSet.ToSlice(), ", "))
-
-		return ctx.NoContent(http.StatusOK)
-	}
-
 	// Verify that this event comes from the Cirrus CI
 	body, err := io.ReadAll(ctx.Request().Body)
 	if err != nil {
@@ -94,6 +150,28 @@ func (server *Server) handler(ctx echo.Context) error {
 		return ctx.NoContent(http.StatusBadRequest)
 	}
 
+	// Record the webhook event before processing it, so that it's
+	// recorded even if the processing fails, and fail the delivery
+	// if it can't be recorded, so that Cirrus CI re-delivers it
+	if server.fileSink != nil {
+		record := archive.NewRecord(ctx.Request().Header, presentedEventType, body, time.Now())
+
+		if err := server.fileSink.Write(record); err != nil {
+			server.logger.Warnf("%v", err)
+
+			return ctx.NoContent(http.StatusInternalServerError)
+		}
+	}
+
+	// Make sure that this is an event we've been looking for, note that the file
+	// above is a side write that records all the events and not only these
+	if server.eventTypesSet.Cardinality() != 0 && !server.eventTypesSet.Contains(presentedEventType) {
+		server.logger.Debugf("skipping event of type %q because we only process events of types %s",
+			presentedEventType, strings.Join(server.eventTypesSet.ToSlice(), ", "))
+
+		return ctx.NoContent(http.StatusOK)
+	}
+
 	if err := server.callback(ctx, presentedEventType, body, server.logger); err != nil {
 		server.logger.Warnf("%v", err)
 
@@ -110,9 +188,7 @@ func verifyEvent(ctx echo.Context, body []byte) error {
 	}
 
 	// Calculate the expected signature
-	hmacSHA256 := hmac.New(sha256.New, []byte(secretToken))
-	hmacSHA256.Write(body)
-	expectedSignature := hmacSHA256.Sum(nil)
+	expectedSignature := signature(secretToken, body)
 
 	// Prepare the presented signature
 	presentedSignatureRaw := ctx.Request().Header.Get("X-Cirrus-Signature")
@@ -127,5 +203,18 @@ func verifyEvent(ctx echo.Context, body []byte) error {
 		return fmt.Errorf("%w: signature is not valid", ErrSignatureVerificationFailed)
 	}
 
-	return ctx.NoContent(http.StatusCreated)
+	return nil
+}
+
+// Sign calculates the hex-encoded HMAC SHA-256 signature of the body, the same way
+// Cirrus CI does for the "X-Cirrus-Signature" header, using the secret token.
+func Sign(secretToken string, body []byte) string {
+	return hex.EncodeToString(signature(secretToken, body))
+}
+
+func signature(secretToken string, body []byte) []byte {
+	hmacSHA256 := hmac.New(sha256.New, []byte(secretToken))
+	hmacSHA256.Write(body)
+
+	return hmacSHA256.Sum(nil)
 }
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/filesink"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileRecordsFilteredEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cirrus.jsonl")
+
+	fileSink, err := filesink.New(path, 0, false, false, zap.S())
+	require.NoError(t, err)
+
+	var processedEventTypes []string
+
+	server := &Server{
+		eventTypesSet: mapset.NewSet("build"),
+		callback: func(_ echo.Context, presentedEventType string, _ []byte, _ *zap.SugaredLogger) error {
+			processedEventTypes = append(processedEventTypes, presentedEventType)
+
+			return nil
+		},
+		fileSink: fileSink,
+		logger:   zap.S(),
+	}
+
+	for _, eventType := range []string{"build", "task"} {
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+		request.Header.Set("X-Cirrus-Event", eventType)
+
+		ctx := echo.New().NewContext(request, httptest.NewRecorder())
+		require.NoError(t, server.handler(ctx))
+	}
+
+	require.NoError(t, fileSink.Close())
+
+	// Only the build event is processed, but both events are recorded
+	require.Equal(t, []string{"build"}, processedEventTypes)
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[1], `"event_type":"task"`)
+}
@@ -0,0 +1,147 @@
+package sqlstore
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// Migrate applies the migrations that weren't applied yet,
+// each one in its own transaction, and returns their number.
+//
+// The applied migrations are tracked in the "schema_migrations" table.
+func (store *Store) Migrate(ctx context.Context) (int, error) {
+	migrations, err := loadMigrations(store.dialect)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to load migrations: %v", ErrStoreFailed, err)
+	}
+
+	if _, err := store.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    BIGINT PRIMARY KEY,
+    name       TEXT   NOT NULL,
+    applied_at BIGINT NOT NULL
+)`); err != nil {
+		return 0, fmt.Errorf("%w: failed to create the migrations table: %v", ErrStoreFailed, err)
+	}
+
+	applied, err := store.appliedMigrations(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to query applied migrations: %v", ErrStoreFailed, err)
+	}
+
+	var numApplied int
+
+	for _, migration := range migrations {
+		if _, ok := applied[migration.version]; ok {
+			continue
+		}
+
+		if err := store.applyMigration(ctx, migration); err != nil {
+			return numApplied, fmt.Errorf("%w: failed to apply migration %s: %v",
+				ErrStoreFailed, migration.name, err)
+		}
+
+		numApplied++
+	}
+
+	return numApplied, nil
+}
+
+func (store *Store) appliedMigrations(ctx context.Context) (map[int]struct{}, error) {
+	rows, err := store.db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]struct{}{}
+
+	for rows.Next() {
+		var version int
+
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+
+		applied[version] = struct{}{}
+	}
+
+	return applied, rows.Err()
+}
+
+func (store *Store) applyMigration(ctx context.Context, migration migration) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, migration.sql); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) "+
+		"VALUES ($1, $2, $3)", migration.version, migration.name, time.Now().UnixMilli()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadMigrations loads the dialect's migrations, which are named
+// "<version>_<description>.sql", ordered by their version.
+func loadMigrations(dialect Dialect) ([]migration, error) {
+	dir := path.Join("migrations", string(dialect))
+
+	entries, err := migrationsFS.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []migration
+
+	for _, entry := range entries {
+		rawVersion, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok || !strings.HasSuffix(entry.Name(), ".sql") {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected migration file name %q: %v", entry.Name(), err)
+		}
+
+		sql, err := migrationsFS.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, migration{
+			version: version,
+			name:    strings.TrimSuffix(entry.Name(), ".sql"),
+			sql:     string(sql),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].version < result[j].version
+	})
+
+	return result, nil
+}
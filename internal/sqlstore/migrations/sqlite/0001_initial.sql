@@ -0,0 +1,71 @@
+CREATE TABLE repositories (
+    id                BIGINT PRIMARY KEY,
+    owner             TEXT NOT NULL,
+    name              TEXT NOT NULL,
+    is_private        BOOLEAN,
+    updated_timestamp BIGINT NOT NULL
+);
+
+CREATE INDEX repositories_owner_name_idx ON repositories (owner, name);
+
+CREATE TABLE builds (
+    id                   BIGINT PRIMARY KEY,
+    repository_id        BIGINT NOT NULL REFERENCES repositories (id),
+    branch               TEXT,
+    pull_request         BIGINT,
+    change_id_in_repo    TEXT,
+    change_message_title TEXT,
+    change_timestamp     BIGINT,
+    user_username        TEXT,
+    status               TEXT,
+    duration_in_seconds  BIGINT,
+    updated_timestamp    BIGINT NOT NULL
+);
+
+CREATE INDEX builds_repository_id_branch_idx ON builds (repository_id, branch);
+
+CREATE TABLE tasks (
+    id                  BIGINT PRIMARY KEY,
+    build_id            BIGINT NOT NULL REFERENCES builds (id),
+    name                TEXT,
+    name_alias          TEXT,
+    instance_type       TEXT,
+    status              TEXT,
+    status_timestamp    BIGINT,
+    creation_timestamp  BIGINT,
+    duration_in_seconds BIGINT,
+    manual_rerun_count  BIGINT,
+    automatic_rerun     BOOLEAN,
+    updated_timestamp   BIGINT NOT NULL
+);
+
+CREATE INDEX tasks_build_id_idx ON tasks (build_id);
+
+CREATE TABLE status_transitions (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id   TEXT   NOT NULL UNIQUE,
+    build_id   BIGINT NOT NULL REFERENCES builds (id),
+    task_id    BIGINT REFERENCES tasks (id),
+    old_status TEXT,
+    new_status TEXT   NOT NULL,
+    timestamp  BIGINT NOT NULL
+);
+
+CREATE INDEX status_transitions_build_id_idx ON status_transitions (build_id);
+CREATE INDEX status_transitions_task_id_idx ON status_transitions (task_id);
+
+CREATE TABLE audit_events (
+    id                TEXT PRIMARY KEY,
+    type              TEXT,
+    action            TEXT,
+    actor_id          BIGINT,
+    actor_username    TEXT,
+    actor_location_ip TEXT,
+    repository_id     BIGINT,
+    build_id          BIGINT,
+    task_id           BIGINT,
+    data              TEXT,
+    timestamp         BIGINT NOT NULL
+);
+
+CREATE INDEX audit_events_timestamp_idx ON audit_events (timestamp);
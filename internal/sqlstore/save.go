@@ -0,0 +1,219 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/cirrus"
+	"time"
+)
+
+var ErrUnsupportedEventType = errors.New("unsupported event type")
+
+// Save upserts the repository, build and task described by the webhook event
+// and records their status transition or the audit event, in a single transaction.
+//
+// The rows are only updated by the events that are not older than the
+// event that last updated them, so that the events delivered out of order
+// don't revert the rows to a stale state. The task events are ordered by the
+// task's status timestamp, which stays the same across the re-deliveries,
+// while the build events carry no such timestamp and are ordered by the
+// eventTime, which is typically taken from the "X-Cirrus-Timestamp" header
+// and thus changes when the event is re-delivered.
+func (store *Store) Save(ctx context.Context, presentedEventType string, body []byte, eventTime time.Time) error {
+	var save func(ctx context.Context, tx *sql.Tx) error
+
+	switch presentedEventType {
+	case "build", "task":
+		var payload cirrus.BuildOrTask
+
+		if err := cirrus.Decode(body, &payload, cirrus.DecodingModeLenient); err != nil {
+			return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+		}
+
+		eventID, err := cirrus.EventID(presentedEventType, body)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+		}
+
+		save = func(ctx context.Context, tx *sql.Tx) error {
+			return saveBuildOrTask(ctx, tx, presentedEventType, eventID, &payload, eventTime)
+		}
+	case "audit_event":
+		var payload cirrus.AuditEvent
+
+		if err := cirrus.Decode(body, &payload, cirrus.DecodingModeLenient); err != nil {
+			return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+		}
+
+		save = func(ctx context.Context, tx *sql.Tx) error {
+			return saveAuditEvent(ctx, tx, &payload, eventTime)
+		}
+	default:
+		return fmt.Errorf("%w: %w %q", ErrStoreFailed, ErrUnsupportedEventType, presentedEventType)
+	}
+
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := save(ctx, tx); err != nil {
+		return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+
+	return nil
+}
+
+func saveBuildOrTask(
+	ctx context.Context,
+	tx *sql.Tx,
+	presentedEventType string,
+	eventID string,
+	payload *cirrus.BuildOrTask,
+	eventTime time.Time,
+) error {
+	repository := payload.Repository
+
+	if repository.ID == nil || repository.Owner == nil || repository.Name == nil {
+		return errors.New("webhook event has no repository ID, owner or name")
+	}
+
+	if payload.Build.ID == nil {
+		return errors.New("webhook event has no build ID")
+	}
+
+	if presentedEventType == "task" && payload.Task.ID == nil {
+		return errors.New("webhook event has no task ID")
+	}
+
+	// Prefer the task's status timestamp, since, unlike the
+	// eventTime, it stays the same across the re-deliveries
+	updatedTimestamp := eventTime.UnixMilli()
+
+	if presentedEventType == "task" && payload.Task.StatusTimestamp != nil {
+		updatedTimestamp = *payload.Task.StatusTimestamp
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO repositories (id, owner, name, is_private, updated_timestamp)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (id) DO UPDATE SET
+    owner = excluded.owner,
+    name = excluded.name,
+    is_private = excluded.is_private,
+    updated_timestamp = excluded.updated_timestamp
+WHERE repositories.updated_timestamp <= excluded.updated_timestamp`,
+		repository.ID, repository.Owner, repository.Name, repository.IsPrivate, updatedTimestamp,
+	); err != nil {
+		return fmt.Errorf("failed to upsert repository: %v", err)
+	}
+
+	// Task events contain the build too, so keep it up-to-date as well
+	build := payload.Build
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO builds (id, repository_id, branch, pull_request,
+    change_id_in_repo, change_message_title, change_timestamp, user_username, status,
+    duration_in_seconds, updated_timestamp)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (id) DO UPDATE SET
+    repository_id = excluded.repository_id,
+    branch = excluded.branch,
+    pull_request = excluded.pull_request,
+    change_id_in_repo = excluded.change_id_in_repo,
+    change_message_title = excluded.change_message_title,
+    change_timestamp = excluded.change_timestamp,
+    user_username = excluded.user_username,
+    status = excluded.status,
+    duration_in_seconds = excluded.duration_in_seconds,
+    updated_timestamp = excluded.updated_timestamp
+WHERE builds.updated_timestamp <= excluded.updated_timestamp`,
+		build.ID, repository.ID, build.Branch, build.PullRequest, build.ChangeIDInRepo,
+		build.ChangeMessageTitle, build.ChangeTimestamp, build.User.Username, build.Status,
+		build.DurationInSeconds, updatedTimestamp,
+	); err != nil {
+		return fmt.Errorf("failed to upsert build: %v", err)
+	}
+
+	status := build.Status
+	transitionTimestamp := updatedTimestamp
+
+	var taskID *int64
+
+	if presentedEventType == "task" {
+		task := payload.Task
+		taskID = task.ID
+		status = task.Status
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO tasks (id, build_id, name, name_alias, instance_type,
+    status, status_timestamp, creation_timestamp, duration_in_seconds, manual_rerun_count,
+    automatic_rerun, updated_timestamp)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+ON CONFLICT (id) DO UPDATE SET
+    build_id = excluded.build_id,
+    name = excluded.name,
+    name_alias = excluded.name_alias,
+    instance_type = excluded.instance_type,
+    status = excluded.status,
+    status_timestamp = excluded.status_timestamp,
+    creation_timestamp = excluded.creation_timestamp,
+    duration_in_seconds = excluded.duration_in_seconds,
+    manual_rerun_count = excluded.manual_rerun_count,
+    automatic_rerun = excluded.automatic_rerun,
+    updated_timestamp = excluded.updated_timestamp
+WHERE tasks.updated_timestamp <= excluded.updated_timestamp`,
+			task.ID, build.ID, task.Name, task.NameAlias, task.InstanceType, task.Status,
+			task.StatusTimestamp, task.CreationTimestamp, task.DurationInSeconds,
+			task.ManualRerunCount, task.AutomaticReRun, updatedTimestamp,
+		); err != nil {
+			return fmt.Errorf("failed to upsert task: %v", err)
+		}
+	}
+
+	if !payload.IsNewStatus(status) {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO status_transitions (event_id, build_id, task_id,
+    old_status, new_status, timestamp)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (event_id) DO NOTHING`,
+		eventID, build.ID, taskID, payload.OldStatus, status, transitionTimestamp,
+	); err != nil {
+		return fmt.Errorf("failed to insert status transition: %v", err)
+	}
+
+	return nil
+}
+
+func saveAuditEvent(ctx context.Context, tx *sql.Tx, payload *cirrus.AuditEvent, eventTime time.Time) error {
+	if payload.ID == nil {
+		return errors.New("audit event has no ID")
+	}
+
+	timestamp := eventTime.UnixMilli()
+
+	if payload.Timestamp != nil {
+		timestamp = *payload.Timestamp
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO audit_events (id, type, action, actor_id, actor_username,
+    actor_location_ip, repository_id, build_id, task_id, data, timestamp)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (id) DO NOTHING`,
+		payload.ID, payload.Type, payload.Action, payload.Actor.ID, payload.Actor.Username,
+		payload.ActorLocationIP, payload.Repository.ID, payload.Build.ID, payload.Task.ID,
+		payload.Data, timestamp,
+	); err != nil {
+		return fmt.Errorf("failed to insert audit event: %v", err)
+	}
+
+	return nil
+}
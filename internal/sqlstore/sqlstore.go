@@ -0,0 +1,87 @@
+// Package sqlstore persists the Cirrus CI webhook events in a relational
+// database (SQLite or PostgreSQL) using a normalized schema of repositories,
+// builds, tasks, their status transitions and audit events.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" driver
+	_ "modernc.org/sqlite"             // registers the "sqlite" driver
+	"net/url"
+	"strings"
+)
+
+var ErrStoreFailed = errors.New("failed to store Cirrus CI events in the database")
+
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// Open opens the database identified by the DSN, which is either
+// a PostgreSQL URL (postgres://...) or a path to the SQLite database
+// file, which is created when it doesn't exist.
+//
+// The schema is not migrated automatically, see Migrate.
+func Open(dsn string) (*Store, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		db, err := sql.Open("pgx", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrStoreFailed, err)
+		}
+
+		return &Store{db: db, dialect: DialectPostgres}, nil
+	}
+
+	db, err := sql.Open("sqlite", sqliteDSN(dsn))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+
+	// SQLite only supports a single writer at a time, so serialize
+	// the writes on our side instead of failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	return &Store{db: db, dialect: DialectSQLite}, nil
+}
+
+func sqliteDSN(path string) string {
+	pragmas := url.Values{}
+	pragmas.Add("_pragma", "foreign_keys(1)")
+	pragmas.Add("_pragma", "journal_mode(WAL)")
+	pragmas.Add("_pragma", "busy_timeout(5000)")
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	return path + separator + pragmas.Encode()
+}
+
+// DB returns the underlying database, for querying the stored events.
+func (store *Store) DB() *sql.DB {
+	return store.db
+}
+
+func (store *Store) Dialect() Dialect {
+	return store.dialect
+}
+
+func (store *Store) Ping(ctx context.Context) error {
+	return store.db.PingContext(ctx)
+}
+
+func (store *Store) Close() error {
+	return store.db.Close()
+}
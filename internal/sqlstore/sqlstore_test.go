@@ -0,0 +1,183 @@
+package sqlstore_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/sqlstore"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLite(t *testing.T) {
+	store, err := sqlstore.Open(filepath.Join(t.TempDir(), "cirrus.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, store.Close())
+	})
+
+	testStore(t, store)
+}
+
+// TestPostgres runs against the PostgreSQL database specified in
+// the CWS_TEST_POSTGRES_DSN environment variable, using a new schema.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("CWS_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("CWS_TEST_POSTGRES_DSN is not set")
+	}
+
+	adminStore, err := sqlstore.Open(dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, adminStore.Close())
+	})
+
+	schema := fmt.Sprintf("cws_test_%d", time.Now().UnixNano())
+
+	_, err = adminStore.DB().Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := adminStore.DB().Exec("DROP SCHEMA " + schema + " CASCADE")
+		require.NoError(t, err)
+	})
+
+	dsnURL, err := url.Parse(dsn)
+	require.NoError(t, err)
+
+	query := dsnURL.Query()
+	query.Set("search_path", schema)
+	dsnURL.RawQuery = query.Encode()
+
+	store, err := sqlstore.Open(dsnURL.String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, store.Close())
+	})
+
+	require.Equal(t, sqlstore.DialectPostgres, store.Dialect())
+
+	testStore(t, store)
+}
+
+func testStore(t *testing.T, store *sqlstore.Store) {
+	ctx := context.Background()
+
+	numApplied, err := store.Migrate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, numApplied)
+
+	// Migrations are only applied once
+	numApplied, err = store.Migrate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, numApplied)
+
+	build := readTestdata(t, "build.json")
+	task := readTestdata(t, "task.json")
+	auditEvent := readTestdata(t, "audit_event.json")
+
+	require.NoError(t, store.Save(ctx, "build", build, time.UnixMilli(1722408860000)))
+	require.NoError(t, store.Save(ctx, "task", task, time.UnixMilli(1722408869403)))
+	require.NoError(t, store.Save(ctx, "audit_event", auditEvent, time.UnixMilli(1722518406287)))
+
+	// Re-deliveries have no effect
+	require.NoError(t, store.Save(ctx, "task", task, time.UnixMilli(1722408869403)))
+	require.NoError(t, store.Save(ctx, "audit_event", auditEvent, time.UnixMilli(1722518406287)))
+
+	// Stale events don't revert the rows
+	staleBuild := strings.Replace(string(build), `"status": "EXECUTING"`, `"status": "CREATED"`, 1)
+	require.NoError(t, store.Save(ctx, "build", []byte(staleBuild), time.UnixMilli(1722408850000)))
+
+	// Stale task events re-delivered later don't revert the rows either,
+	// since the tasks are ordered by their status timestamp
+	staleTask := strings.NewReplacer(
+		`"action": "created"`, `"action": "updated", "old_status": "CREATED"`,
+		`"status": "EXECUTING",
+    "statusTimestamp": 1722408869403`, `"status": "CREATED",
+    "statusTimestamp": 1722408865412`,
+	).Replace(string(task))
+	require.NotEqual(t, string(task), staleTask)
+	require.NoError(t, store.Save(ctx, "task", []byte(staleTask), time.UnixMilli(1722408900000)))
+
+	require.ErrorIs(t, store.Save(ctx, "unknown", []byte("{}"), time.Now()), sqlstore.ErrUnsupportedEventType)
+
+	var owner, name string
+
+	require.NoError(t, store.DB().QueryRow("SELECT owner, name FROM repositories WHERE id = $1",
+		5129885287448576).Scan(&owner, &name))
+	require.Equal(t, "edigaryev", owner)
+	require.Equal(t, "awesome-system-calls", name)
+
+	var branch, buildStatus string
+
+	require.NoError(t, store.DB().QueryRow("SELECT branch, status FROM builds WHERE repository_id = $1",
+		5129885287448576).Scan(&branch, &buildStatus))
+	require.Equal(t, "main", branch)
+	require.Equal(t, "EXECUTING", buildStatus)
+
+	var taskName, instanceType, taskStatus string
+
+	require.NoError(t, store.DB().QueryRow("SELECT name, instance_type, status FROM tasks WHERE build_id = $1",
+		5082236150611968).Scan(&taskName, &instanceType, &taskStatus))
+	require.Equal(t, "Lint (cargo fmt)", taskName)
+	require.Equal(t, "CommunityContainer", instanceType)
+	require.Equal(t, "EXECUTING", taskStatus)
+
+	rows, err := store.DB().Query("SELECT task_id, old_status, new_status, timestamp " +
+		"FROM status_transitions ORDER BY timestamp")
+	require.NoError(t, err)
+
+	type transition struct {
+		TaskID    *int64
+		OldStatus *string
+		NewStatus string
+		Timestamp int64
+	}
+
+	var transitions []transition
+
+	for rows.Next() {
+		var transition transition
+
+		require.NoError(t, rows.Scan(&transition.TaskID, &transition.OldStatus,
+			&transition.NewStatus, &transition.Timestamp))
+
+		transitions = append(transitions, transition)
+	}
+
+	require.NoError(t, rows.Err())
+	require.NoError(t, rows.Close())
+
+	taskID := int64(6017965227769856)
+	oldStatus := "COMPLETED"
+
+	// The stale events are still a part of the history
+	require.Equal(t, []transition{
+		{OldStatus: &oldStatus, NewStatus: "CREATED", Timestamp: 1722408850000},
+		{OldStatus: &oldStatus, NewStatus: "EXECUTING", Timestamp: 1722408860000},
+		{TaskID: &taskID, NewStatus: "EXECUTING", Timestamp: 1722408869403},
+	}, transitions)
+
+	var auditEventType, actorUsername string
+
+	require.NoError(t, store.DB().QueryRow("SELECT type, actor_username FROM audit_events WHERE id = $1",
+		"bb2bde61-24e6-475c-a8a7-3f03bedcbd61").Scan(&auditEventType, &actorUsername))
+	require.Equal(t, "graphql.mutation", auditEventType)
+	require.Equal(t, "edigaryev", actorUsername)
+
+	var auditEventCount int
+
+	require.NoError(t, store.DB().QueryRow("SELECT COUNT(*) FROM audit_events").Scan(&auditEventCount))
+	require.Equal(t, 1, auditEventCount)
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	body, err := os.ReadFile(filepath.Join("..", "cirrus", "testdata", name))
+	require.NoError(t, err)
+
+	return body
+}
@@ -0,0 +1,31 @@
+package tagpolicy
+
+import "github.com/spf13/cobra"
+
+var allowKeys []string
+var denyKeys []string
+var renameKeys map[string]string
+var staticTags []string
+var hashKeys []string
+var hashKey string
+var bucketKeys map[string]int
+
+func AppendFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&allowKeys, "tags-allow", []string{},
+		"comma-separated list of tag keys to keep, all other tags will be dropped "+
+			"(for example, --tags-allow=action,repository_name,task_status)")
+	cmd.Flags().StringSliceVar(&denyKeys, "tags-deny", []string{},
+		"comma-separated list of tag keys to drop (for example, --tags-deny=build_id,task_id)")
+	cmd.Flags().StringToStringVar(&renameKeys, "tags-rename", map[string]string{},
+		"comma-separated list of tag key renames (for example, --tags-rename=repository_name=repo)")
+	cmd.Flags().StringSliceVar(&staticTags, "tags-static", []string{},
+		"comma-separated list of static tags to add to each event (for example, --tags-static=env:prod)")
+	cmd.Flags().StringSliceVar(&hashKeys, "tags-hash", []string{},
+		"comma-separated list of tag keys whose values will be replaced with a short hash "+
+			"(for example, --tags-hash=actor_location_ip)")
+	cmd.Flags().StringVar(&hashKey, "tags-hash-key", "",
+		"secret key to hash the --tags-hash values with (defaults to the TAGS_HASH_KEY environment variable)")
+	cmd.Flags().StringToIntVar(&bucketKeys, "tags-bucket", map[string]int{},
+		"comma-separated list of tag keys whose values will be hashed into the specified number of buckets "+
+			"(for example, --tags-bucket=build_id=16)")
+}
@@ -0,0 +1,151 @@
+package tagpolicy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	mapset "github.com/deckarep/golang-set/v2"
+	"hash/fnv"
+	"strings"
+)
+
+var ErrInvalidPolicy = errors.New("invalid tag policy")
+
+// Policy controls which tags are emitted and in what form,
+// mostly to keep the tag cardinality under control.
+type Policy struct {
+	allow   mapset.Set[string]
+	deny    mapset.Set[string]
+	rename  map[string]string
+	static  []string
+	hash    mapset.Set[string]
+	hashKey []byte
+	buckets map[string]int
+}
+
+type Options struct {
+	// Allow is a list of tag keys to keep, all other tags will be dropped.
+	Allow []string
+
+	// Deny is a list of tag keys to drop.
+	Deny []string
+
+	// Rename maps the tag keys to their new names.
+	Rename map[string]string
+
+	// Static is a list of tags to add to each event.
+	Static []string
+
+	// Hash is a list of tag keys whose values will be replaced
+	// with a short HMAC SHA-256 of the value keyed with HashKey.
+	Hash    []string
+	HashKey []byte
+
+	// Buckets maps the tag keys to the number of buckets
+	// their values will be hashed into.
+	Buckets map[string]int
+}
+
+// New creates a tag policy from the command-line flags registered with AppendFlags.
+func New() (*Policy, error) {
+	return NewWithOptions(Options{
+		Allow:   allowKeys,
+		Deny:    denyKeys,
+		Rename:  renameKeys,
+		Static:  staticTags,
+		Hash:    hashKeys,
+		HashKey: []byte(server.SecretFromEnv(hashKey, "TAGS_HASH_KEY")),
+		Buckets: bucketKeys,
+	})
+}
+
+func NewWithOptions(options Options) (*Policy, error) {
+	for key, count := range options.Buckets {
+		if count < 1 {
+			return nil, fmt.Errorf("%w: bucket count for tag key %q should be positive, got %d",
+				ErrInvalidPolicy, key, count)
+		}
+	}
+
+	hashSet := mapset.NewSet[string](options.Hash...)
+
+	// Without a secret key, the hashes of the low-entropy values
+	// like IP addresses and usernames are trivially reversible
+	if hashSet.Cardinality() != 0 && len(options.HashKey) == 0 {
+		return nil, fmt.Errorf("%w: hashing tag values requires a hash key", ErrInvalidPolicy)
+	}
+
+	for key := range options.Buckets {
+		if hashSet.Contains(key) {
+			return nil, fmt.Errorf("%w: tag key %q cannot be both hashed and bucketed",
+				ErrInvalidPolicy, key)
+		}
+	}
+
+	return &Policy{
+		allow:   mapset.NewSet[string](options.Allow...),
+		deny:    mapset.NewSet[string](options.Deny...),
+		rename:  options.Rename,
+		static:  options.Static,
+		hash:    hashSet,
+		hashKey: options.HashKey,
+		buckets: options.Buckets,
+	}, nil
+}
+
+// Apply filters and transforms the tags according to the policy.
+//
+// Allow and deny lists, as well as hashing and bucketing, are matched
+// against the original tag keys, before these keys are renamed.
+func (policy *Policy) Apply(tags []string) []string {
+	result := make([]string, 0, len(tags)+len(policy.static))
+
+	for _, tag := range tags {
+		key, value, hasValue := strings.Cut(tag, ":")
+
+		if policy.allow.Cardinality() != 0 && !policy.allow.Contains(key) {
+			continue
+		}
+
+		if policy.deny.Contains(key) {
+			continue
+		}
+
+		if hasValue {
+			if policy.hash.Contains(key) {
+				value = hashValue(policy.hashKey, value)
+			} else if count, ok := policy.buckets[key]; ok {
+				value = bucketValue(value, count)
+			}
+		}
+
+		if newKey, ok := policy.rename[key]; ok {
+			key = newKey
+		}
+
+		if hasValue {
+			result = append(result, fmt.Sprintf("%s:%s", key, value))
+		} else {
+			result = append(result, key)
+		}
+	}
+
+	return append(result, policy.static...)
+}
+
+func hashValue(key []byte, value string) string {
+	hmacSHA256 := hmac.New(sha256.New, key)
+	hmacSHA256.Write([]byte(value))
+
+	return hex.EncodeToString(hmacSHA256.Sum(nil)[:8])
+}
+
+func bucketValue(value string, count int) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(value))
+
+	return fmt.Sprintf("bucket-%d", hash.Sum32()%uint32(count))
+}
@@ -0,0 +1,87 @@
+package tagpolicy_test
+
+import (
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/tagpolicy"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestApplyDefault(t *testing.T) {
+	policy, err := tagpolicy.NewWithOptions(tagpolicy.Options{})
+	require.NoError(t, err)
+
+	tags := []string{"action:created", "build_id:5082236150611968", "flag"}
+	require.Equal(t, tags, policy.Apply(tags))
+}
+
+func TestApplyAllowDenyRenameStatic(t *testing.T) {
+	policy, err := tagpolicy.NewWithOptions(tagpolicy.Options{
+		Allow:  []string{"action", "repository_name", "build_id"},
+		Deny:   []string{"build_id"},
+		Rename: map[string]string{"repository_name": "repo"},
+		Static: []string{"env:prod"},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"action:created",
+		"repo:awesome-system-calls",
+		"env:prod",
+	}, policy.Apply([]string{
+		"action:created",
+		"repository_owner:edigaryev",
+		"repository_name:awesome-system-calls",
+		"build_id:5082236150611968",
+	}))
+}
+
+func TestApplyHashAndBucket(t *testing.T) {
+	policy, err := tagpolicy.NewWithOptions(tagpolicy.Options{
+		Rename:  map[string]string{"build_id": "build"},
+		Hash:    []string{"actor_location_ip"},
+		HashKey: []byte("secret"),
+		Buckets: map[string]int{"build_id": 4},
+	})
+	require.NoError(t, err)
+
+	tags := policy.Apply([]string{
+		"actor_location_ip:1.2.3.4",
+		"build_id:5082236150611968",
+	})
+	require.Len(t, tags, 2)
+	require.Regexp(t, `^actor_location_ip:[0-9a-f]{16}$`, tags[0])
+	require.Regexp(t, `^build:bucket-[0-3]$`, tags[1])
+
+	// Hashing and bucketing should be stable
+	require.Equal(t, tags, policy.Apply([]string{
+		"actor_location_ip:1.2.3.4",
+		"build_id:5082236150611968",
+	}))
+
+	// Hashes should depend on the key
+	otherPolicy, err := tagpolicy.NewWithOptions(tagpolicy.Options{
+		Hash:    []string{"actor_location_ip"},
+		HashKey: []byte("other secret"),
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, tags[0], otherPolicy.Apply([]string{"actor_location_ip:1.2.3.4"})[0])
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := tagpolicy.NewWithOptions(tagpolicy.Options{
+		Buckets: map[string]int{"build_id": 0},
+	})
+	require.ErrorIs(t, err, tagpolicy.ErrInvalidPolicy)
+
+	_, err = tagpolicy.NewWithOptions(tagpolicy.Options{
+		Hash:    []string{"build_id"},
+		HashKey: []byte("secret"),
+		Buckets: map[string]int{"build_id": 2},
+	})
+	require.ErrorIs(t, err, tagpolicy.ErrInvalidPolicy)
+
+	_, err = tagpolicy.NewWithOptions(tagpolicy.Options{
+		Hash: []string{"actor_location_ip"},
+	})
+	require.ErrorIs(t, err, tagpolicy.ErrInvalidPolicy)
+}
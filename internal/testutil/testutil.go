@@ -0,0 +1,95 @@
+// Package testutil contains the helpers shared by the processors' tests.
+package testutil
+
+import (
+	"encoding/json"
+	"github.com/cirruslabs/cirrus-webhooks-server/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Timestamp is the "X-Cirrus-Timestamp" header value that the webhook
+// events are delivered with by default, which is also the task's
+// "statusTimestamp" in the task.json fixture.
+const Timestamp = 1722408869403
+
+type Option func(request *http.Request)
+
+// WithTimestamp overrides the "X-Cirrus-Timestamp" header value.
+func WithTimestamp(timestamp time.Time) Option {
+	return func(request *http.Request) {
+		request.Header.Set("X-Cirrus-Timestamp", strconv.FormatInt(timestamp.UnixMilli(), 10))
+	}
+}
+
+// WithHeader sets an additional header on the webhook event's request.
+func WithHeader(key string, value string) Option {
+	return func(request *http.Request) {
+		request.Header.Set(key, value)
+	}
+}
+
+// Testdata reads the webhook event's body from the internal/cirrus/testdata
+// directory, optionally modifying its JSON payload using the mutators.
+func Testdata(t *testing.T, name string, mutators ...func(payload map[string]any)) []byte {
+	_, file, _, ok := runtime.Caller(0)
+	require.True(t, ok)
+
+	body, err := os.ReadFile(filepath.Join(filepath.Dir(file), "..", "cirrus", "testdata", name))
+	require.NoError(t, err)
+
+	if len(mutators) == 0 {
+		return body
+	}
+
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(body, &payload))
+
+	for _, mutate := range mutators {
+		mutate(payload)
+	}
+
+	body, err = json.Marshal(payload)
+	require.NoError(t, err)
+
+	return body
+}
+
+// Deliver calls the processor's callback the same way the server does.
+func Deliver(callback server.Callback, eventType string, body []byte, opts ...Option) error {
+	request := httptest.NewRequest(http.MethodPost, "/", nil)
+	request.Header.Set("X-Cirrus-Event", eventType)
+	request.Header.Set("X-Cirrus-Timestamp", strconv.FormatInt(Timestamp, 10))
+
+	for _, opt := range opts {
+		opt(request)
+	}
+
+	ctx := echo.New().NewContext(request, httptest.NewRecorder())
+
+	return callback(ctx, eventType, body, zap.S())
+}
+
+// MustDeliver is like Deliver, but fails the test if the callback fails.
+func MustDeliver(t *testing.T, callback server.Callback, eventType string, body []byte, opts ...Option) {
+	require.NoError(t, Deliver(callback, eventType, body, opts...))
+}
+
+// DeliverTestdata delivers the webhook event from the internal/cirrus/testdata
+// directory, failing the test if the callback fails, and returns its body.
+func DeliverTestdata(t *testing.T, callback server.Callback, eventType string, name string, opts ...Option) []byte {
+	body := Testdata(t, name)
+
+	MustDeliver(t, callback, eventType, body, opts...)
+
+	return body
+}